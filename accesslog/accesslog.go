@@ -0,0 +1,108 @@
+package accesslog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/crypto"
+)
+
+type Config struct {
+	Path string // file to append entries to
+	Hash bool   // replace destination hosts with a keyed hash
+	Salt string // hash key, random per run when empty
+}
+
+// Logger records the destination of every tunneled connection. A nil
+// Logger is valid and discards everything, so callers don't need to check.
+type Logger struct {
+	cfg  *Config
+	mu   sync.Mutex
+	file *os.File
+	key  []byte
+}
+
+func New(cfg *Config) (*Logger, error) {
+	file, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %w", err)
+	}
+
+	l := &Logger{cfg: cfg, file: file}
+	if cfg.Hash {
+		salt := cfg.Salt
+		if salt == "" {
+			if salt, err = crypto.RandomToken(32); err != nil {
+				_ = file.Close()
+				return nil, err
+			}
+		}
+		l.key = []byte(salt)
+	}
+	return l, nil
+}
+
+// Log appends one entry for a connection from source to dest on behalf of
+// username. proto names the tunnel (ssh, socks) and dialErr the ACL or dial
+// result.
+func (l *Logger) Log(proto, username, source, dest string, dialErr error) {
+	if l == nil {
+		return
+	}
+
+	result := "ok"
+	if errors.Is(dialErr, acl.ErrDenied) {
+		result = "denied"
+	} else if dialErr != nil {
+		result = "failed"
+	}
+
+	line := fmt.Sprintf("%s proto=%s user=%s src=%s dst=%s result=%s\n",
+		time.Now().UTC().Format(time.RFC3339), proto, username, source, l.destination(dest), result)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.file.WriteString(line)
+}
+
+// destination hashes the host part of dest when hashing is on
+func (l *Logger) destination(dest string) string {
+	return hashDestination(l.key, dest)
+}
+
+// hashDestination replaces the host part of dest with a keyed hash, or
+// returns dest as is when key is nil. The port is kept so abuse such as
+// outbound SMTP stays visible.
+func hashDestination(key []byte, dest string) string {
+	if key == nil {
+		return dest
+	}
+
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		host, port = dest, ""
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(host))
+	hashed := hex.EncodeToString(mac.Sum(nil))[:16]
+	if port == "" {
+		return hashed
+	}
+	return net.JoinHostPort(hashed, port)
+}
+
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,163 @@
+package accesslog
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/crypto"
+)
+
+// Destinations past these limits are counted under OtherDestinations, so a
+// client scanning the internet can't grow the tables without bound
+const (
+	maxClientDestinations = 1000
+	maxGlobalDestinations = 10000
+)
+
+// OtherDestinations collects the connections to destinations beyond the
+// table limits
+const OtherDestinations = "(other)"
+
+type StatsConfig struct {
+	Hash bool   // count a keyed hash of destination hosts instead of the hosts themselves
+	Salt string // hash key, random per run when empty
+}
+
+// DestinationStats counts the tunneled connections to one destination
+type DestinationStats struct {
+	Destination string    `json:"destination"`
+	Connections int64     `json:"connections"`
+	Denied      int64     `json:"denied"` // refused by the ACL or the client's forwarding rules
+	Failed      int64     `json:"failed"` // allowed but the dial failed
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// StatsReport is the top destinations overall and of each requested client
+type StatsReport struct {
+	Since   time.Time                     `json:"since"`
+	Global  []DestinationStats            `json:"global"`
+	Clients map[string][]DestinationStats `json:"clients,omitempty"`
+}
+
+// Stats aggregates tunneled connections by destination ("host:port") per
+// client and overall, to spot abuse such as torrent trackers or spam relays.
+// It only lives in memory and starts over with each run. A nil Stats
+// discards everything.
+type Stats struct {
+	key     []byte
+	since   time.Time
+	mu      sync.Mutex
+	global  map[string]*DestinationStats
+	clients map[string]map[string]*DestinationStats
+}
+
+func NewStats(cfg *StatsConfig) (*Stats, error) {
+	s := &Stats{
+		since:   time.Now(),
+		global:  make(map[string]*DestinationStats),
+		clients: make(map[string]map[string]*DestinationStats),
+	}
+	if cfg.Hash {
+		salt := cfg.Salt
+		if salt == "" {
+			var err error
+			if salt, err = crypto.RandomToken(32); err != nil {
+				return nil, err
+			}
+		}
+		s.key = []byte(salt)
+	}
+	return s, nil
+}
+
+// Record counts a connection by username to dest, with dialErr the ACL or
+// dial result as passed to Logger.Log
+func (s *Stats) Record(username, dest string, dialErr error) {
+	if s == nil {
+		return
+	}
+	dest = hashDestination(s.key, dest)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[username]
+	if !ok {
+		client = make(map[string]*DestinationStats)
+		s.clients[username] = client
+	}
+	for _, st := range []*DestinationStats{entry(client, dest, maxClientDestinations), entry(s.global, dest, maxGlobalDestinations)} {
+		st.Connections++
+		st.LastSeen = now
+		if errors.Is(dialErr, acl.ErrDenied) {
+			st.Denied++
+		} else if dialErr != nil {
+			st.Failed++
+		}
+	}
+}
+
+// entry returns the counters of dest in table, or those of
+// OtherDestinations once the table holds limit destinations
+func entry(table map[string]*DestinationStats, dest string, limit int) *DestinationStats {
+	if st, ok := table[dest]; ok {
+		return st
+	}
+	if len(table) >= limit {
+		dest = OtherDestinations
+		if st, ok := table[dest]; ok {
+			return st
+		}
+	}
+	st := &DestinationStats{Destination: dest}
+	table[dest] = st
+	return st
+}
+
+// Report returns the n most connected destinations overall and, for each of
+// usernames, that client's. An empty username selects every client.
+func (s *Stats) Report(n int, usernames ...string) *StatsReport {
+	if s == nil {
+		return &StatsReport{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := &StatsReport{Since: s.since, Global: top(s.global, n)}
+	for _, username := range usernames {
+		if report.Clients == nil {
+			report.Clients = make(map[string][]DestinationStats)
+		}
+		if username != "" {
+			report.Clients[username] = top(s.clients[username], n)
+			continue
+		}
+		for name, client := range s.clients {
+			report.Clients[name] = top(client, n)
+		}
+	}
+	return report
+}
+
+// top copies the n destinations of table with the most connections, n <= 0
+// meaning all of them
+func top(table map[string]*DestinationStats, n int) []DestinationStats {
+	out := make([]DestinationStats, 0, len(table))
+	for _, st := range table {
+		out = append(out, *st)
+	}
+	slices.SortFunc(out, func(a, b DestinationStats) int {
+		if c := cmp.Compare(b.Connections, a.Connections); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Destination, b.Destination)
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
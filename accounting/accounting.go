@@ -0,0 +1,345 @@
+package accounting
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// What counts toward quotas
+const (
+	CountBoth     = "both"     // upload and download
+	CountDownload = "download" // traffic sent to the client only
+	CountUpload   = "upload"   // traffic received from the client only
+)
+
+// ValidCount reports whether mode is one of the Count* values
+func ValidCount(mode string) bool {
+	switch mode {
+	case CountBoth, CountDownload, CountUpload:
+		return true
+	}
+	return false
+}
+
+// Direction is which way counted bytes travelled, seen from the client
+type Direction int
+
+const (
+	Upload Direction = iota
+	Download
+)
+
+type Config struct {
+	DB            *gorm.DB      // where usage is written
+	FlushInterval time.Duration // how often pending usage is written to the database
+	Count         string        // one of the Count* modes, "" counts both
+	Multiplier    float64       // scales counted traffic before it is billed, 0 means 1
+}
+
+// Accountant collects traffic, logins, and online time from every server and
+// writes them to the database in batches, always as traffic_used =
+// traffic_used + delta so concurrent writers never overwrite each other
+type Accountant struct {
+	cfg    *Config
+	mu     sync.Mutex
+	meters map[uint]*Meter
+}
+
+// Meter tracks one client's usage across all of its connections, so quota
+// checks see SSH and SOCKS traffic combined
+type Meter struct {
+	clientID uint
+	username string
+	base     int64      // traffic_used as of the last flush
+	up       int64      // bytes received from the client not yet written to the database
+	down     int64      // bytes sent to the client not yet written to the database
+	weights  [2]float64 // billed bytes per byte, indexed by Direction
+	refs     int        // open connections, guarded by Accountant.mu
+	limiter  rateLimiter
+
+	slowAt   atomic.Int64 // usage past which a QuotaThrottle client is slowed, 0 for never
+	slowRate atomic.Int64 // speed limit once slowed
+	slowed   atomic.Bool
+
+	seen        int64         // unix nanoseconds of the latest login not yet written, 0 for none
+	onlineSince time.Time     // when refs last went from 0 to 1, guarded by Accountant.mu
+	online      time.Duration // online time not yet written, guarded by Accountant.mu
+}
+
+func New(cfg *Config) *Accountant {
+	return &Accountant{cfg: cfg, meters: make(map[uint]*Meter)}
+}
+
+// Acquire returns the client's meter. Every Acquire must be paired with a
+// Release once the connection closes.
+func (a *Accountant) Acquire(client *models.Client) *Meter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m := a.meter(client)
+	if m.refs == 0 {
+		m.onlineSince = time.Now()
+	}
+	m.refs++
+	// Refreshed on every connection so limit changes apply to new ones
+	var slowAt int64
+	if client.QuotaAction == models.QuotaThrottle {
+		slowAt = client.TrafficLimit
+	}
+	m.slowAt.Store(slowAt)
+	m.slowRate.Store(client.QuotaRate)
+	m.slowed.Store(m.Exceeds(slowAt))
+	if m.slowed.Load() {
+		m.limiter.setRate(client.QuotaRate)
+	} else {
+		m.limiter.setRate(client.SpeedLimit)
+	}
+	return m
+}
+
+func (a *Accountant) Release(m *Meter) {
+	a.mu.Lock()
+	m.refs--
+	if m.refs == 0 {
+		m.online += time.Since(m.onlineSince)
+	}
+	a.mu.Unlock()
+}
+
+// Seen records a login at t, written as last_connection with the next flush
+// rather than a row write per connection
+func (a *Accountant) Seen(client *models.Client, t time.Time) {
+	a.mu.Lock()
+	m := a.meter(client)
+	a.mu.Unlock()
+
+	nanos := t.UnixNano()
+	for {
+		old := atomic.LoadInt64(&m.seen)
+		if old >= nanos || atomic.CompareAndSwapInt64(&m.seen, old, nanos) {
+			return
+		}
+	}
+}
+
+// OutOfTraffic reports whether client has used up its traffic limit,
+// counting usage not yet written to the database
+func (a *Accountant) OutOfTraffic(client *models.Client) bool {
+	a.mu.Lock()
+	m := a.meter(client)
+	a.mu.Unlock()
+	return m.Exceeds(client.TrafficLimit)
+}
+
+// meter returns the client's meter, creating it if needed. a.mu must be held.
+func (a *Accountant) meter(client *models.Client) *Meter {
+	m, ok := a.meters[client.ID]
+	if !ok {
+		m = &Meter{clientID: client.ID, username: client.Username, base: client.TrafficUsed, weights: a.weights()}
+		a.meters[client.ID] = m
+	}
+	return m
+}
+
+// weights returns the billed bytes per byte of each Direction
+func (a *Accountant) weights() [2]float64 {
+	scale := a.cfg.Multiplier
+	if scale == 0 {
+		scale = 1
+	}
+	switch a.cfg.Count {
+	case CountDownload:
+		return [2]float64{Upload: 0, Download: scale}
+	case CountUpload:
+		return [2]float64{Upload: scale, Download: 0}
+	}
+	return [2]float64{Upload: scale, Download: scale}
+}
+
+// Add records n bytes transferred in direction dir
+func (m *Meter) Add(n int, dir Direction) {
+	if dir == Upload {
+		atomic.AddInt64(&m.up, int64(n))
+	} else {
+		atomic.AddInt64(&m.down, int64(n))
+	}
+}
+
+// billed converts raw upload and download bytes to the traffic they count as
+func (m *Meter) billed(up, down int64) int64 {
+	return int64(float64(up)*m.weights[Upload] + float64(down)*m.weights[Download])
+}
+
+// Used returns the client's total usage including unflushed bytes
+func (m *Meter) Used() int64 {
+	return atomic.LoadInt64(&m.base) + m.billed(atomic.LoadInt64(&m.up), atomic.LoadInt64(&m.down))
+}
+
+// Exceeds reports whether usage has reached limit; 0 means unlimited
+func (m *Meter) Exceeds(limit int64) bool {
+	return limit > 0 && m.Used() >= limit
+}
+
+// Usage is a point-in-time reading of one client's meter
+type Usage struct {
+	ClientID    uint   `json:"client_id"`
+	Username    string `json:"username"`
+	TrafficUsed int64  `json:"traffic_used"` // including bytes not yet flushed
+	Connections int    `json:"connections"`
+}
+
+// Snapshot reads every meter of a connected or not yet flushed client,
+// ordered by username
+func (a *Accountant) Snapshot() []Usage {
+	a.mu.Lock()
+	out := make([]Usage, 0, len(a.meters))
+	for _, m := range a.meters {
+		out = append(out, Usage{
+			ClientID:    m.clientID,
+			Username:    m.username,
+			TrafficUsed: m.Used(),
+			Connections: m.refs,
+		})
+	}
+	a.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out
+}
+
+// Start flushes pending usage every FlushInterval until ctx is done. Call
+// Flush after the servers have stopped to write the remainder.
+func (a *Accountant) Start(ctx context.Context) error {
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			a.Flush()
+		}
+	}
+}
+
+// Flush writes all pending usage, logins, and online time in one transaction
+// and refreshes each meter's base from the database, picking up changes such
+// as a CLI reset
+func (a *Accountant) Flush() {
+	now := time.Now()
+
+	a.mu.Lock()
+	meters := make([]*Meter, 0, len(a.meters))
+	online := make([]int64, 0, len(a.meters))
+	for id, m := range a.meters {
+		if m.refs > 0 {
+			m.online += now.Sub(m.onlineSince)
+			m.onlineSince = now
+		}
+		// Whole seconds are written, the remainder waits for the next flush
+		secs := int64(m.online / time.Second)
+		m.online -= time.Duration(secs) * time.Second
+
+		if m.refs == 0 && secs == 0 && atomic.LoadInt64(&m.up) == 0 && atomic.LoadInt64(&m.down) == 0 && atomic.LoadInt64(&m.seen) == 0 {
+			delete(a.meters, id)
+			continue
+		}
+		meters = append(meters, m)
+		online = append(online, secs)
+	}
+	a.mu.Unlock()
+
+	if len(meters) == 0 {
+		return
+	}
+
+	ups := make([]int64, len(meters))
+	downs := make([]int64, len(meters))
+	deltas := make([]int64, len(meters))
+	seen := make([]int64, len(meters))
+	for i, m := range meters {
+		ups[i] = atomic.SwapInt64(&m.up, 0)
+		downs[i] = atomic.SwapInt64(&m.down, 0)
+		deltas[i] = m.billed(ups[i], downs[i])
+		seen[i] = atomic.SwapInt64(&m.seen, 0)
+	}
+
+	day := now.Format(models.TrafficDayFormat)
+	err := a.cfg.DB.Transaction(func(tx *gorm.DB) error {
+		for i, m := range meters {
+			updates := make(map[string]any)
+			if deltas[i] != 0 {
+				updates["traffic_used"] = gorm.Expr("traffic_used + ?", deltas[i])
+			}
+			if online[i] != 0 {
+				updates["online_seconds"] = gorm.Expr("online_seconds + ?", online[i])
+			}
+			if seen[i] != 0 {
+				updates["last_connection"] = time.Unix(0, seen[i])
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := tx.Model(&models.Client{}).Where("id = ?", m.clientID).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+
+			if deltas[i] == 0 {
+				continue
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "client_id"}, {Name: "day"}},
+				DoUpdates: clause.Assignments(map[string]any{"bytes": gorm.Expr("bytes + excluded.bytes")}),
+			}).Create(&models.TrafficLog{ClientID: m.clientID, Day: day, Bytes: deltas[i]}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to write traffic usage: %v", err)
+		// Put everything back so the next flush retries it
+		a.mu.Lock()
+		for i, m := range meters {
+			atomic.AddInt64(&m.up, ups[i])
+			atomic.AddInt64(&m.down, downs[i])
+			m.online += time.Duration(online[i]) * time.Second
+		}
+		a.mu.Unlock()
+		for i, m := range meters {
+			if seen[i] != 0 {
+				atomic.CompareAndSwapInt64(&m.seen, 0, seen[i])
+			}
+		}
+		return
+	}
+
+	ids := make([]uint, len(meters))
+	for i, m := range meters {
+		ids[i] = m.clientID
+	}
+
+	var rows []models.Client
+	if err := a.cfg.DB.Select("id", "traffic_used").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		log.Printf("Failed to refresh traffic usage: %v", err)
+		return
+	}
+	used := make(map[uint]int64, len(rows))
+	for _, r := range rows {
+		used[r.ID] = r.TrafficUsed
+	}
+	for _, m := range meters {
+		if u, ok := used[m.clientID]; ok {
+			atomic.StoreInt64(&m.base, u)
+		}
+	}
+}
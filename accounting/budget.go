@@ -0,0 +1,114 @@
+package accounting
+
+import (
+	"context"
+	"time"
+)
+
+// How often a Budget reads its meter. Between reads it only counts, so
+// connections sharing a meter can go past a limit by up to budgetBytes each
+// before one of them notices. Reading the clock costs more than the rest of
+// Use, so the interval is only checked every budgetUses calls.
+const (
+	budgetBytes    = 256 * 1024
+	budgetInterval = time.Second
+	budgetUses     = 16
+)
+
+// Budget is one direction of one connection drawing on a meter. Rather than
+// adding to the meter and checking the limit on every read or write, it
+// counts locally and settles with the meter every budgetBytes, every
+// budgetInterval, or sooner when the limit is closer than that. A Budget is
+// used by a single copy loop and is not safe for concurrent use.
+type Budget struct {
+	ctx     context.Context // ends the throttling sleep when the connection is closed
+	meter   *Meter
+	dir     Direction
+	limit   int64 // usage past which Use fails, 0 for none
+	charge  bool  // false when the bytes are counted elsewhere, such as on the wire
+	pending int64 // bytes not yet added to the meter
+	left    int64 // bytes that may pass before the meter is read again
+	uses    int   // calls to Use until the clock is read again
+	checked time.Time
+}
+
+// Budget returns a budget for traffic in direction dir that runs out once
+// the client's usage reaches limit or ctx is done. When charge is false the
+// bytes only count against limit and must be added to the meter by the
+// caller.
+func (m *Meter) Budget(ctx context.Context, dir Direction, limit int64, charge bool) *Budget {
+	b := &Budget{ctx: ctx, meter: m, dir: dir, limit: limit, charge: charge}
+	b.settle()
+	return b
+}
+
+// Limit returns how many of n bytes to read or write at once, so that
+// throttling them takes no longer than maxWait
+func (b *Budget) Limit(n int) int {
+	return b.meter.limiter.chunk(n)
+}
+
+// Use accounts for n bytes that passed and throttles them, returning false
+// once the limit has been reached or the context is done
+func (b *Budget) Use(n int) bool {
+	if b.charge {
+		b.pending += int64(n)
+	}
+	b.left -= int64(n)
+	b.uses--
+	if (b.left <= 0 || b.uses <= 0 && b.due()) && !b.settle() {
+		return false
+	}
+	return b.meter.limiter.wait(b.ctx, n)
+}
+
+// Close adds the bytes not yet added to the meter
+func (b *Budget) Close() {
+	if b.pending > 0 {
+		b.meter.Add(int(b.pending), b.dir)
+		b.pending = 0
+	}
+}
+
+// due reports whether budgetInterval has passed since the last settle
+func (b *Budget) due() bool {
+	b.uses = budgetUses
+	return time.Since(b.checked) >= budgetInterval
+}
+
+// settle adds the pending bytes to the meter, slows a QuotaThrottle client
+// that has run out, and works out how far the next reading can wait. It
+// reports whether the limit is still ahead.
+func (b *Budget) settle() bool {
+	b.Close()
+	b.checked = time.Now()
+	b.uses = budgetUses
+
+	m := b.meter
+	used := m.Used()
+	slowAt := m.slowAt.Load()
+	if slowAt > 0 && used >= slowAt && !m.slowed.Load() {
+		m.slowed.Store(true)
+		m.limiter.setRate(m.slowRate.Load())
+	}
+	if b.limit > 0 && used >= b.limit {
+		return false
+	}
+
+	b.left = budgetBytes
+	weight := m.weights[b.dir]
+	if weight == 0 {
+		return true
+	}
+	b.left = min(b.left, b.until(b.limit, used, weight), b.until(slowAt, used, weight))
+	return true
+}
+
+// until returns how many bytes in b's direction take usage from used to at,
+// or budgetBytes when at is not ahead
+func (b *Budget) until(at, used int64, weight float64) int64 {
+	if at <= used {
+		return budgetBytes
+	}
+	return int64(float64(at-used)/weight) + 1
+}
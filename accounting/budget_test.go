@@ -0,0 +1,87 @@
+package accounting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+// benchWrite is the size of a typical relay write
+const benchWrite = 32 * 1024
+
+func benchMeter(b *testing.B, client *models.Client) *Meter {
+	b.Helper()
+	a := New(&Config{})
+	m := a.Acquire(client)
+	b.Cleanup(func() { a.Release(m) })
+	return m
+}
+
+// BenchmarkBudgetUse is the per-write cost of quota enforcement for a
+// client with a limit far off
+func BenchmarkBudgetUse(b *testing.B) {
+	m := benchMeter(b, &models.Client{TrafficLimit: 1 << 62})
+	budget := m.Budget(context.Background(), Download, 1<<62, true)
+	defer budget.Close()
+
+	b.SetBytes(benchWrite)
+	b.ReportAllocs()
+	for range b.N {
+		if !budget.Use(benchWrite) {
+			b.Fatal("budget ran out")
+		}
+	}
+}
+
+// BenchmarkBudgetUseParallel has every goroutine draw on its own budget of
+// one shared meter, as the connections of one client do
+func BenchmarkBudgetUseParallel(b *testing.B) {
+	m := benchMeter(b, &models.Client{TrafficLimit: 1 << 62})
+
+	b.SetBytes(benchWrite)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		budget := m.Budget(context.Background(), Upload, 1<<62, true)
+		defer budget.Close()
+		for pb.Next() {
+			if !budget.Use(benchWrite) {
+				b.Error("budget ran out")
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkMeterPerWrite is the enforcement Budget replaced: adding to the
+// meter and reading usage back on every write
+func BenchmarkMeterPerWrite(b *testing.B) {
+	m := benchMeter(b, &models.Client{TrafficLimit: 1 << 62})
+
+	b.SetBytes(benchWrite)
+	b.ReportAllocs()
+	for range b.N {
+		m.Add(benchWrite, Download)
+		if m.Exceeds(1 << 62) {
+			b.Fatal("limit reached")
+		}
+	}
+}
+
+// BenchmarkMeterPerWriteParallel is BenchmarkMeterPerWrite from every
+// goroutine at once, contending on the shared counters
+func BenchmarkMeterPerWriteParallel(b *testing.B) {
+	m := benchMeter(b, &models.Client{TrafficLimit: 1 << 62})
+
+	b.SetBytes(benchWrite)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Add(benchWrite, Upload)
+			if m.Exceeds(1 << 62) {
+				b.Error("limit reached")
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package accounting
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxWait bounds the sleep after a single read or write. Budget.Limit cuts
+// reads and writes down to what the rate allows in that time, so a slow
+// client's traffic flows in small pieces instead of large bursts followed by
+// long pauses.
+const maxWait = 250 * time.Millisecond
+
+// rateLimiter is a token bucket shared by all of a client's connections. It
+// allows bursts of up to one second of traffic and lets the balance go
+// negative, so a large write is paid for by sleeping afterwards.
+type rateLimiter struct {
+	rate   atomic.Int64 // bytes per second, 0 means unlimited
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) setRate(rate int64) {
+	l.rate.Store(rate)
+}
+
+// chunk returns how many of n bytes can pass without sleeping longer than
+// maxWait, always at least one
+func (l *rateLimiter) chunk(n int) int {
+	r := l.rate.Load()
+	if r <= 0 {
+		return n
+	}
+	return max(1, min(n, int(r*int64(maxWait)/int64(time.Second))))
+}
+
+// wait charges n bytes and sleeps until the bucket is back in credit. It
+// returns false if ctx is done first.
+func (l *rateLimiter) wait(ctx context.Context, n int) bool {
+	// Unlimited clients, most of them, don't contend on the lock
+	r := l.rate.Load()
+	if r <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	rate := float64(r)
+	l.tokens = min(rate, l.tokens+now.Sub(l.last).Seconds()*rate)
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,37 @@
+package accounting
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitStopsWithContext(t *testing.T) {
+	var l rateLimiter
+	l.setRate(1000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if l.wait(ctx, 10_000) {
+		t.Fatal("wait finished despite the context ending")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("wait took %v after the context ended", elapsed)
+	}
+}
+
+func TestRateLimiterChunk(t *testing.T) {
+	var l rateLimiter
+	if got := l.chunk(32 * 1024); got != 32*1024 {
+		t.Fatalf("unlimited chunk = %d, want %d", got, 32*1024)
+	}
+	l.setRate(1000)
+	if got := l.chunk(32 * 1024); got != 250 {
+		t.Fatalf("chunk at 1000 B/s = %d, want 250", got)
+	}
+	l.setRate(1)
+	if got := l.chunk(32 * 1024); got != 1 {
+		t.Fatalf("chunk at 1 B/s = %d, want 1", got)
+	}
+}
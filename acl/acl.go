@@ -0,0 +1,250 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/geoip"
+	"gorm.io/gorm"
+)
+
+// ErrDenied is returned (wrapped) when a rule denies a destination
+var ErrDenied = errors.New("destination denied by ACL")
+
+// cacheTTL bounds how long rule changes made from the CLI take to apply
+const cacheTTL = 30 * time.Second
+
+type Config struct {
+	DB           *gorm.DB  // stored rules
+	ProtectLocal bool      // deny loopback, link-local, and the panel's own listeners
+	LocalPorts   []int     // ports the panel listens on
+	GeoIP        *geoip.DB // needed by country:XX rules
+	Resolver     Resolver  // looks up hostnames CIDR rules need, nil uses the system resolver
+}
+
+// Resolver looks up hostnames; *net.Resolver and *tunnel.Resolver are both one
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Engine decides whether a client may connect to a destination. Client
+// rules are checked first, then the local protection, then global rules,
+// each in creation order, and the first match wins. Destinations no rule
+// matches are allowed.
+type Engine struct {
+	cfg      *Config
+	mu       sync.RWMutex
+	global   []rule
+	clients  map[uint][]rule
+	local    *rule
+	loadedAt time.Time
+}
+
+func New(cfg *Config) *Engine {
+	e := &Engine{cfg: cfg}
+	if cfg.ProtectLocal {
+		e.local = &rule{guard: newLocalGuard(cfg.LocalPorts)}
+	}
+	return e
+}
+
+// Check evaluates dest ("host:port") for clientID and returns the addresses
+// to dial, in the resolver's order. Hostnames are resolved up front when
+// address rules apply so the checked addresses are the ones that get dialed.
+// A nil Engine allows everything.
+func (e *Engine) Check(ctx context.Context, clientID uint, dest string) ([]string, error) {
+	if e == nil {
+		return []string{dest}, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination '%s': %w", dest, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination port '%s'", portStr)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	rules := e.rules(clientID)
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if r := firstMatch(rules, "", addr.Unmap(), uint16(port)); r != nil && !r.allow {
+			return nil, denied(dest, r)
+		}
+		return []string{dest}, nil
+	}
+
+	// Decide on the hostname alone until a CIDR rule needs the address
+	if r, needAddr := matchName(rules, host, uint16(port)); !needAddr {
+		if r != nil && !r.allow {
+			return nil, denied(dest, r)
+		}
+		return []string{dest}, nil
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if e.cfg.Resolver != nil {
+		resolver = e.cfg.Resolver
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	var allowed []string
+	var deniedBy *rule
+	for _, addr := range addrs {
+		r := firstMatch(rules, host, addr.Unmap(), uint16(port))
+		if r == nil || r.allow {
+			allowed = append(allowed, net.JoinHostPort(addr.Unmap().String(), portStr))
+			continue
+		}
+		deniedBy = r
+	}
+	if len(allowed) == 0 {
+		if deniedBy == nil {
+			return nil, fmt.Errorf("failed to resolve %s: no addresses", host)
+		}
+		return nil, denied(dest, deniedBy)
+	}
+	return allowed, nil
+}
+
+func denied(dest string, r *rule) error {
+	if r.guard != nil {
+		return fmt.Errorf("%w: %s (local destination)", ErrDenied, dest)
+	}
+	return fmt.Errorf("%w: %s (rule %d)", ErrDenied, dest, r.id)
+}
+
+// Invalidate forces the next check to reload rules from the database
+func (e *Engine) Invalidate() {
+	e.mu.Lock()
+	e.loadedAt = time.Time{}
+	e.mu.Unlock()
+}
+
+// SetProtectLocal turns the local destination protection on or off and
+// reloads the rules on the next check
+func (e *Engine) SetProtectLocal(protect bool) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cfg.ProtectLocal = protect
+	e.local = nil
+	if protect {
+		e.local = &rule{guard: newLocalGuard(e.cfg.LocalPorts)}
+	}
+	e.loadedAt = time.Time{}
+}
+
+func firstMatch(rules []rule, host string, addr netip.Addr, port uint16) *rule {
+	for i := range rules {
+		r := &rules[i]
+		if !r.matchPort(port) {
+			continue
+		}
+		if (host != "" && r.matchHost(host)) || (addr.IsValid() && r.matchAddr(addr, port)) {
+			return r
+		}
+	}
+	return nil
+}
+
+// matchName returns the first rule matching host by name, or reports that
+// an address rule comes first and the host must be resolved
+func matchName(rules []rule, host string, port uint16) (*rule, bool) {
+	for i := range rules {
+		r := &rules[i]
+		if !r.matchPort(port) {
+			continue
+		}
+		if r.matchHost(host) {
+			return r, false
+		}
+		if r.needsAddr() {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// rules returns the client's rules, the local protection, and the global rules
+func (e *Engine) rules(clientID uint) []rule {
+	e.mu.RLock()
+	if time.Since(e.loadedAt) < cacheTTL {
+		defer e.mu.RUnlock()
+		return e.merged(clientID)
+	}
+	e.mu.RUnlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Since(e.loadedAt) >= cacheTTL {
+		e.load()
+	}
+	return e.merged(clientID)
+}
+
+func (e *Engine) merged(clientID uint) []rule {
+	own := e.clients[clientID]
+	if len(own) == 0 && e.local == nil {
+		return e.global
+	}
+
+	merged := make([]rule, 0, len(own)+len(e.global)+1)
+	merged = append(merged, own...)
+	if e.local != nil {
+		merged = append(merged, *e.local)
+	}
+	return append(merged, e.global...)
+}
+
+func (e *Engine) load() {
+	e.loadedAt = time.Now()
+	if e.local != nil {
+		e.local = &rule{guard: e.local.guard.refreshed()}
+	}
+
+	var stored []models.ACLRule
+	if err := e.cfg.DB.Order("id").Find(&stored).Error; err != nil {
+		log.Printf("Failed to load ACL rules: %v", err)
+		return
+	}
+
+	e.global = nil
+	e.clients = make(map[uint][]rule)
+	for i := range stored {
+		r, err := parseRule(&stored[i])
+		if err != nil {
+			log.Printf("Skipping invalid ACL rule %d: %v", stored[i].ID, err)
+			continue
+		}
+		if r.country != "" {
+			if e.cfg.GeoIP == nil {
+				log.Printf("Skipping ACL rule %d: country rules need a GeoIP database", stored[i].ID)
+				continue
+			}
+			r.geo = e.cfg.GeoIP
+		}
+		if stored[i].ClientID == 0 {
+			e.global = append(e.global, r)
+		} else {
+			e.clients[stored[i].ClientID] = append(e.clients[stored[i].ClientID], r)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package acl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+// ForwardNone in a client's ForwardPorts denies all forwarding
+const ForwardNone = "none"
+
+// ValidateForwardPorts checks a client's ForwardPorts value
+func ValidateForwardPorts(value string) error {
+	if strings.EqualFold(strings.TrimSpace(value), ForwardNone) {
+		return nil
+	}
+	_, err := parsePorts(value)
+	return err
+}
+
+// CheckForward returns a wrapped ErrDenied when client may not open
+// forwarded connections to port
+func CheckForward(client *models.Client, port int) error {
+	value := strings.TrimSpace(client.ForwardPorts)
+	if value == "" {
+		return nil
+	}
+	if strings.EqualFold(value, ForwardNone) {
+		return fmt.Errorf("%w: forwarding is disabled for client '%s'", ErrDenied, client.Username)
+	}
+
+	ranges, err := parsePorts(value)
+	if err != nil {
+		return fmt.Errorf("%w: invalid forwarding ports for client '%s'", ErrDenied, client.Username)
+	}
+	for _, pr := range ranges {
+		if port >= int(pr.lo) && port <= int(pr.hi) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: port %d is not allowed for client '%s'", ErrDenied, port, client.Username)
+}
@@ -0,0 +1,49 @@
+package acl
+
+import (
+	"log"
+	"net"
+	"net/netip"
+)
+
+// localGuard blocks destinations on the server itself: loopback, link-local,
+// and the panel's own listener ports on any local interface address
+type localGuard struct {
+	ports map[uint16]bool
+	addrs map[netip.Addr]bool
+}
+
+func newLocalGuard(ports []int) *localGuard {
+	set := make(map[uint16]bool, len(ports))
+	for _, p := range ports {
+		if p > 0 && p <= 65535 {
+			set[uint16(p)] = true
+		}
+	}
+	return (&localGuard{ports: set}).refreshed()
+}
+
+// refreshed returns a copy of the guard with current interface addresses,
+// which may change at runtime. Guards are never mutated once in use.
+func (g *localGuard) refreshed() *localGuard {
+	addrs := make(map[netip.Addr]bool)
+
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Printf("Failed to list interface addresses: %v", err)
+	}
+	for _, a := range ifaceAddrs {
+		if prefix, err := netip.ParsePrefix(a.String()); err == nil {
+			addrs[prefix.Addr().Unmap()] = true
+		}
+	}
+
+	return &localGuard{ports: g.ports, addrs: addrs}
+}
+
+func (g *localGuard) blocks(addr netip.Addr, port uint16) bool {
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	return g.ports[port] && g.addrs[addr]
+}
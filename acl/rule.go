@@ -0,0 +1,148 @@
+package acl
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/geoip"
+)
+
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+type portRange struct {
+	lo, hi uint16
+}
+
+// rule is a parsed models.ACLRule
+type rule struct {
+	id      uint
+	allow   bool
+	any     bool
+	prefix  netip.Prefix
+	suffix  string
+	country string    // ISO code for destination country rules
+	geo     *geoip.DB // set by the engine for country rules
+	ports   []portRange
+	guard   *localGuard // set on the built-in local protection rule
+}
+
+// Validate checks that a rule's action, target, and ports parse
+func Validate(r *models.ACLRule) error {
+	_, err := parseRule(r)
+	return err
+}
+
+func parseRule(r *models.ACLRule) (rule, error) {
+	parsed := rule{id: r.ID}
+
+	switch r.Action {
+	case ActionAllow:
+		parsed.allow = true
+	case ActionDeny:
+	default:
+		return parsed, fmt.Errorf("invalid action '%s' (use allow or deny)", r.Action)
+	}
+
+	target := strings.ToLower(strings.TrimSpace(r.Target))
+	switch {
+	case target == "" || target == "*":
+		parsed.any = true
+	case strings.HasPrefix(target, "country:"):
+		codes, err := geoip.ParseCountries(strings.TrimPrefix(target, "country:"))
+		if err != nil || len(codes) != 1 {
+			return parsed, fmt.Errorf("invalid country target '%s' (use country:XX)", r.Target)
+		}
+		parsed.country = codes[0]
+	case strings.Contains(target, "/"):
+		prefix, err := netip.ParsePrefix(target)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid CIDR '%s': %w", r.Target, err)
+		}
+		parsed.prefix = prefix.Masked()
+	default:
+		if addr, err := netip.ParseAddr(target); err == nil {
+			parsed.prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		} else {
+			parsed.suffix = strings.TrimSuffix(strings.TrimPrefix(target, "."), ".")
+		}
+	}
+
+	ports, err := parsePorts(r.Ports)
+	if err != nil {
+		return parsed, err
+	}
+	parsed.ports = ports
+	return parsed, nil
+}
+
+func parsePorts(value string) ([]portRange, error) {
+	var ranges []portRange
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		loStr, hiStr, isRange := strings.Cut(part, "-")
+		lo, err := strconv.ParseUint(strings.TrimSpace(loStr), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%s'", part)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.ParseUint(strings.TrimSpace(hiStr), 10, 16); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid port range '%s'", part)
+			}
+		}
+		ranges = append(ranges, portRange{lo: uint16(lo), hi: uint16(hi)})
+	}
+	return ranges, nil
+}
+
+// needsAddr reports whether the rule can only be decided on an address
+func (r *rule) needsAddr() bool {
+	return r.prefix.IsValid() || r.country != "" || r.guard != nil
+}
+
+func (r *rule) matchPort(port uint16) bool {
+	if r.guard != nil || len(r.ports) == 0 {
+		return true
+	}
+	for _, pr := range r.ports {
+		if port >= pr.lo && port <= pr.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost matches domain suffix rules against a destination hostname
+func (r *rule) matchHost(host string) bool {
+	if r.any {
+		return true
+	}
+	if r.suffix == "" {
+		return false
+	}
+	return host == r.suffix || strings.HasSuffix(host, "."+r.suffix)
+}
+
+// matchAddr matches CIDR rules against a resolved destination address
+func (r *rule) matchAddr(addr netip.Addr, port uint16) bool {
+	if r.guard != nil {
+		return r.guard.blocks(addr, port)
+	}
+	if r.any {
+		return true
+	}
+	if r.country != "" {
+		return r.geo.Country(addr.AsSlice()) == r.country
+	}
+	return r.prefix.IsValid() && r.prefix.Contains(addr.Unmap())
+}
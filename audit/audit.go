@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// secretFields are recorded as changed without their values
+var secretFields = map[string]bool{"Password": true, "SubToken": true, "AuthToken": true, "PrevAuthToken": true, "Hash": true}
+
+// ignoredFields change with every write and say nothing about the action
+var ignoredFields = map[string]bool{"CreatedAt": true, "UpdatedAt": true, "DeletedAt": true}
+
+const masked = "***"
+
+// Record stores entry in db along with the fields that differ between
+// before and after, snapshots of the object the action changed that are nil
+// when it didn't exist or is gone. Failures are only logged: the action has
+// already happened by then and must not be reported as failed.
+func Record(db *gorm.DB, entry *models.AdminAudit, before, after any) {
+	b, a := fields(before), fields(after)
+	for name := range ignoredFields {
+		delete(b, name)
+		delete(a, name)
+	}
+	switch {
+	case b != nil && a != nil:
+		for name, value := range b {
+			if v, ok := a[name]; ok && fmt.Sprint(v) == fmt.Sprint(value) {
+				delete(a, name)
+				delete(b, name)
+			}
+		}
+	case b != nil:
+		dropZero(b)
+	case a != nil:
+		dropZero(a)
+	}
+	for name := range secretFields {
+		for _, m := range []map[string]any{b, a} {
+			if _, ok := m[name]; ok {
+				m[name] = masked
+			}
+		}
+	}
+	entry.Before, entry.After = encode(b), encode(a)
+
+	if err := db.Create(entry).Error; err != nil {
+		log.Printf("Failed to record audit entry for %s by %s: %v", entry.Action, entry.Actor, err)
+	}
+}
+
+// fields returns the JSON fields of v, nil for a nil v
+func fields(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return decode(string(data))
+}
+
+func decode(s string) map[string]any {
+	var m map[string]any
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if dec.Decode(&m) != nil {
+		return nil
+	}
+	return m
+}
+
+// dropZero removes the unset fields of an object that was created or
+// removed, which say nothing about it
+func dropZero(m map[string]any) {
+	for name, value := range m {
+		switch value {
+		case "", false, json.Number("0"), "0001-01-01T00:00:00Z", nil:
+			delete(m, name)
+		}
+	}
+}
+
+func encode(m map[string]any) string {
+	if m == nil {
+		return ""
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// Changes describes what entry changed, one "field: before -> after" per
+// field, "-" standing for a missing side
+func Changes(entry *models.AdminAudit) []string {
+	before, after := decode(entry.Before), decode(entry.After)
+
+	names := slices.Collect(maps.Keys(after))
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	changes := make([]string, 0, len(names))
+	for _, name := range names {
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, show(before, name), show(after, name)))
+	}
+	return changes
+}
+
+func show(m map[string]any, name string) string {
+	v, ok := m[name]
+	if !ok {
+		return "-"
+	}
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
+
+// Filter selects audit entries, newest first
+type Filter struct {
+	Actor  string
+	Action string // prefix, e.g. "client" for every client action
+	Since  time.Time
+	Limit  int // 0 for all
+}
+
+// Query returns the entries of db matching f
+func Query(db *gorm.DB, f *Filter) ([]models.AdminAudit, error) {
+	query := db.Order("id DESC")
+	if f.Actor != "" {
+		query = query.Where("actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ? OR action LIKE ?", f.Action, f.Action+" %")
+	}
+	if !f.Since.IsZero() {
+		query = query.Where("created_at >= ?", f.Since)
+	}
+	if f.Limit > 0 {
+		query = query.Limit(f.Limit)
+	}
+	var entries []models.AdminAudit
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
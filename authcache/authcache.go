@@ -0,0 +1,126 @@
+package authcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// DefaultTTL bounds how long a client stays cached when nothing invalidates it
+const DefaultTTL = 10 * time.Second
+
+type entry struct {
+	client   models.Client
+	loadedAt time.Time
+}
+
+// Cache keeps recently loaded clients in memory, so apps that open dozens
+// of connections a second don't query the database for each one. Invalidate
+// and InvalidateAll are no-ops on a nil *Cache.
+type Cache struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]entry
+	tokens  map[string]string // auth token to username, checked against the entry on use
+}
+
+// New returns a cache of the clients in db that keeps them for ttl; 0
+// disables caching
+func New(db *gorm.DB, ttl time.Duration) *Cache {
+	return &Cache{db: db, ttl: ttl, entries: make(map[string]entry), tokens: make(map[string]string)}
+}
+
+// SetTTL changes how long clients stay cached; 0 disables the cache
+func (c *Cache) SetTTL(d time.Duration) {
+	c.mu.Lock()
+	c.ttl = d
+	c.entries = make(map[string]entry)
+	c.tokens = make(map[string]string)
+	c.mu.Unlock()
+}
+
+// Lookup returns the client with username, from memory when it was loaded
+// within the TTL. Unknown usernames are not cached. The returned client is a
+// copy the caller may modify.
+func (c *Cache) Lookup(username string) (models.Client, error) {
+	c.mu.Lock()
+	e, ok := c.entries[username]
+	current := c.ttl
+	c.mu.Unlock()
+	if ok && time.Since(e.loadedAt) < current {
+		return e.client, nil
+	}
+
+	var client models.Client
+	if err := c.db.Where("username = ?", username).First(&client).Error; err != nil {
+		return client, err
+	}
+
+	if current > 0 {
+		c.mu.Lock()
+		c.entries[username] = entry{client: client, loadedAt: time.Now()}
+		c.mu.Unlock()
+	}
+	return client, nil
+}
+
+// LookupToken returns the client whose AuthToken or PrevAuthToken is token,
+// like Lookup. A token the client no longer has is reported as
+// gorm.ErrRecordNotFound; whether one it has is still valid is left to
+// Client.TokenValid.
+func (c *Cache) LookupToken(token string) (models.Client, error) {
+	if token == "" {
+		return models.Client{}, gorm.ErrRecordNotFound
+	}
+	c.mu.Lock()
+	username, ok := c.tokens[token]
+	c.mu.Unlock()
+	if ok {
+		client, err := c.Lookup(username)
+		if err == nil && (client.AuthToken == token || client.PrevAuthToken == token) {
+			return client, nil
+		}
+		c.mu.Lock()
+		delete(c.tokens, token)
+		c.mu.Unlock()
+	}
+
+	var client models.Client
+	if err := c.db.Where("auth_token = ? OR prev_auth_token = ?", token, token).First(&client).Error; err != nil {
+		return client, err
+	}
+
+	c.mu.Lock()
+	if c.ttl > 0 {
+		c.entries[client.Username] = entry{client: client, loadedAt: time.Now()}
+		c.tokens[token] = client.Username
+	}
+	c.mu.Unlock()
+	return client, nil
+}
+
+// Invalidate drops username so the next lookup reads the database
+func (c *Cache) Invalidate(username string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, username)
+	c.mu.Unlock()
+}
+
+// InvalidateAll drops every cached client, for changes made outside the
+// server such as CLI edits
+func (c *Cache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	clear(c.entries)
+	clear(c.tokens)
+	c.mu.Unlock()
+}
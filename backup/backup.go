@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/gorm"
+)
+
+const magic = "LSBK1"
+
+// Snapshot writes a consistent copy of the SQLite database and returns its contents
+func Snapshot(db *gorm.DB) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "panel-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "panel.db")
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return nil, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// Create snapshots db and encrypts the snapshot with passphrase, or leaves
+// it in the clear when passphrase is empty. It returns the snapshot along
+// with the file name to store it under.
+func Create(db *gorm.DB, passphrase string, now time.Time) (string, []byte, error) {
+	data, err := Snapshot(db)
+	if err != nil {
+		return "", nil, err
+	}
+
+	filename := fmt.Sprintf("panel-%s.db", now.UTC().Format("20060102-150405"))
+	if passphrase == "" {
+		return filename, data, nil
+	}
+	data, err = Encrypt(data, passphrase)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	return filename + ".enc", data, nil
+}
+
+// Encrypt seals data with AES-256-GCM under a key derived from passphrase
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(magic)+len(salt)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, magic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, []byte(magic)), nil
+}
+
+// Decrypt reverses Encrypt
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, errors.New("not an encrypted panel backup")
+	}
+	data = data[len(magic):]
+	if len(data) < 16 {
+		return nil, errors.New("backup is truncated")
+	}
+
+	salt := data[:16]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[16:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("backup is truncated")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(magic))
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted backup")
+	}
+	return plain, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/clock"
+	"gorm.io/gorm"
+)
+
+// uploadTimeout bounds one upload of a scheduled backup
+const uploadTimeout = 5 * time.Minute
+
+type Config struct {
+	DB           *gorm.DB
+	At           time.Duration // time of day backups are made, in server time
+	Passphrase   string        // encrypts backups; empty uploads them in the clear
+	Destinations []Destination
+}
+
+// Scheduler uploads a snapshot of the database to every destination once a
+// day
+type Scheduler struct {
+	cfg *Config
+}
+
+func NewScheduler(cfg *Config) (*Scheduler, error) {
+	if cfg.At < 0 || cfg.At >= 24*time.Hour {
+		return nil, fmt.Errorf("backup time %s is not a time of day", cfg.At)
+	}
+	if len(cfg.Destinations) == 0 {
+		return nil, errors.New("scheduled backups need a destination")
+	}
+	return &Scheduler{cfg: cfg}, nil
+}
+
+// Start makes a backup every day at the configured time until ctx is done
+func (s *Scheduler) Start(ctx context.Context) error {
+	for {
+		now := clock.Now()
+		timer := time.NewTimer(s.next(now).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		if err := s.Run(ctx); err != nil {
+			log.Printf("Backups: %v", err)
+		}
+	}
+}
+
+// Run makes a backup now and uploads it to every destination, trying them
+// all even when some fail
+func (s *Scheduler) Run(ctx context.Context) error {
+	filename, data, err := Create(s.cfg.DB, s.cfg.Passphrase, clock.Now())
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, dest := range s.cfg.Destinations {
+		uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
+		err := dest.Upload(uploadCtx, filename, data)
+		cancel()
+		if err != nil {
+			log.Printf("Backups: upload of %s to %s failed: %v", filename, dest.Name(), err)
+			failed = append(failed, dest.Name())
+			continue
+		}
+		log.Printf("Backups: uploaded %s to %s", filename, dest.Name())
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("backup upload failed for: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// next returns when the backup after now is due
+func (s *Scheduler) next(now time.Time) time.Time {
+	at := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(s.cfg.At)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at
+}
@@ -0,0 +1,242 @@
+package bans
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// syncInterval is how often bans are reloaded so CLI unbans take effect
+const syncInterval = 30 * time.Second
+
+type Config struct {
+	DB        *gorm.DB      // where bans are kept
+	Threshold int           // failed logins that trigger a ban
+	Window    time.Duration // failures older than this are forgotten
+	Duration  time.Duration // how long a ban lasts
+	NFTSet    string        // optional nftables set ("family table set") to mirror IPv4 bans into
+}
+
+type failure struct {
+	count int
+	first time.Time
+}
+
+// Guard counts failed logins per source IP and bans offenders. A nil Guard
+// never bans. Loopback sources are exempt since every DNS tunnel user
+// arrives from 127.0.0.1.
+type Guard struct {
+	cfg      *Config
+	mu       sync.Mutex
+	failures map[string]*failure
+	banned   map[string]time.Time
+}
+
+func New(cfg *Config) *Guard {
+	return &Guard{
+		cfg:      cfg,
+		failures: make(map[string]*failure),
+		banned:   make(map[string]time.Time),
+	}
+}
+
+// SetLimits changes the ban threshold, window, and duration of a running
+// guard. Existing bans keep their expiry.
+func (g *Guard) SetLimits(threshold int, window, duration time.Duration) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.cfg.Threshold = threshold
+	g.cfg.Window = window
+	g.cfg.Duration = duration
+	g.mu.Unlock()
+}
+
+// Banned reports whether connections from addr should be dropped
+func (g *Guard) Banned(addr net.Addr) bool {
+	ip := hostIP(addr)
+	if g == nil || ip == "" {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	until, ok := g.banned[ip]
+	return ok && time.Now().Before(until)
+}
+
+// Fail records a failed login from addr and bans it once the threshold is hit
+func (g *Guard) Fail(addr net.Addr, reason string) {
+	ip := hostIP(addr)
+	if g == nil || ip == "" || net.ParseIP(ip).IsLoopback() {
+		return
+	}
+
+	now := time.Now()
+
+	g.mu.Lock()
+	f, ok := g.failures[ip]
+	if !ok || now.Sub(f.first) > g.cfg.Window {
+		f = &failure{first: now}
+		g.failures[ip] = f
+	}
+	f.count++
+	count := f.count
+	trigger := g.cfg.Threshold > 0 && count >= g.cfg.Threshold
+	until := now.Add(g.cfg.Duration)
+	if trigger {
+		delete(g.failures, ip)
+		g.banned[ip] = until
+	}
+	g.mu.Unlock()
+
+	if trigger {
+		log.Printf("Banning %s until %s after %d failed logins (%s)", ip, until.Format(time.RFC3339), count, reason)
+		g.ban(ip, reason, count, until)
+	}
+}
+
+// Ban blocks addr for the ban duration right away, for abuse other than
+// failed logins. Loopback sources are exempt.
+func (g *Guard) Ban(addr net.Addr, reason string) {
+	ip := hostIP(addr)
+	if g == nil || ip == "" || net.ParseIP(ip).IsLoopback() {
+		return
+	}
+
+	until := time.Now().Add(g.cfg.Duration)
+	g.mu.Lock()
+	if current, ok := g.banned[ip]; ok && !current.Before(until) {
+		g.mu.Unlock()
+		return
+	}
+	g.banned[ip] = until
+	g.mu.Unlock()
+
+	log.Printf("Banning %s until %s (%s)", ip, until.Format(time.RFC3339), reason)
+	g.ban(ip, reason, 0, until)
+}
+
+// Succeed clears the failure count for addr after a good login
+func (g *Guard) Succeed(addr net.Addr) {
+	ip := hostIP(addr)
+	if g == nil || ip == "" {
+		return
+	}
+
+	g.mu.Lock()
+	delete(g.failures, ip)
+	g.mu.Unlock()
+}
+
+// ban records a ban in the database and the nftables set
+func (g *Guard) ban(ip, reason string, failures int, until time.Time) {
+	var ban models.Ban
+	g.cfg.DB.Where("ip = ?", ip).First(&ban)
+	ban.IP = ip
+	ban.Reason = reason
+	ban.Failures = failures
+	ban.ExpiresAt = until
+	if err := g.cfg.DB.Save(&ban).Error; err != nil {
+		log.Printf("Failed to save ban for %s: %v", ip, err)
+	}
+
+	g.nft("add", ip, time.Until(until))
+}
+
+// Start keeps the in-memory bans in sync with the database until ctx is done
+func (g *Guard) Start(ctx context.Context) error {
+	g.sync()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			g.sync()
+		}
+	}
+}
+
+// sync drops expired bans and picks up bans removed or added from the CLI
+func (g *Guard) sync() {
+	now := time.Now()
+
+	if err := g.cfg.DB.Unscoped().Where("expires_at <= ?", now).Delete(&models.Ban{}).Error; err != nil {
+		log.Printf("Failed to purge expired bans: %v", err)
+	}
+
+	var active []models.Ban
+	if err := g.cfg.DB.Find(&active).Error; err != nil {
+		log.Printf("Failed to load bans: %v", err)
+		return
+	}
+
+	current := make(map[string]time.Time, len(active))
+	for _, b := range active {
+		current[b.IP] = b.ExpiresAt
+	}
+
+	g.mu.Lock()
+	var lifted []string
+	for ip, until := range g.banned {
+		if _, ok := current[ip]; !ok && now.Before(until) {
+			lifted = append(lifted, ip)
+		}
+	}
+	g.banned = current
+	for ip := range g.failures {
+		if now.Sub(g.failures[ip].first) > g.cfg.Window {
+			delete(g.failures, ip)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, ip := range lifted {
+		log.Printf("Ban on %s lifted", ip)
+		g.nft("delete", ip, 0)
+	}
+}
+
+// nft mirrors a ban into the configured nftables set so the kernel drops
+// the IP before it reaches the panel. The set needs "flags timeout".
+func (g *Guard) nft(op, ip string, timeout time.Duration) {
+	if g.cfg.NFTSet == "" || net.ParseIP(ip).To4() == nil {
+		return
+	}
+
+	element := ip
+	if op == "add" {
+		element += fmt.Sprintf(" timeout %ds", int(timeout.Seconds()))
+	}
+
+	args := append([]string{op, "element"}, strings.Fields(g.cfg.NFTSet)...)
+	args = append(args, "{ "+element+" }")
+	if out, err := exec.Command("nft", args...).CombinedOutput(); err != nil {
+		log.Printf("Failed to %s %s in nftables set: %v: %s", op, ip, err, strings.TrimSpace(string(out)))
+	}
+}
+
+func hostIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,207 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/clock"
+	"github.com/libersuite-org/panel/crypto"
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is wrapped by errors about usernames no client has
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidFilter is wrapped by errors about filters List can't apply
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+// Manager creates and changes the clients stored in a database, dropping
+// changed clients from the auth cache so a server sharing it applies the
+// change at their next login
+type Manager struct {
+	db   *gorm.DB
+	auth *authcache.Cache
+}
+
+// NewManager returns a manager of the clients in db; auth may be nil when
+// no server in this process caches clients
+func NewManager(db *gorm.DB, auth *authcache.Cache) *Manager {
+	return &Manager{db: db, auth: auth}
+}
+
+// Create stores client, giving it subscription and auth tokens and starting
+// its monthly reset period when they aren't set
+func (m *Manager) Create(client *models.Client) error {
+	if client.SubToken == "" {
+		token, err := crypto.RandomToken(16)
+		if err != nil {
+			return err
+		}
+		client.SubToken = token
+	}
+	if client.AuthToken == "" {
+		token, err := crypto.RandomToken(16)
+		if err != nil {
+			return err
+		}
+		client.AuthToken = token
+	}
+	if client.LastResetAt.IsZero() {
+		client.LastResetAt = time.Now()
+	}
+	if err := m.db.Create(client).Error; err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	return nil
+}
+
+// Get returns the client with username
+func (m *Manager) Get(username string) (*models.Client, error) {
+	var client models.Client
+	err := m.db.Where("username = ?", username).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, notFound(username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client: %w", err)
+	}
+	return &client, nil
+}
+
+// AuthToken returns the token the client with username logs in to SOCKS
+// with, generating one for clients created without it, e.g. by an import
+func (m *Manager) AuthToken(username string) (string, error) {
+	client, err := m.Get(username)
+	if err != nil {
+		return "", err
+	}
+	if client.AuthToken != "" {
+		return client.AuthToken, nil
+	}
+	token, err := crypto.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	// Only fill the token in if it is still missing, so two callers racing
+	// here agree on the one that was stored. Rows from before the column
+	// existed hold NULL.
+	result := m.db.Model(&models.Client{}).
+		Where("id = ? AND (auth_token = '' OR auth_token IS NULL)", client.ID).
+		Update("auth_token", token)
+	if result.Error != nil {
+		return "", fmt.Errorf("failed to update auth token: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		m.auth.Invalidate(username)
+	}
+	if client, err = m.Get(username); err != nil {
+		return "", err
+	}
+	return client.AuthToken, nil
+}
+
+// RotateToken gives the client with username a new auth token that works
+// for validFor, or indefinitely when it is 0, and keeps the old one working
+// for grace so apps can pick up the new one. With no grace the old token
+// stops working right away, revoking configs that leaked it.
+func (m *Manager) RotateToken(username string, validFor, grace time.Duration) (*models.Client, error) {
+	client, err := m.Get(username)
+	if err != nil {
+		return nil, err
+	}
+	token, err := crypto.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := clock.Now()
+	updates := map[string]any{
+		"auth_token":            token,
+		"auth_token_expires_at": time.Time{},
+		"prev_auth_token":       "",
+		"prev_auth_token_until": time.Time{},
+	}
+	if validFor > 0 {
+		updates["auth_token_expires_at"] = now.Add(validFor)
+	}
+	if grace > 0 && client.TokenValid(client.AuthToken) {
+		updates["prev_auth_token"] = client.AuthToken
+		updates["prev_auth_token_until"] = now.Add(grace)
+	}
+	if err := m.db.Model(client).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to rotate auth token: %w", err)
+	}
+	m.auth.Invalidate(username)
+	return m.Get(username)
+}
+
+// List returns the page of clients matching filter along with how many
+// match it in all
+func (m *Manager) List(filter *models.ClientFilter) ([]models.Client, int64, error) {
+	query, err := filter.Where(m.db.Model(&models.Client{}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count clients: %w", err)
+	}
+	if query, err = filter.Page(query); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+	}
+	var clients []models.Client
+	if err := query.Find(&clients).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve clients: %w", err)
+	}
+	return clients, total, nil
+}
+
+// Remove deletes the client with username for good
+func (m *Manager) Remove(username string) error {
+	result := m.db.Unscoped().Where("username = ?", username).Delete(&models.Client{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFound(username)
+	}
+	m.auth.Invalidate(username)
+	return nil
+}
+
+// SetEnabled enables or disables the client with username
+func (m *Manager) SetEnabled(username string, enabled bool) error {
+	result := m.db.Model(&models.Client{}).Where("username = ?", username).Update("enabled", enabled)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFound(username)
+	}
+	m.auth.Invalidate(username)
+	return nil
+}
+
+// ResetTraffic zeroes the traffic used by the client with username without
+// renewing it. Usage a running server hasn't flushed yet still counts.
+func (m *Manager) ResetTraffic(username string) error {
+	result := m.db.Model(&models.Client{}).Where("username = ?", username).
+		Updates(map[string]any{"traffic_used": 0, "notified_quota": false})
+	if result.Error != nil {
+		return fmt.Errorf("failed to reset client traffic: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFound(username)
+	}
+	m.auth.Invalidate(username)
+	return nil
+}
+
+func notFound(username string) error {
+	return fmt.Errorf("client '%s' %w", username, ErrNotFound)
+}
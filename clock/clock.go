@@ -0,0 +1,166 @@
+package clock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds between 1900-01-01 and 1970-01-01
+const ntpEpochOffset = 2208988800
+
+var offset atomic.Int64
+
+// Now returns the current time adjusted by the correction offset used for
+// expiry enforcement. Without a correction it is time.Now().
+func Now() time.Time {
+	return time.Now().Add(time.Duration(offset.Load()))
+}
+
+// SetOffset sets the correction applied by Now
+func SetOffset(d time.Duration) {
+	offset.Store(int64(d))
+}
+
+// QueryNTP asks an NTP server for the local clock's offset using SNTP.
+// A positive offset means the local clock is behind.
+func QueryNTP(server string, timeout time.Duration) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach NTP server %s: %w", server, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	req := make([]byte, 48)
+	req[0] = 0x1B // LI=0, VN=3, Mode=3 (client)
+
+	// The server echoes our transmit timestamp as its originate timestamp,
+	// which ties the reply to this request
+	t1 := time.Now()
+	putNTPTime(req[40:48], t1)
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("failed to send NTP request: %w", err)
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read NTP response: %w", err)
+	}
+	t4 := time.Now()
+
+	if n < len(resp) {
+		return 0, fmt.Errorf("short NTP response from %s: %d bytes", server, n)
+	}
+	if !bytes.Equal(resp[24:32], req[40:48]) {
+		return 0, fmt.Errorf("NTP response from %s does not match the request", server)
+	}
+	leap, mode, stratum := resp[0]>>6, resp[0]&0x7, resp[1]
+	switch {
+	case mode != 4:
+		return 0, fmt.Errorf("invalid NTP response from %s: mode %d", server, mode)
+	case leap == 3:
+		return 0, fmt.Errorf("NTP server %s is not synchronized", server)
+	case stratum == 0 || stratum > 15:
+		return 0, fmt.Errorf("NTP server %s is not synchronized: stratum %d", server, stratum)
+	}
+
+	t2 := ntpTime(resp[32:40])
+	t3 := ntpTime(resp[40:48])
+	if t2.IsZero() || t3.IsZero() {
+		return 0, fmt.Errorf("invalid NTP response from %s", server)
+	}
+
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	secs := binary.BigEndian.Uint32(b[0:4])
+	frac := binary.BigEndian.Uint32(b[4:8])
+	if secs == 0 && frac == 0 {
+		return time.Time{}
+	}
+	nanos := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(secs)-ntpEpochOffset, nanos)
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+type MonitorConfig struct {
+	Server        string
+	Interval      time.Duration
+	MaxDrift      time.Duration // warn when the offset exceeds this
+	Correct       bool          // apply the measured offset to Now
+	MaxCorrection time.Duration // largest offset applied, 0 for no limit
+}
+
+// Monitor periodically compares the local clock against an NTP server
+type Monitor struct {
+	cfg *MonitorConfig
+}
+
+func NewMonitor(cfg *MonitorConfig) *Monitor {
+	return &Monitor{cfg: cfg}
+}
+
+func (m *Monitor) Start(ctx context.Context) error {
+	m.check()
+
+	interval := m.cfg.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (m *Monitor) check() {
+	drift, err := QueryNTP(m.cfg.Server, 5*time.Second)
+	if err != nil {
+		log.Printf("Clock check failed: %v", err)
+		return
+	}
+
+	abs := drift
+	if abs < 0 {
+		abs = -abs
+	}
+
+	if m.cfg.MaxDrift > 0 && abs > m.cfg.MaxDrift {
+		log.Printf("WARNING: system clock is off by %s according to %s; expiry checks will be wrong until it is fixed", drift.Round(time.Millisecond), m.cfg.Server)
+	}
+
+	if m.cfg.Correct {
+		if limit := m.cfg.MaxCorrection; limit > 0 && abs > limit {
+			log.Printf("WARNING: clock offset of %s is over the %s correction limit; correcting by %s only", drift.Round(time.Millisecond), limit, limit)
+			drift = max(-limit, min(drift, limit))
+			abs = limit
+		}
+		SetOffset(drift)
+		if abs > time.Second {
+			log.Printf("Applying clock correction of %s to expiry enforcement", drift.Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libersuite-org/panel/crypto"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/spf13/cobra"
+)
+
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys",
+	Long: fmt.Sprintf(`Create scoped keys for the REST API, for use as Bearer tokens alongside
+the server's --api-token. Keys are stored hashed and shown only once.
+
+Scopes: %s`, strings.Join(models.APIScopes, ", ")),
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:     "create [name]",
+	Short:   "Create an API key",
+	Example: `  panel apikey create billing --scope clients:read --rate-limit 60`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		rateLimit, _ := cmd.Flags().GetInt("rate-limit")
+
+		if len(scopes) == 0 {
+			return fmt.Errorf("at least one --scope is required")
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(models.APIScopes, scope) {
+				return fmt.Errorf("unknown scope '%s' (want one of %s)", scope, strings.Join(models.APIScopes, ", "))
+			}
+		}
+		if rateLimit < 0 {
+			return fmt.Errorf("--rate-limit cannot be negative")
+		}
+
+		secret, err := crypto.RandomToken(24)
+		if err != nil {
+			return err
+		}
+		token := models.APIKeyPrefix + secret
+
+		key := &models.APIKey{
+			Name:      name,
+			Hash:      models.HashAPIKey(token),
+			Hint:      token[:len(models.APIKeyPrefix)+6],
+			Scopes:    strings.Join(scopes, ","),
+			RateLimit: rateLimit,
+		}
+		if err := database.DB.Create(key).Error; err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
+
+		fmt.Printf("API key '%s' created successfully\n\n", name)
+		fmt.Printf("  %s\n\n", token)
+		fmt.Println("Store it now; it cannot be shown again.")
+		return nil
+	},
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API keys",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var keys []models.APIKey
+		if err := database.DB.Order("name").Find(&keys).Error; err != nil {
+			return fmt.Errorf("failed to retrieve API keys: %w", err)
+		}
+
+		if len(keys) == 0 {
+			fmt.Println("No API keys found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tKEY\tSCOPES\tRATE LIMIT\tLAST USED\tSTATUS")
+		fmt.Fprintln(w, "----\t---\t------\t----------\t---------\t------")
+		for _, k := range keys {
+			rateLimit := "Unlimited"
+			if k.RateLimit > 0 {
+				rateLimit = fmt.Sprintf("%d/min", k.RateLimit)
+			}
+			lastUsed := "Never"
+			if !k.LastUsedAt.IsZero() {
+				lastUsed = k.LastUsedAt.Format("2006-01-02 15:04")
+			}
+			status := "Active"
+			if k.Revoked() {
+				status = "Revoked " + k.RevokedAt.Format("2006-01-02")
+			}
+			fmt.Fprintf(w, "%s\t%s...\t%s\t%s\t%s\t%s\n", k.Name, k.Hint, k.Scopes, rateLimit, lastUsed, status)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke [name]",
+	Short: "Revoke an API key",
+	Long:  `Revoke an API key. Requests using it are rejected from then on; the key stays listed.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		result := database.DB.Model(&models.APIKey{}).Where("name = ? AND revoked_at = ?", name, time.Time{}).Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke API key: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("active API key '%s' not found", name)
+		}
+
+		fmt.Printf("API key '%s' revoked successfully\n", name)
+		return nil
+	},
+}
+
+func init() {
+	apikeyCreateCmd.Flags().StringSlice("scope", nil, "Scope to grant, repeatable or comma-separated")
+	apikeyCreateCmd.Flags().Int("rate-limit", 0, "Requests per minute (0 for unlimited)")
+
+	apikeyCmd.AddCommand(apikeyCreateCmd)
+	apikeyCmd.AddCommand(apikeyListCmd)
+	apikeyCmd.AddCommand(apikeyRevokeCmd)
+}
@@ -0,0 +1,203 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libersuite-org/panel/audit"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the admin activity audit trail",
+	Long: `Show who changed what: every command that changes the panel and every
+write through the web API is recorded with the operator (the OS user, or
+the API key name), where they connected from, and the fields the change
+touched before and after. Passwords and tokens are recorded as changed
+without their values.
+
+The CLI takes the operator's IP address from SSH_CLIENT, so operators
+sharing a server should log in as their own users and use sudo. The same
+trail is served at /api/v1/audit to API keys with the audit:read scope.`,
+	Example: `  panel audit
+  panel audit --actor alice --since 24h
+  panel audit --action "client remove"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actor, _ := cmd.Flags().GetString("actor")
+		action, _ := cmd.Flags().GetString("action")
+		since, _ := cmd.Flags().GetDuration("since")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		filter := &audit.Filter{Actor: actor, Action: action, Limit: limit}
+		if since > 0 {
+			filter.Since = time.Now().Add(-since)
+		}
+		entries, err := audit.Query(database.DB, filter)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("No audit entries found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tACTOR\tSOURCE\tIP\tACTION\tTARGET\tCHANGES")
+		fmt.Fprintln(w, "----\t-----\t------\t--\t------\t------\t-------")
+		for _, e := range entries {
+			ip := e.IP
+			if ip == "" {
+				ip = "-"
+			}
+			changes := strings.Join(audit.Changes(&e), ", ")
+			if changes == "" {
+				changes = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.CreatedAt.Format("2006-01-02 15:04:05"),
+				e.Actor,
+				e.Source,
+				ip,
+				e.Action,
+				e.Target,
+				changes,
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// unauditedCommands only read or run services, so they are not recorded
+var unauditedCommands = map[string]bool{
+	"list": true, "check": true, "show": true, "status": true, "stats": true,
+	"usage": true, "locations": true, "export": true, "export-all": true,
+	"subscription": true, "forwards": true, "fingerprint": true,
+	"destinations": true, "decrypt": true, "audit": true,
+	"server": true, "relay": true, "help": true, "completion": true,
+}
+
+// secretArgs are the positions of arguments holding secrets, by command path
+var secretArgs = map[string]int{"panel client add": 1}
+
+// auditLoaders snapshot the object a command changes from the name the
+// command takes as its first argument, by parent command
+var auditLoaders = map[string]func(name string) any{
+	"client":   func(name string) any { return auditLoad(&models.Client{}, "username", name) },
+	"plan":     func(name string) any { return auditLoad(&models.Plan{}, "name", name) },
+	"apikey":   func(name string) any { return auditLoad(&models.APIKey{}, "name", name) },
+	"feature":  func(name string) any { return auditLoad(&models.FeatureFlag{}, "name", name) },
+	"template": func(name string) any { return auditLoad(&models.ExportTemplate{}, "name", name) },
+}
+
+// auditLoad returns the row of model with column = value, or nil
+func auditLoad(model any, column, value string) any {
+	if database.DB.Where(column+" = ?", value).First(model).Error != nil {
+		return nil
+	}
+	return model
+}
+
+// pendingAudit is the command being run, recorded once it succeeds
+var pendingAudit *cliAudit
+
+type cliAudit struct {
+	entry  *models.AdminAudit
+	load   func(name string) any
+	name   string // first argument, naming the changed object
+	before any
+}
+
+// beginAudit snapshots what cmd is about to change; called once the
+// database is open
+func beginAudit(cmd *cobra.Command, args []string) {
+	if unauditedCommands[cmd.Name()] || !cmd.Runnable() {
+		return
+	}
+	for c := cmd.Parent(); c != nil; c = c.Parent() {
+		if unauditedCommands[c.Name()] {
+			return
+		}
+	}
+
+	target := make([]string, 0, len(args))
+	for i, arg := range args {
+		if pos, ok := secretArgs[cmd.CommandPath()]; ok && pos == i {
+			arg = "***"
+		}
+		target = append(target, arg)
+	}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if cmd.InheritedFlags().Lookup(f.Name) != nil {
+			return
+		}
+		value := f.Value.String()
+		if strings.Contains(f.Name, "token") || strings.Contains(f.Name, "secret") {
+			value = "***"
+		}
+		target = append(target, "--"+f.Name+"="+value)
+	})
+
+	actor, ip := operator()
+	a := &cliAudit{entry: &models.AdminAudit{
+		Actor:  actor,
+		Source: models.AuditCLI,
+		IP:     ip,
+		Action: strings.TrimPrefix(cmd.CommandPath(), "panel "),
+		Target: strings.Join(target, " "),
+	}}
+	if load, ok := auditLoaders[cmd.Parent().Name()]; ok && len(args) > 0 {
+		a.load, a.name = load, args[0]
+		a.before = load(a.name)
+		if cmd.Name() == "rename" && len(args) > 1 {
+			a.name = args[1]
+		}
+	}
+	pendingAudit = a
+}
+
+// finishAudit records the command begun with beginAudit after it succeeded
+func finishAudit() {
+	a := pendingAudit
+	if a == nil {
+		return
+	}
+	pendingAudit = nil
+	var after any
+	if a.load != nil {
+		after = a.load(a.name)
+	}
+	audit.Record(database.DB, a.entry, a.before, after)
+}
+
+// operator names the OS user running the CLI, including who ran sudo, and
+// the IP address their SSH session comes from
+func operator() (actor, ip string) {
+	actor = "unknown"
+	if u, err := user.Current(); err == nil {
+		actor = u.Username
+	}
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" && sudoUser != actor {
+		actor = sudoUser + " (as " + actor + ")"
+	}
+	if fields := strings.Fields(os.Getenv("SSH_CLIENT")); len(fields) > 0 {
+		ip = fields[0]
+	}
+	return actor, ip
+}
+
+func init() {
+	auditCmd.Flags().String("actor", "", "Only show actions by this operator")
+	auditCmd.Flags().String("action", "", `Only show actions starting with this, e.g. "client" or "plan remove"`)
+	auditCmd.Flags().Duration("since", 0, "Only show actions from this long ago, e.g. 24h (0 for all)")
+	auditCmd.Flags().Int("limit", 50, "Number of entries to show (0 for all)")
+}
@@ -0,0 +1,246 @@
+package panel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/backup"
+	"github.com/libersuite-org/panel/database"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the panel database",
+	Long:  `Create, upload, and decrypt database backups.`,
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Snapshot the database and store or upload it",
+	Long: `Snapshot the database and write it to a file and/or upload it to Telegram or S3.
+
+With --passphrase-file the snapshot is encrypted (AES-256-GCM) before it is
+stored; restore it with "backup decrypt". Uploads require it unless
+--unencrypted is given. S3 credentials fall
+back to the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+
+Flags not given are read from the server config file, where each is named
+with a "backup-" prefix, e.g. backup-telegram-token. The server uploads a
+backup to the same destinations every day at --backup-time.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath, _ := cmd.Flags().GetString("config")
+		if err := applyBackupSettings(cmd, configPath); err != nil {
+			return err
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		destinations, err := backupDestinations(cmd.Flags(), "")
+		if err != nil {
+			return err
+		}
+		if output == "" && len(destinations) == 0 {
+			return fmt.Errorf("nothing to do: set --output or a Telegram/S3 destination")
+		}
+		// Files written locally may stay in the clear, uploads may not unless
+		// --unencrypted says so
+		var passphrase string
+		if passphraseFile, _ := cmd.Flags().GetString("passphrase-file"); len(destinations) > 0 {
+			passphrase, err = backupPassphrase(cmd.Flags(), "")
+		} else if passphraseFile != "" {
+			passphrase, err = readPassphrase(passphraseFile)
+		}
+		if err != nil {
+			return err
+		}
+
+		filename, data, err := backup.Create(database.DB, passphrase, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if output != "" {
+			if err := os.WriteFile(output, data, 0600); err != nil {
+				return fmt.Errorf("failed to write backup: %w", err)
+			}
+			fmt.Printf("✓ Backup written to %s\n", output)
+		}
+
+		var failed []string
+		for _, dest := range destinations {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			err := dest.Upload(ctx, filename, data)
+			cancel()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ Upload to %s failed: %v\n", dest.Name(), err)
+				failed = append(failed, dest.Name())
+				continue
+			}
+			fmt.Printf("✓ Backup %s uploaded to %s\n", filename, dest.Name())
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("backup upload failed for: %s", strings.Join(failed, ", "))
+		}
+		return nil
+	},
+}
+
+var backupDecryptCmd = &cobra.Command{
+	Use:   "decrypt [input] [output]",
+	Short: "Decrypt an encrypted backup",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphraseFile, _ := cmd.Flags().GetString("passphrase-file")
+		if passphraseFile == "" {
+			return fmt.Errorf("passphrase-file is required")
+		}
+
+		passphrase, err := readPassphrase(passphraseFile)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		plain, err := backup.Decrypt(data, passphrase)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(args[1], plain, 0600); err != nil {
+			return fmt.Errorf("failed to write database: %w", err)
+		}
+
+		fmt.Printf("✓ Decrypted backup written to %s\n", args[1])
+		return nil
+	},
+}
+
+// applyBackupSettings sets the backup create flags not given on the command
+// line from their backup- settings in the server config file. Settings only
+// the server uses, such as backup-time, are left to it.
+func applyBackupSettings(cmd *cobra.Command, configPath string) error {
+	settings, err := serverSettings(configPath)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range settings {
+		flagName, ok := strings.CutPrefix(name, backupSettingPrefix)
+		if !ok || flagName == "config" || flagName == "output" || cmd.Flags().Lookup(flagName) == nil {
+			continue
+		}
+		if cmd.Flags().Changed(flagName) {
+			continue
+		}
+		if err := cmd.Flags().Set(flagName, value); err != nil {
+			return fmt.Errorf("invalid value for '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// addBackupFlags registers the backup destination and encryption flags,
+// named with prefix, which the server and backup create share
+func addBackupFlags(flags *pflag.FlagSet, prefix string) {
+	flags.String(prefix+"passphrase-file", "", "File containing the backup encryption passphrase")
+	flags.Bool(prefix+"unencrypted", false, "Upload backups without encrypting them")
+	flags.String(prefix+"telegram-token", "", "Telegram bot token to send backups with")
+	flags.String(prefix+"telegram-chat", "", "Telegram chat ID to send backups to")
+	flags.String(prefix+"s3-endpoint", "https://s3.amazonaws.com", "S3-compatible endpoint URL for backups")
+	flags.String(prefix+"s3-region", "us-east-1", "S3 region for backups")
+	flags.String(prefix+"s3-bucket", "", "S3 bucket to upload backups to")
+	flags.String(prefix+"s3-prefix", "", "Key prefix for uploaded backups")
+	flags.String(prefix+"s3-access-key", "", "S3 access key for backups")
+	flags.String(prefix+"s3-secret-key", "", "S3 secret key for backups")
+}
+
+// backupDestinations returns the destinations set by the flags
+// addBackupFlags registered with prefix
+func backupDestinations(flags *pflag.FlagSet, prefix string) ([]backup.Destination, error) {
+	telegramToken, _ := flags.GetString(prefix + "telegram-token")
+	telegramChat, _ := flags.GetString(prefix + "telegram-chat")
+	s3Endpoint, _ := flags.GetString(prefix + "s3-endpoint")
+	s3Region, _ := flags.GetString(prefix + "s3-region")
+	s3Bucket, _ := flags.GetString(prefix + "s3-bucket")
+	s3Prefix, _ := flags.GetString(prefix + "s3-prefix")
+	s3AccessKey, _ := flags.GetString(prefix + "s3-access-key")
+	s3SecretKey, _ := flags.GetString(prefix + "s3-secret-key")
+
+	var destinations []backup.Destination
+	if telegramToken != "" || telegramChat != "" {
+		if telegramToken == "" || telegramChat == "" {
+			return nil, fmt.Errorf("%stelegram-token and %stelegram-chat must be set together", prefix, prefix)
+		}
+		destinations = append(destinations, &backup.Telegram{BotToken: telegramToken, ChatID: telegramChat})
+	}
+	if s3Bucket != "" {
+		if s3AccessKey == "" {
+			s3AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if s3SecretKey == "" {
+			s3SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		if s3AccessKey == "" || s3SecretKey == "" {
+			return nil, fmt.Errorf("S3 credentials are required when %ss3-bucket is set", prefix)
+		}
+		destinations = append(destinations, &backup.S3{
+			Endpoint:  s3Endpoint,
+			Region:    s3Region,
+			Bucket:    s3Bucket,
+			Prefix:    s3Prefix,
+			AccessKey: s3AccessKey,
+			SecretKey: s3SecretKey,
+		})
+	}
+	return destinations, nil
+}
+
+// backupPassphrase reads the passphrase backups are encrypted with, which
+// is required unless unencrypted backups were asked for
+func backupPassphrase(flags *pflag.FlagSet, prefix string) (string, error) {
+	passphraseFile, _ := flags.GetString(prefix + "passphrase-file")
+	unencrypted, _ := flags.GetBool(prefix + "unencrypted")
+	if passphraseFile == "" {
+		if !unencrypted {
+			return "", fmt.Errorf("%spassphrase-file is required to encrypt backups (or set %sunencrypted)", prefix, prefix)
+		}
+		return "", nil
+	}
+	if unencrypted {
+		return "", fmt.Errorf("%spassphrase-file and %sunencrypted cannot be used together", prefix, prefix)
+	}
+	return readPassphrase(passphraseFile)
+}
+
+func init() {
+	backupCreateCmd.Flags().String("config", "", "Server config file to read backup- settings from (default: panel.conf in the config directory)")
+	backupCreateCmd.Flags().String("output", "", "Write the backup to this file")
+	addBackupFlags(backupCreateCmd.Flags(), "")
+
+	backupDecryptCmd.Flags().String("passphrase-file", "", "File containing the encryption passphrase")
+
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupDecryptCmd)
+}
+
+func readPassphrase(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+
+	passphrase := strings.TrimSpace(string(data))
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file is empty")
+	}
+	return passphrase, nil
+}
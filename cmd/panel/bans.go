@@ -0,0 +1,77 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/spf13/cobra"
+)
+
+var bansCmd = &cobra.Command{
+	Use:   "bans",
+	Short: "Manage IPs banned for failed logins",
+	Long: `List and lift bans on source IPs with too many failed SSH/SOCKS logins.
+
+Bans are controlled by the server's --ban-threshold, --ban-window, and
+--ban-duration flags. Running servers pick up unbans within 30 seconds.`,
+}
+
+var bansListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List active bans",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var bans []models.Ban
+		if err := database.DB.Where("expires_at > ?", time.Now()).Order("expires_at").Find(&bans).Error; err != nil {
+			return fmt.Errorf("failed to retrieve bans: %w", err)
+		}
+
+		if len(bans) == 0 {
+			fmt.Println("No active bans")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "IP\tREASON\tFAILURES\tBANNED AT\tEXPIRES AT")
+		fmt.Fprintln(w, "--\t------\t--------\t---------\t----------")
+		for _, ban := range bans {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+				ban.IP,
+				ban.Reason,
+				ban.Failures,
+				ban.UpdatedAt.Format("2006-01-02 15:04"),
+				ban.ExpiresAt.Format("2006-01-02 15:04"),
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var bansUnbanCmd = &cobra.Command{
+	Use:   "unban [ip]",
+	Short: "Lift a ban",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip := args[0]
+
+		result := database.DB.Unscoped().Where("ip = ?", ip).Delete(&models.Ban{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to remove ban: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("ip '%s' is not banned", ip)
+		}
+
+		fmt.Printf("Ban on %s lifted successfully\n", ip)
+		return nil
+	},
+}
+
+func init() {
+	bansCmd.AddCommand(bansListCmd)
+	bansCmd.AddCommand(bansUnbanCmd)
+}
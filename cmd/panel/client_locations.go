@@ -0,0 +1,69 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/spf13/cobra"
+)
+
+var clientLocationsCmd = &cobra.Command{
+	Use:   "locations [username]",
+	Short: "List the countries and networks a client has logged in from",
+	Long: `List the source countries and networks (ASNs) recorded for a client by the
+server's --new-location-action. A login from one not listed is reported, and
+with "disable" the client is disabled until "client enable".
+
+--forget clears the list, so the next login sets a new baseline without
+being reported, e.g. after a client has moved.`,
+	Example: `  panel client locations alice
+  panel client locations alice --forget`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		username := args[0]
+		forget, _ := cmd.Flags().GetBool("forget")
+
+		var client models.Client
+		if err := database.DB.Where("username = ?", username).First(&client).Error; err != nil {
+			return fmt.Errorf("client '%s' not found", username)
+		}
+
+		if forget {
+			if err := database.DB.Where("client_id = ?", client.ID).Delete(&models.ClientLocation{}).Error; err != nil {
+				return fmt.Errorf("failed to forget locations: %w", err)
+			}
+			fmt.Printf("Locations of client '%s' forgotten successfully\n", username)
+			return nil
+		}
+
+		var rows []models.ClientLocation
+		if err := database.DB.Where("client_id = ?", client.ID).Order("kind, first_seen").Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to retrieve locations: %w", err)
+		}
+		if len(rows) == 0 {
+			fmt.Println("No locations recorded")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tLOCATION\tFIRST SEEN")
+		fmt.Fprintln(w, "----\t--------\t----------")
+		for _, r := range rows {
+			value := r.Value
+			if r.Kind == models.LocationASN {
+				value = "AS" + value
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Kind, value, r.FirstSeen.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+func init() {
+	clientLocationsCmd.Flags().Bool("forget", false, "Clear the recorded locations")
+	clientCmd.AddCommand(clientLocationsCmd)
+}
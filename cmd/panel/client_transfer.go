@@ -0,0 +1,309 @@
+package panel
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/crypto"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/units"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// clientRecord is the portable representation of a client used for migration
+type clientRecord struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	TrafficLimit int64  `json:"traffic_limit"`
+	TrafficUsed  int64  `json:"traffic_used"`
+	ExpiresAt    string `json:"expires_at,omitempty"` // RFC 3339, empty for never
+	ActivateDays int    `json:"activate_days,omitempty"`
+	Enabled      *bool  `json:"enabled"` // nil when not given, which enables the client
+}
+
+// enabled reports whether the record's client is enabled, which it is
+// unless the record says otherwise
+func (r *clientRecord) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+var clientRecordHeader = []string{"username", "password", "traffic_limit", "traffic_used", "expires_at", "activate_days", "enabled"}
+
+var clientExportAllCmd = &cobra.Command{
+	Use:   "export-all",
+	Short: "Export all clients as CSV or JSON",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		var clients []models.Client
+		if err := database.DB.Order("id").Find(&clients).Error; err != nil {
+			return fmt.Errorf("failed to retrieve clients: %w", err)
+		}
+
+		records := make([]clientRecord, 0, len(clients))
+		for _, c := range clients {
+			record := clientRecord{
+				Username:     c.Username,
+				Password:     c.Password,
+				TrafficLimit: c.TrafficLimit,
+				TrafficUsed:  c.TrafficUsed,
+				ActivateDays: c.ActivateDays,
+				Enabled:      &c.Enabled,
+			}
+			if !c.ExpiresAt.IsZero() {
+				record.ExpiresAt = c.ExpiresAt.Format(time.RFC3339)
+			}
+			records = append(records, record)
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch format {
+		case "json":
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(records)
+		case "csv":
+			cw := csv.NewWriter(w)
+			_ = cw.Write(clientRecordHeader)
+			for _, r := range records {
+				_ = cw.Write([]string{
+					r.Username,
+					r.Password,
+					strconv.FormatInt(r.TrafficLimit, 10),
+					strconv.FormatInt(r.TrafficUsed, 10),
+					r.ExpiresAt,
+					strconv.Itoa(r.ActivateDays),
+					strconv.FormatBool(r.enabled()),
+				})
+			}
+			cw.Flush()
+			return cw.Error()
+		default:
+			return fmt.Errorf("unsupported format '%s' (use csv or json)", format)
+		}
+	},
+}
+
+var clientImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import clients from a CSV or JSON file",
+	Long: `Import clients from a file produced by "client export-all" or another panel.
+
+Traffic values are in bytes unless they carry a unit such as 500MB, and
+expires_at is RFC 3339 (or a YYYY-MM-DD date).
+The format is taken from --format or the file extension. When a username already
+exists, --on-conflict decides whether to skip it, overwrite it, or abort the import.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		format, _ := cmd.Flags().GetString("format")
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+
+		if onConflict != "skip" && onConflict != "overwrite" && onConflict != "fail" {
+			return fmt.Errorf("invalid on-conflict value '%s' (use skip, overwrite, or fail)", onConflict)
+		}
+
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open import file: %w", err)
+		}
+		defer f.Close()
+
+		var records []clientRecord
+		switch format {
+		case "json":
+			if err := json.NewDecoder(f).Decode(&records); err != nil {
+				return fmt.Errorf("failed to parse JSON: %w", err)
+			}
+		case "csv":
+			records, err = readClientCSV(f)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported format '%s' (use csv or json)", format)
+		}
+
+		var created, updated, skipped int
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			for i, r := range records {
+				if r.Username == "" || r.Password == "" {
+					return fmt.Errorf("record %d: username and password are required", i+1)
+				}
+
+				expiresAt, err := parseExpiry(r.ExpiresAt)
+				if err != nil {
+					return fmt.Errorf("record %d: %w", i+1, err)
+				}
+
+				var client models.Client
+				err = tx.Where("username = ?", r.Username).First(&client).Error
+				exists := err == nil
+				if err != nil && err != gorm.ErrRecordNotFound {
+					return fmt.Errorf("failed to look up client '%s': %w", r.Username, err)
+				}
+
+				if exists {
+					switch onConflict {
+					case "skip":
+						skipped++
+						continue
+					case "fail":
+						return fmt.Errorf("client '%s' already exists", r.Username)
+					}
+				} else {
+					subToken, err := crypto.RandomToken(16)
+					if err != nil {
+						return err
+					}
+					client.SubToken = subToken
+				}
+
+				client.Username = r.Username
+				client.Password = r.Password
+				client.TrafficLimit = r.TrafficLimit
+				client.TrafficUsed = r.TrafficUsed
+				client.ExpiresAt = expiresAt
+				client.ActivateDays = r.ActivateDays
+				client.Enabled = r.enabled()
+
+				if err := tx.Save(&client).Error; err != nil {
+					return fmt.Errorf("failed to save client '%s': %w", r.Username, err)
+				}
+				// Create falls back to the column default for a false bool
+				if !exists && !r.enabled() {
+					if err := tx.Model(&client).Update("enabled", false).Error; err != nil {
+						return fmt.Errorf("failed to save client '%s': %w", r.Username, err)
+					}
+				}
+
+				if exists {
+					updated++
+				} else {
+					created++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Import complete: %d created, %d updated, %d skipped\n", created, updated, skipped)
+		return nil
+	},
+}
+
+func init() {
+	clientExportAllCmd.Flags().String("format", "csv", "Output format (csv or json)")
+	clientExportAllCmd.Flags().String("output", "", "Write to a file instead of stdout")
+
+	clientImportCmd.Flags().String("format", "", "Input format (csv or json, defaults to the file extension)")
+	clientImportCmd.Flags().String("on-conflict", "skip", "What to do with existing usernames (skip, overwrite, or fail)")
+
+	clientCmd.AddCommand(clientExportAllCmd)
+	clientCmd.AddCommand(clientImportCmd)
+}
+
+func readClientCSV(r io.Reader) ([]clientRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"username", "password"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the '%s' column", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	records := make([]clientRecord, 0, len(rows)-1)
+	for n, row := range rows[1:] {
+		record := clientRecord{
+			Username:  field(row, "username"),
+			Password:  field(row, "password"),
+			ExpiresAt: field(row, "expires_at"),
+		}
+
+		for name, dst := range map[string]*int64{"traffic_limit": &record.TrafficLimit, "traffic_used": &record.TrafficUsed} {
+			if v := field(row, name); v != "" {
+				parsed, err := units.ParseBytes(v, 1)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: invalid %s '%s'", n+2, name, v)
+				}
+				*dst = parsed
+			}
+		}
+
+		if v := field(row, "activate_days"); v != "" {
+			days, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid activate_days '%s'", n+2, v)
+			}
+			record.ActivateDays = days
+		}
+
+		if v := field(row, "enabled"); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid enabled '%s'", n+2, v)
+			}
+			record.Enabled = &enabled
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func parseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expires_at '%s'", value)
+}
@@ -0,0 +1,74 @@
+package panel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/units"
+	"github.com/spf13/cobra"
+)
+
+// usageBarWidth is the width of the longest bar in the usage chart
+const usageBarWidth = 40
+
+var clientUsageCmd = &cobra.Command{
+	Use:   "usage [username]",
+	Short: "Chart a client's daily traffic",
+	Long: `Chart a client's traffic per day, followed by its last login and total
+online time. The history is kept for 90 days and is not cleared by traffic
+resets, so it shows when a quota was used up. Activity on the running server
+shows up after its next usage flush.`,
+	Example: `  panel client usage alice --days 7`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		username := args[0]
+		days, _ := cmd.Flags().GetInt("days")
+		if days < 1 || days > 90 {
+			return fmt.Errorf("--days must be between 1 and 90")
+		}
+
+		var client models.Client
+		if err := database.DB.Where("username = ?", username).First(&client).Error; err != nil {
+			return fmt.Errorf("client '%s' not found", username)
+		}
+
+		history, err := models.TrafficHistory(database.DB, client.ID, days, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve traffic history: %w", err)
+		}
+
+		var peak, total int64
+		for _, day := range history {
+			peak = max(peak, day.Bytes)
+			total += day.Bytes
+		}
+
+		for _, day := range history {
+			bar := ""
+			if peak > 0 {
+				bar = strings.Repeat("█", int(day.Bytes*usageBarWidth/peak))
+				if bar == "" && day.Bytes > 0 {
+					bar = "▏"
+				}
+			}
+			fmt.Printf("%s  %-*s  %s\n", day.Day, usageBarWidth, bar, units.FormatBytes(day.Bytes))
+		}
+		fmt.Printf("\nTotal over %d days: %s\n", days, units.FormatBytes(total))
+
+		lastSeen := "Never"
+		if !client.LastConnection.IsZero() {
+			lastSeen = client.LastConnection.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("Last seen:  %s\n", lastSeen)
+		fmt.Printf("Online for: %s\n", time.Duration(client.OnlineSeconds)*time.Second)
+		return nil
+	},
+}
+
+func init() {
+	clientUsageCmd.Flags().Int("days", 30, "Number of days to show, up to 90")
+	clientCmd.AddCommand(clientUsageCmd)
+}
@@ -0,0 +1,136 @@
+package panel
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// backupSettingPrefix names the server's backup settings, which 'backup
+// create' also reads in place of its own flags
+const backupSettingPrefix = "backup-"
+
+// defaultConfigPath is the server config file read unless --config is given
+func defaultConfigPath() string {
+	return filepath.Join(configDir, "panel.conf")
+}
+
+// readConfigFile parses a server config file: one "flag = value" per line,
+// keyed by server flag names, with blank lines and '#' comments ignored
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected 'flag = value'", path, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// commandLineFlags returns the names of the flags given on the command line
+func commandLineFlags(cmd *cobra.Command) map[string]bool {
+	names := make(map[string]bool)
+	cmd.Flags().Visit(func(f *pflag.Flag) { names[f.Name] = true })
+	return names
+}
+
+// applyConfigFile sets every flag named in the config file that is not in
+// cmdline, so command-line flags always override the file. Flags the file no
+// longer names go back to their defaults, which lets a running server re-apply
+// an edited file. A missing default config file is not an error.
+func applyConfigFile(cmd *cobra.Command, path string, cmdline map[string]bool) error {
+	values, err := serverSettings(path)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = defaultConfigPath()
+	}
+
+	for name := range values {
+		if flag := cmd.Flags().Lookup(name); flag == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting '%s'", path, name)
+		}
+	}
+
+	var setErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if setErr != nil || cmdline[f.Name] || f.Name == "config" {
+			return
+		}
+		value, ok := values[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+		if value == f.Value.String() {
+			return
+		}
+		if err := cmd.Flags().Set(f.Name, value); err != nil {
+			setErr = fmt.Errorf("%s: invalid value for '%s': %w", path, f.Name, err)
+		}
+	})
+	return setErr
+}
+
+// serverSettings reads the server config file for commands that default to
+// the server's settings. A missing default config file yields no settings.
+func serverSettings(path string) (map[string]string, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		if !explicit && os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
+
+// writeConfigFile writes values in the format readConfigFile parses
+func writeConfigFile(path string, values map[string]string) error {
+	var b strings.Builder
+	b.WriteString("# LiberSuite panel server settings, one 'flag = value' per line.\n")
+	b.WriteString("# Any 'panel server' flag may be set here; command-line flags take precedence.\n")
+	b.WriteString("# 'panel backup create' reads the backup- settings too.\n\n")
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(&b, "%s = %s\n", key, strconv.Quote(values[key]))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// The file may hold the API token, so keep it private
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
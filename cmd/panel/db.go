@@ -0,0 +1,116 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database schema",
+	Long: `Inspect and apply versioned schema migrations.
+
+Every other command applies pending migrations when it opens the database, so
+"db migrate" is only needed to upgrade the schema ahead of time. Before
+downgrading the panel, roll back the migrations the older version does not
+know with "db rollback" using the newer binary. Take a backup first.`,
+	// Opened without migrating so status and rollback see the schema as is
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+		return database.Open(dbPath)
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ran, err := database.Migrate(database.DB)
+		for _, m := range ran {
+			fmt.Printf("Applied %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(ran) == 0 {
+			fmt.Println("Database schema is up to date")
+			return nil
+		}
+		fmt.Printf("%d migration(s) applied successfully\n", len(ran))
+		return nil
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		states, err := database.MigrationStatus(database.DB)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		fmt.Fprintln(w, "-------\t----\t----------")
+		pending := 0
+		for _, st := range states {
+			appliedAt := "pending"
+			if !st.Pending() {
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			} else {
+				pending++
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+		}
+		w.Flush()
+
+		if pending > 0 {
+			fmt.Printf("\n%d migration(s) pending, run 'panel db migrate' to apply them\n", pending)
+		}
+		return nil
+	},
+}
+
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Undo the latest applied migrations",
+	Long: `Undo the latest applied migrations, newest first. Stop the server first:
+any other panel command re-applies pending migrations when it starts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		if steps < 1 {
+			return fmt.Errorf("--steps must be at least 1")
+		}
+
+		undone, err := database.Rollback(database.DB, steps)
+		for _, m := range undone {
+			fmt.Printf("Rolled back %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(undone) == 0 {
+			fmt.Println("No applied migrations to roll back")
+			return nil
+		}
+		fmt.Printf("%d migration(s) rolled back successfully\n", len(undone))
+		return nil
+	},
+}
+
+func init() {
+	dbRollbackCmd.Flags().Int("steps", 1, "Number of migrations to undo")
+
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbRollbackCmd)
+}
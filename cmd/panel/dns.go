@@ -0,0 +1,177 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/dnsdispatcher"
+	"github.com/libersuite-org/panel/units"
+	"github.com/miekg/dns"
+	"github.com/spf13/cobra"
+)
+
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Manage the DNS dispatcher",
+}
+
+var dnsRecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Manage static DNS records",
+	Long: `Static records are answered by the DNS dispatcher itself, before queries
+are forwarded to a tunnel backend. Use them for the apex of the tunnel
+domains (A, NS, TXT) so delegation checks and ACME DNS-01 challenges work.
+
+Running servers pick up changes within 30 seconds.`,
+}
+
+var dnsRecordAddCmd = &cobra.Command{
+	Use:   "add [name] [type] [value]",
+	Short: "Add a static record",
+	Example: `  panel dns record add t.example.com A 203.0.113.10
+  panel dns record add _acme-challenge.t.example.com TXT gfj9Xq...Rg85nM`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ttl, _ := cmd.Flags().GetUint32("ttl")
+
+		record := models.DNSRecord{Name: args[0], Type: args[1], Value: args[2], TTL: ttl}
+		if _, err := dnsdispatcher.ParseRecord(&record); err != nil {
+			return err
+		}
+		if err := database.DB.Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to save record: %w", err)
+		}
+
+		fmt.Printf("Record %d added successfully\n", record.ID)
+		return nil
+	},
+}
+
+var dnsRecordListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List static records",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var records []models.DNSRecord
+		if err := database.DB.Order("name, type, id").Find(&records).Error; err != nil {
+			return fmt.Errorf("failed to retrieve records: %w", err)
+		}
+
+		if len(records) == 0 {
+			fmt.Println("No records found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tTTL\tVALUE")
+		fmt.Fprintln(w, "--\t----\t----\t---\t-----")
+		for _, record := range records {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", record.ID, record.Name, record.Type, record.TTL, record.Value)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var dnsRecordRemoveCmd = &cobra.Command{
+	Use:   "remove [id|name]",
+	Short: "Remove a record by ID, or every record of a name",
+	Example: `  panel dns record remove 3
+  panel dns record remove _acme-challenge.t.example.com --type TXT`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recordType, _ := cmd.Flags().GetString("type")
+
+		query := database.DB.Unscoped()
+		if id, err := strconv.ParseUint(args[0], 10, 64); err == nil {
+			query = query.Where("id = ?", id)
+		} else {
+			query = query.Where("name = ?", dns.Fqdn(strings.ToLower(args[0])))
+		}
+		if recordType != "" {
+			query = query.Where("type = ?", strings.ToUpper(recordType))
+		}
+
+		result := query.Delete(&models.DNSRecord{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to remove record: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("no record matches '%s'", args[0])
+		}
+
+		fmt.Printf("%d record(s) removed successfully\n", result.RowsAffected)
+		return nil
+	},
+}
+
+var dnsStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show per-domain DNS tunnel statistics of the running server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var stats []dnsdispatcher.DomainStats
+		if err := control.Get(controlSocketPath(), "/dns/stats", &stats); err != nil {
+			return err
+		}
+
+		if len(stats) == 0 {
+			fmt.Println("DNS dispatcher is not running")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DOMAIN\tBACKEND\tQUERIES\tERRORS\tERROR RATE\tTRUNCATED\tIN\tOUT\tAVG LATENCY\tMAX LATENCY\tLAST QUERY")
+		fmt.Fprintln(w, "------\t-------\t-------\t------\t----------\t---------\t--\t---\t-----------\t-----------\t----------")
+		for _, st := range stats {
+			errorRate := "-"
+			if st.Queries > 0 {
+				errorRate = fmt.Sprintf("%.1f%%", float64(st.Errors)*100/float64(st.Queries))
+			}
+			backends := make([]string, 0, len(st.Backends))
+			for _, b := range st.Backends {
+				if b.Healthy {
+					backends = append(backends, b.Addr)
+				} else {
+					backends = append(backends, b.Addr+" (down)")
+				}
+			}
+			lastQuery := "Never"
+			if !st.LastQueryAt.IsZero() {
+				lastQuery = st.LastQueryAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				st.Domain,
+				strings.Join(backends, ", "),
+				st.Queries,
+				st.Errors,
+				errorRate,
+				st.Truncated,
+				units.FormatBytes(st.BytesIn),
+				units.FormatBytes(st.BytesOut),
+				st.AvgLatency.Round(time.Microsecond),
+				st.MaxLatency.Round(time.Microsecond),
+				lastQuery,
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+func init() {
+	dnsRecordAddCmd.Flags().Uint32("ttl", dnsdispatcher.DefaultRecordTTL, "Record TTL in seconds")
+	dnsRecordRemoveCmd.Flags().String("type", "", "Only remove records of this type")
+
+	dnsRecordCmd.AddCommand(dnsRecordAddCmd)
+	dnsRecordCmd.AddCommand(dnsRecordListCmd)
+	dnsRecordCmd.AddCommand(dnsRecordRemoveCmd)
+
+	dnsCmd.AddCommand(dnsStatsCmd)
+	dnsCmd.AddCommand(dnsRecordCmd)
+}
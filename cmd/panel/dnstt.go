@@ -0,0 +1,150 @@
+package panel
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/crypto"
+	"github.com/spf13/cobra"
+)
+
+var dnsttCmd = &cobra.Command{
+	Use:   "dnstt",
+	Short: "Manage the dnstt tunnel",
+}
+
+var dnsttKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the dnstt server keypair",
+	Long: `Generate and show the dnstt server keypair.
+
+The private key is written in the format dnstt-server reads with
+-privkey-file. 'client export' and 'server' pick up the public key
+automatically when --pubkey / --dnstt-pubkey are not given.`,
+}
+
+var dnsttKeysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a new dnstt keypair",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyPath, _ := cmd.Flags().GetString("output")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if keyPath == "" {
+			keyPath = defaultDNSTTKeyPath()
+		}
+
+		if crypto.KeyExists(keyPath) && !force {
+			return fmt.Errorf("key already exists at %s. Use --force to overwrite", keyPath)
+		}
+
+		if err := crypto.GenerateDNSTTKeyPair(keyPath); err != nil {
+			return err
+		}
+		pubkey, err := crypto.DNSTTPubkey(keyPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Private key: %s\n", keyPath)
+		fmt.Printf("✓ Public key: %s.pub\n", keyPath)
+		fmt.Printf("✓ Pubkey: %s\n", pubkey)
+		if force {
+			fmt.Println("\nNote: Restart dnstt-server with the new key and re-export client links.")
+		}
+		return nil
+	},
+}
+
+var dnsttKeysShowCmd = &cobra.Command{
+	Use:     "show",
+	Short:   "Show the dnstt public key and the DNS delegation records",
+	Example: `  panel dnstt keys show --domain t.example.com --host 203.0.113.10`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyPath, _ := cmd.Flags().GetString("path")
+		domain, _ := cmd.Flags().GetString("domain")
+		host, _ := cmd.Flags().GetString("host")
+		nameserver, _ := cmd.Flags().GetString("nameserver")
+
+		if keyPath == "" {
+			keyPath = defaultDNSTTKeyPath()
+		}
+
+		pubkey, err := crypto.DNSTTPubkey(keyPath)
+		if err != nil {
+			return err
+		}
+		fmt.Println(pubkey)
+
+		if domain == "" {
+			return nil
+		}
+
+		return printDelegation(host, nameserver, domain)
+	},
+}
+
+// printDelegation prints the records that delegate each domain to this
+// server. nameserver defaults to <label>ns.<parent> per domain.
+func printDelegation(host, nameserver string, domains ...string) error {
+	if host == "" {
+		host = "<server IP>"
+	}
+	glue := "A"
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		glue = "AAAA"
+	}
+
+	fmt.Println("\nCreate these records at the DNS provider of the parent zone:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, domain := range domains {
+		domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+		ns := nameserver
+		if ns == "" {
+			label, parent, ok := strings.Cut(domain, ".")
+			if !ok {
+				return fmt.Errorf("domain '%s' must be a subdomain, e.g. t.example.com", domain)
+			}
+			ns = label + "ns." + parent
+		}
+		fmt.Fprintf(w, "  %s.\t%s\t%s\n", ns, glue, host)
+		fmt.Fprintf(w, "  %s.\tNS\t%s.\n", domain, ns)
+	}
+	w.Flush()
+	return nil
+}
+
+// defaultDNSTTKeyPath is where the dnstt private key lives unless overridden
+func defaultDNSTTKeyPath() string {
+	return filepath.Join(configDir, "dnstt.key")
+}
+
+// dnsttPubkeyFromKey reads the public key of the default dnstt keypair, or
+// of keyPath when set. It returns "" when no key has been generated.
+func dnsttPubkeyFromKey(keyPath string) (string, error) {
+	if keyPath == "" {
+		keyPath = defaultDNSTTKeyPath()
+		if !crypto.KeyExists(keyPath) {
+			return "", nil
+		}
+	}
+	return crypto.DNSTTPubkey(keyPath)
+}
+
+func init() {
+	dnsttKeysGenerateCmd.Flags().String("output", "", "Output path for the private key file")
+	dnsttKeysGenerateCmd.Flags().Bool("force", false, "Force overwrite if key already exists")
+
+	dnsttKeysShowCmd.Flags().String("path", "", "Path to the private key file")
+	dnsttKeysShowCmd.Flags().String("domain", "", "Tunnel domain to print delegation records for")
+	dnsttKeysShowCmd.Flags().String("host", "", "Public IP of this server for the nameserver A record")
+	dnsttKeysShowCmd.Flags().String("nameserver", "", "Nameserver host for the delegation (default: <label>ns.<parent>, e.g. tns.example.com)")
+
+	dnsttKeysCmd.AddCommand(dnsttKeysGenerateCmd)
+	dnsttKeysCmd.AddCommand(dnsttKeysShowCmd)
+	dnsttCmd.AddCommand(dnsttKeysCmd)
+}
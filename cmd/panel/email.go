@@ -0,0 +1,93 @@
+package panel
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/mailer"
+	"github.com/spf13/cobra"
+)
+
+var emailCmd = &cobra.Command{
+	Use:   "email",
+	Short: "Send email through the running server",
+	Long: `The server sends email through the SMTP server set with --smtp-host,
+--smtp-port, --smtp-username, --smtp-password, and --smtp-from, on the
+command line or in the config file:
+  - client credentials, with 'panel email credentials'
+  - expiry reminders to clients with an address (see 'client email'), along
+    with the --notify-expiry-within notification
+  - account events to the --notify-email addresses
+
+Messages are Go templates. Put credentials.tmpl, expiry.tmpl, or alert.tmpl
+in the --email-templates directory to replace the defaults. Each starts with
+a "Subject: ..." line, then a blank line and the body.
+
+Client templates (credentials, expiry) have the fields:
+  .Username .Password .SubURL .TrafficLimit .TrafficUsed .ExpiresAt .DaysLeft .Support
+The alert template has the fields:
+  .Type .Username .Message .Time .Details`,
+}
+
+var emailTestCmd = &cobra.Command{
+	Use:     "test [address]",
+	Short:   "Send a test email to check the SMTP settings",
+	Example: `  panel email test admin@example.com`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var result map[string]string
+		if err := control.PostForm(controlSocketPath(), "/email/test", url.Values{"to": {args[0]}}, &result); err != nil {
+			return err
+		}
+		fmt.Printf("Test email sent to %s\n", result["to"])
+		return nil
+	},
+}
+
+var emailCredentialsCmd = &cobra.Command{
+	Use:   "credentials [username]",
+	Short: "Email a client its login details and subscription link",
+	Example: `  panel email credentials alice
+  panel email credentials alice --to alice@example.com`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, _ := cmd.Flags().GetString("to")
+
+		var result map[string]string
+		form := url.Values{"username": {args[0]}, "to": {to}}
+		if err := control.PostForm(controlSocketPath(), "/email/credentials", form, &result); err != nil {
+			return err
+		}
+		fmt.Printf("Credentials of '%s' sent to %s\n", args[0], result["to"])
+		return nil
+	},
+}
+
+// emailCredentials mails a client's credentials to to, or to the client's
+// own address when to is empty
+func emailCredentials(mail *mailer.Mailer, username, to string) (any, error) {
+	var client models.Client
+	if err := database.DB.Where("username = ?", username).First(&client).Error; err != nil {
+		return nil, fmt.Errorf("client '%s' not found", username)
+	}
+	if to == "" {
+		to = client.Email
+	}
+	if to == "" {
+		return nil, fmt.Errorf("client '%s' has no email address; set one with 'panel client email' or pass --to", username)
+	}
+	if err := mail.SendTemplate([]string{to}, mailer.Credentials, mail.ClientData(&client)); err != nil {
+		return nil, err
+	}
+	return map[string]string{"to": to}, nil
+}
+
+func init() {
+	emailCredentialsCmd.Flags().String("to", "", "Address to send to instead of the client's own")
+
+	emailCmd.AddCommand(emailTestCmd)
+	emailCmd.AddCommand(emailCredentialsCmd)
+}
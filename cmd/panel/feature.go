@@ -0,0 +1,142 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/features"
+	"github.com/spf13/cobra"
+)
+
+var featureCmd = &cobra.Command{
+	Use:   "feature",
+	Short: "Manage feature rollout flags",
+	Long: `Enable new subsystems for a percentage of clients or a list of clients first.
+
+A flag applies to a client when it is enabled and the client is either listed
+in --clients or falls in the --percent cohort. Cohorts are stable: raising the
+percentage only adds clients. Running servers pick up changes within 30 seconds.`,
+}
+
+var featureSetCmd = &cobra.Command{
+	Use:   "set [name]",
+	Short: "Create or update a feature flag",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		var flag models.FeatureFlag
+		database.DB.Where("name = ?", name).First(&flag)
+		flag.Name = name
+
+		if cmd.Flags().Changed("enabled") || flag.ID == 0 {
+			flag.Enabled, _ = cmd.Flags().GetBool("enabled")
+		}
+		if cmd.Flags().Changed("percent") {
+			percent, _ := cmd.Flags().GetInt("percent")
+			if percent < 0 || percent > 100 {
+				return fmt.Errorf("percent must be between 0 and 100")
+			}
+			flag.Percent = percent
+		}
+		if cmd.Flags().Changed("clients") {
+			clients, _ := cmd.Flags().GetStringSlice("clients")
+			for i := range clients {
+				clients[i] = strings.TrimSpace(clients[i])
+			}
+			flag.Clients = strings.Join(clients, ",")
+		}
+
+		if err := database.DB.Save(&flag).Error; err != nil {
+			return fmt.Errorf("failed to save feature flag: %w", err)
+		}
+
+		fmt.Printf("Feature '%s' saved successfully\n", name)
+		return nil
+	},
+}
+
+var featureListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all feature flags",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var flags []models.FeatureFlag
+		if err := database.DB.Order("name").Find(&flags).Error; err != nil {
+			return fmt.Errorf("failed to retrieve feature flags: %w", err)
+		}
+
+		if len(flags) == 0 {
+			fmt.Println("No feature flags found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tENABLED\tPERCENT\tCLIENTS")
+		fmt.Fprintln(w, "----\t-------\t-------\t-------")
+		for _, flag := range flags {
+			clients := flag.Clients
+			if clients == "" {
+				clients = "-"
+			}
+			fmt.Fprintf(w, "%s\t%v\t%d%%\t%s\n", flag.Name, flag.Enabled, flag.Percent, clients)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var featureCheckCmd = &cobra.Command{
+	Use:   "check [name] [username]",
+	Short: "Show whether a feature applies to a client",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, username := args[0], args[1]
+
+		var flag models.FeatureFlag
+		if err := database.DB.Where("name = ?", name).First(&flag).Error; err != nil {
+			return fmt.Errorf("feature '%s' not found", name)
+		}
+
+		if flag.Enabled && features.Evaluate(flag, username) {
+			fmt.Printf("✓ Feature '%s' is on for '%s'\n", name, username)
+		} else {
+			fmt.Printf("✗ Feature '%s' is off for '%s'\n", name, username)
+		}
+		return nil
+	},
+}
+
+var featureRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a feature flag",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		result := database.DB.Unscoped().Where("name = ?", name).Delete(&models.FeatureFlag{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to remove feature flag: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("feature '%s' not found", name)
+		}
+
+		fmt.Printf("Feature '%s' removed successfully\n", name)
+		return nil
+	},
+}
+
+func init() {
+	featureSetCmd.Flags().Bool("enabled", true, "Turn the flag on or off")
+	featureSetCmd.Flags().Int("percent", 0, "Roll out to this percentage of clients (0-100)")
+	featureSetCmd.Flags().StringSlice("clients", nil, "Usernames that always get the feature (comma-separated)")
+
+	featureCmd.AddCommand(featureSetCmd)
+	featureCmd.AddCommand(featureListCmd)
+	featureCmd.AddCommand(featureCheckCmd)
+	featureCmd.AddCommand(featureRemoveCmd)
+}
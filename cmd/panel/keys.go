@@ -97,6 +97,27 @@ var checkKeyCmd = &cobra.Command{
 	},
 }
 
+var fingerprintKeyCmd = &cobra.Command{
+	Use:   "fingerprint",
+	Short: "Show the SSH host key fingerprint",
+	Long:  `Show the SHA256 fingerprint clients can use to verify the server's identity.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyPath, _ := cmd.Flags().GetString("path")
+
+		if keyPath == "" {
+			keyPath = filepath.Join(configDir, "id_rsa")
+		}
+
+		fingerprint, err := crypto.HostKeyFingerprint(keyPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(fingerprint)
+		return nil
+	},
+}
+
 func init() {
 	// Generate command flags
 	generateKeyCmd.Flags().String("output", "", "Output path for the key file")
@@ -110,8 +131,12 @@ func init() {
 	// Check command flags
 	checkKeyCmd.Flags().String("path", "", "Path to the key file")
 
+	// Fingerprint command flags
+	fingerprintKeyCmd.Flags().String("path", "", "Path to the key file")
+
 	// Add subcommands to keys command
 	keysCmd.AddCommand(generateKeyCmd)
 	keysCmd.AddCommand(regenerateKeyCmd)
 	keysCmd.AddCommand(checkKeyCmd)
+	keysCmd.AddCommand(fingerprintKeyCmd)
 }
@@ -0,0 +1,88 @@
+package panel
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/maintenance"
+	"github.com/spf13/cobra"
+)
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Drain the running server before an upgrade",
+	Long: `Turn maintenance mode of the running server on or off.
+
+While it is on, new SSH and SOCKS logins are refused and SSH clients are shown
+the message as the login banner. Connected sessions carry on until they
+disconnect, and the web server stays up. Watch "panel status" for the
+sessions to drain. Maintenance mode ends when turned off or when the server
+restarts.`,
+}
+
+var maintenanceOnCmd = &cobra.Command{
+	Use:     "on",
+	Short:   "Refuse new logins",
+	Example: `  panel maintenance on --message "Upgrading, back in 10 minutes"`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, _ := cmd.Flags().GetString("message")
+
+		state, err := setMaintenance(url.Values{"state": {"on"}, "message": {message}})
+		if err != nil {
+			return fmt.Errorf("failed to update maintenance mode: %w", err)
+		}
+		fmt.Printf("Maintenance mode turned on successfully\nMessage: %s\n", state.Message)
+		return nil
+	},
+}
+
+var maintenanceOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Accept logins again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := setMaintenance(url.Values{"state": {"off"}}); err != nil {
+			return fmt.Errorf("failed to update maintenance mode: %w", err)
+		}
+		fmt.Println("Maintenance mode turned off successfully")
+		return nil
+	},
+}
+
+var maintenanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether maintenance mode is on",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		state, err := setMaintenance(url.Values{})
+		if err != nil {
+			return fmt.Errorf("failed to get maintenance mode: %w", err)
+		}
+		if !state.On {
+			fmt.Println("Maintenance mode is off")
+			return nil
+		}
+		fmt.Printf("Maintenance mode is on since %s\nMessage: %s\n", state.Since.Format("2006-01-02 15:04:05"), state.Message)
+		return nil
+	},
+}
+
+func init() {
+	maintenanceOnCmd.Flags().String("message", "", "Message shown to SSH clients (default: \""+maintenance.DefaultMessage+"\")")
+
+	maintenanceCmd.AddCommand(maintenanceOnCmd)
+	maintenanceCmd.AddCommand(maintenanceOffCmd)
+	maintenanceCmd.AddCommand(maintenanceStatusCmd)
+}
+
+// setMaintenance sends form to the running server and returns the new state;
+// an empty form only reads it
+func setMaintenance(form url.Values) (*maintenance.State, error) {
+	var state maintenance.State
+	if err := control.PostForm(controlSocketPath(), "/maintenance", form, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
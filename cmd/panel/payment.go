@@ -0,0 +1,170 @@
+package panel
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/payments"
+	"github.com/spf13/cobra"
+)
+
+var paymentCmd = &cobra.Command{
+	Use:   "payment",
+	Short: "Manage plan payments",
+	Long: `Sell plans through payment gateways. Each payment is an order for a plan:
+once the gateway confirms it, the client is renewed on the plan (its
+remaining time is extended and its traffic reset), or created when it
+doesn't exist yet.
+
+Providers are configured on the server:
+  nowpayments  crypto invoices (--nowpayments-api-key, --nowpayments-ipn-secret)
+  webhook      any shop or bot that signs its callbacks (--payment-webhook-secret)
+
+Gateways call back to <--payments-url>/payments/<provider>/webhook, so the
+server needs --web-port and --payments-url. For the generic webhook, create
+the order here and hand its order ID to the shop, which posts
+{"order_id": "...", "status": "paid"} signed with the secret.`,
+}
+
+var paymentCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an order for a plan on the running server",
+	Long: `Create an order for a plan and, for providers with invoices, its payment
+page. Without --username a client with a random username and password is
+created once the order is paid; its subscription link is shown right away.`,
+	Example: `  panel payment create --provider nowpayments --plan Gold --amount 5 --currency usd
+  panel payment create --provider webhook --plan Gold --username alice --amount 5`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provider, _ := cmd.Flags().GetString("provider")
+		plan, _ := cmd.Flags().GetString("plan")
+		username, _ := cmd.Flags().GetString("username")
+		amount, _ := cmd.Flags().GetString("amount")
+		currency, _ := cmd.Flags().GetString("currency")
+
+		var payment models.Payment
+		form := url.Values{
+			"provider": {provider},
+			"plan":     {plan},
+			"username": {username},
+			"amount":   {amount},
+			"currency": {currency},
+		}
+		if err := control.PostForm(controlSocketPath(), "/payments/invoice", form, &payment); err != nil {
+			return err
+		}
+
+		fmt.Printf("Order %s created for '%s'\n", payment.OrderID, payment.Username)
+		if payment.PayURL != "" {
+			fmt.Printf("Payment page: %s\n", payment.PayURL)
+		}
+		if payment.SubToken != "" {
+			fmt.Printf("Subscription path (active once paid): /sub/%s\n", payment.SubToken)
+		}
+		return nil
+	},
+}
+
+var paymentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List payments",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, _ := cmd.Flags().GetString("status")
+		username, _ := cmd.Flags().GetString("username")
+
+		query := database.DB.Order("created_at DESC")
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if username != "" {
+			query = query.Where("username = ?", username)
+		}
+		var list []models.Payment
+		if err := query.Find(&list).Error; err != nil {
+			return fmt.Errorf("failed to list payments: %w", err)
+		}
+		if len(list) == 0 {
+			fmt.Println("No payments found")
+			return nil
+		}
+
+		plans := make(map[uint]string)
+		var planList []models.Plan
+		database.DB.Find(&planList)
+		for _, p := range planList {
+			plans[p.ID] = p.Name
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORDER\tPROVIDER\tCLIENT\tPLAN\tAMOUNT\tSTATUS\tCREATED\tPAID")
+		fmt.Fprintln(w, "-----\t--------\t------\t----\t------\t------\t-------\t----")
+		for _, p := range list {
+			plan, ok := plans[p.PlanID]
+			if !ok {
+				plan = "-"
+			}
+			paid := "-"
+			if !p.PaidAt.IsZero() {
+				paid = p.PaidAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s %s\t%s\t%s\t%s\n",
+				p.OrderID,
+				p.Provider,
+				p.Username,
+				plan,
+				p.Amount, p.Currency,
+				p.Status,
+				p.CreatedAt.Format("2006-01-02 15:04"),
+				paid,
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var paymentConfirmCmd = &cobra.Command{
+	Use:   "confirm [order]",
+	Short: "Mark an order paid and create or renew its client",
+	Long: `Mark an order paid by hand, e.g. after a bank transfer or a callback that
+never arrived, and create or renew its client as a gateway confirmation
+would. Confirming an order that is already paid changes nothing.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		payment, fulfilled, err := payments.Fulfill(database.DB, args[0])
+		if err != nil {
+			return err
+		}
+		if !fulfilled {
+			fmt.Printf("Order %s is already paid\n", payment.OrderID)
+			return nil
+		}
+		notifyClientsChanged()
+		fmt.Printf("Order %s paid, client '%s' is on its plan\n", payment.OrderID, payment.Username)
+		return nil
+	},
+}
+
+func init() {
+	paymentCreateCmd.Flags().String("provider", "", "Payment provider: nowpayments or webhook")
+	paymentCreateCmd.Flags().String("plan", "", "Plan to sell")
+	paymentCreateCmd.Flags().String("username", "", "Client to renew, or to create when it doesn't exist (random when empty)")
+	paymentCreateCmd.Flags().String("amount", "", "Price, e.g. 4.99")
+	paymentCreateCmd.Flags().String("currency", "USD", "Price currency")
+	paymentCreateCmd.MarkFlagRequired("provider")
+	paymentCreateCmd.MarkFlagRequired("plan")
+	paymentCreateCmd.MarkFlagRequired("amount")
+
+	paymentListCmd.Flags().String("status", "", "Only list payments with this status: pending, paid, or failed")
+	paymentListCmd.Flags().String("username", "", "Only list this client's payments")
+
+	paymentCmd.AddCommand(paymentCreateCmd)
+	paymentCmd.AddCommand(paymentListCmd)
+	paymentCmd.AddCommand(paymentConfirmCmd)
+}
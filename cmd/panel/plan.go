@@ -0,0 +1,329 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/units"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Manage client plans",
+	Long: `Define plans (traffic, duration, speed limit, max connections) and assign
+them with "client add --plan" or "client plan". Clients remember their plan,
+so "plan apply" rolls edited limits out to all of them.
+
+The speed limit covers all of a client's connections combined. Max
+connections counts concurrent SSH sessions, i.e. devices; SOCKS connections
+are not counted since one app opens many.
+
+The quota action decides what happens once a client runs out of traffic:
+"cut" (the default) closes its connections and refuses logins, "throttle"
+slows it to --quota-speed, and "allowlist" lets it reach only the
+--quota-allow domains and IPs, such as the renewal site. With a landing page
+configured on the server, allowlist clients are shown it everywhere else.
+
+--protocols limits the plan's clients to some entry protocols, e.g. "dns"
+to keep a cheap plan on the slower DNS tunnels.`,
+	PersistentPostRun: func(cmd *cobra.Command, args []string) { notifyClientsChanged() },
+}
+
+var planAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a plan",
+	Example: `  panel plan add Gold --traffic-limit 50 --duration 30 --speed-limit 20 --max-connections 2 --reset-day 1
+  panel plan add Unlimited --traffic-limit 100 --quota-action throttle --quota-speed 0.5
+  panel plan add Basic --traffic-limit 10 --quota-action allowlist --quota-allow shop.example.com
+  panel plan add Lite --traffic-limit 5 --protocols dns`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan := &models.Plan{Name: args[0]}
+		if err := setPlanFlags(cmd, plan); err != nil {
+			return err
+		}
+
+		if err := database.DB.Create(plan).Error; err != nil {
+			return fmt.Errorf("failed to create plan: %w", err)
+		}
+
+		fmt.Printf("Plan '%s' created successfully\n", plan.Name)
+		return nil
+	},
+}
+
+var planUpdateCmd = &cobra.Command{
+	Use:   "update [name]",
+	Short: "Change a plan's limits",
+	Long: `Change the limits given as flags and keep the rest. Clients on the plan
+keep their current limits until "plan apply" or --apply.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apply, _ := cmd.Flags().GetBool("apply")
+
+		plan, err := findPlan(args[0])
+		if err != nil {
+			return err
+		}
+		if err := setPlanFlags(cmd, plan); err != nil {
+			return err
+		}
+
+		if err := database.DB.Save(plan).Error; err != nil {
+			return fmt.Errorf("failed to update plan: %w", err)
+		}
+		fmt.Printf("Plan '%s' updated successfully\n", plan.Name)
+
+		if !apply {
+			fmt.Printf("Run 'panel plan apply %s' to roll the change out to its clients\n", plan.Name)
+			return nil
+		}
+		return applyPlan(plan)
+	},
+}
+
+var planApplyCmd = &cobra.Command{
+	Use:   "apply [name]",
+	Short: "Roll a plan's limits out to all clients on it",
+	Long: `Set traffic limit, speed limit, max connections, reset day, quota action, and
+allowed protocols of every client on the plan to the plan's values. Expiry dates and
+traffic used are not touched. Speed limits apply to new connections.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, err := findPlan(args[0])
+		if err != nil {
+			return err
+		}
+		return applyPlan(plan)
+	},
+}
+
+var planListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all plans",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var plans []models.Plan
+		if err := database.DB.Order("name").Find(&plans).Error; err != nil {
+			return fmt.Errorf("failed to retrieve plans: %w", err)
+		}
+
+		if len(plans) == 0 {
+			fmt.Println("No plans found")
+			return nil
+		}
+
+		var counts []struct {
+			PlanID uint
+			Count  int
+		}
+		database.DB.Model(&models.Client{}).Select("plan_id, count(*) as count").Where("plan_id <> 0").Group("plan_id").Scan(&counts)
+		clients := make(map[uint]int, len(counts))
+		for _, c := range counts {
+			clients[c.PlanID] = c.Count
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTRAFFIC\tDURATION\tSPEED\tMAX CONNECTIONS\tOVER QUOTA\tPROTOCOLS\tCLIENTS")
+		fmt.Fprintln(w, "----\t-------\t--------\t-----\t---------------\t----------\t---------\t-------")
+		for _, p := range plans {
+			traffic := "Unlimited"
+			if p.TrafficLimit > 0 {
+				traffic = units.FormatBytes(p.TrafficLimit)
+				if p.ResetDay > 0 {
+					traffic += "/month"
+				}
+			}
+			duration := "Never expires"
+			if p.DurationDays > 0 {
+				duration = fmt.Sprintf("%d days", p.DurationDays)
+			}
+			speed := "Unlimited"
+			if p.SpeedLimit > 0 {
+				speed = units.FormatRate(p.SpeedLimit)
+			}
+			maxConns := "Unlimited"
+			if p.MaxConnections > 0 {
+				maxConns = strconv.Itoa(p.MaxConnections)
+			}
+			overQuota := models.QuotaCut
+			switch p.QuotaAction {
+			case models.QuotaThrottle:
+				overQuota = "throttle to " + units.FormatRate(p.QuotaRate)
+			case models.QuotaAllowlist:
+				overQuota = "allow " + p.QuotaAllow
+			}
+			protocols := "All"
+			if p.Protocols != "" {
+				protocols = p.Protocols
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", p.Name, traffic, duration, speed, maxConns, overQuota, protocols, clients[p.ID])
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var planRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a plan",
+	Long:  `Remove a plan. Its clients keep their current limits and are no longer on a plan.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, err := findPlan(args[0])
+		if err != nil {
+			return err
+		}
+
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Client{}).Where("plan_id = ?", plan.ID).Update("plan_id", 0).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(plan).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove plan: %w", err)
+		}
+
+		fmt.Printf("Plan '%s' removed successfully\n", plan.Name)
+		return nil
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{planAddCmd, planUpdateCmd} {
+		cmd.Flags().String("traffic-limit", "0", "Traffic limit such as 500MB or 1.5TB, plain numbers are GB (0 for unlimited)")
+		cmd.Flags().Int("duration", 0, "Days a client stays valid after being put on the plan (0 for never)")
+		cmd.Flags().Float64("speed-limit", 0, "Speed limit in Mbit/s (0 for unlimited)")
+		cmd.Flags().Int("max-connections", 0, "Concurrent SSH sessions (0 for unlimited)")
+		cmd.Flags().Int("reset-day", 0, "Reset traffic used on this day of every month (0 for a one-shot quota)")
+		cmd.Flags().String("quota-action", models.QuotaCut, "What happens once a client runs out of traffic: cut, throttle, or allowlist")
+		cmd.Flags().Float64("quota-speed", 0, "Speed limit in Mbit/s once out of traffic, with --quota-action throttle")
+		cmd.Flags().String("quota-allow", "", "Domains and IPs still reachable once out of traffic, comma-separated, with --quota-action allowlist")
+		cmd.Flags().String("protocols", "all", "Entry protocols clients may log in over, comma-separated: ssh, socks, dns, quic, or all")
+	}
+	planUpdateCmd.Flags().Bool("apply", false, "Also roll the change out to the plan's clients")
+
+	planCmd.AddCommand(planAddCmd)
+	planCmd.AddCommand(planUpdateCmd)
+	planCmd.AddCommand(planApplyCmd)
+	planCmd.AddCommand(planListCmd)
+	planCmd.AddCommand(planRemoveCmd)
+}
+
+// setPlanFlags copies the limit flags given on the command line onto plan
+func setPlanFlags(cmd *cobra.Command, plan *models.Plan) error {
+	flags := cmd.Flags()
+	if flags.Changed("traffic-limit") {
+		text, _ := flags.GetString("traffic-limit")
+		limit, err := units.ParseBytes(text, units.GB)
+		if err != nil {
+			return fmt.Errorf("invalid --traffic-limit: %w", err)
+		}
+		plan.TrafficLimit = limit
+	}
+	if flags.Changed("duration") {
+		plan.DurationDays, _ = flags.GetInt("duration")
+	}
+	if flags.Changed("speed-limit") {
+		mbit, _ := flags.GetFloat64("speed-limit")
+		plan.SpeedLimit = int64(mbit * units.BytesPerMbit)
+	}
+	if flags.Changed("max-connections") {
+		plan.MaxConnections, _ = flags.GetInt("max-connections")
+	}
+	if flags.Changed("reset-day") {
+		plan.ResetDay, _ = flags.GetInt("reset-day")
+	}
+	if flags.Changed("quota-action") {
+		plan.QuotaAction, _ = flags.GetString("quota-action")
+	}
+	if flags.Changed("quota-speed") {
+		mbit, _ := flags.GetFloat64("quota-speed")
+		plan.QuotaRate = int64(mbit * units.BytesPerMbit)
+	}
+	if flags.Changed("quota-allow") {
+		allow, _ := flags.GetString("quota-allow")
+		plan.QuotaAllow = strings.Join(parseDomains(allow), ",")
+	}
+	if flags.Changed("protocols") {
+		text, _ := flags.GetString("protocols")
+		protocols, err := models.ParseProtocols(text)
+		if err != nil {
+			return fmt.Errorf("invalid --protocols: %w", err)
+		}
+		plan.Protocols = protocols
+	}
+
+	if plan.TrafficLimit < 0 || plan.DurationDays < 0 || plan.SpeedLimit < 0 || plan.MaxConnections < 0 {
+		return fmt.Errorf("plan limits cannot be negative")
+	}
+	if plan.ResetDay < 0 || plan.ResetDay > 31 {
+		return fmt.Errorf("--reset-day must be between 1 and 31")
+	}
+	switch plan.QuotaAction {
+	case "", models.QuotaCut:
+	case models.QuotaThrottle:
+		if plan.QuotaRate <= 0 {
+			return fmt.Errorf("--quota-action throttle needs a --quota-speed")
+		}
+	case models.QuotaAllowlist:
+		if plan.QuotaAllow == "" {
+			return fmt.Errorf("--quota-action allowlist needs --quota-allow")
+		}
+	default:
+		return fmt.Errorf("invalid --quota-action '%s' (expected cut, throttle, or allowlist)", plan.QuotaAction)
+	}
+	return nil
+}
+
+func findPlan(name string) (*models.Plan, error) {
+	var plan models.Plan
+	if err := database.DB.Where("name = ?", name).First(&plan).Error; err != nil {
+		return nil, fmt.Errorf("plan '%s' not found", name)
+	}
+	return &plan, nil
+}
+
+// applyPlan writes the plan's limits to every client on it
+func applyPlan(plan *models.Plan) error {
+	var limits models.Client
+	plan.ApplyTo(&limits)
+
+	var applied int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Clients becoming monthly start their first cycle now
+		if plan.ResetDay > 0 {
+			if err := tx.Model(&models.Client{}).Where("plan_id = ? AND reset_day = 0", plan.ID).
+				Update("last_reset_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&models.Client{}).Where("plan_id = ?", plan.ID).Updates(map[string]any{
+			"traffic_limit":   limits.TrafficLimit,
+			"speed_limit":     limits.SpeedLimit,
+			"max_connections": limits.MaxConnections,
+			"reset_day":       limits.ResetDay,
+			"quota_action":    limits.QuotaAction,
+			"quota_rate":      limits.QuotaRate,
+			"quota_allow":     limits.QuotaAllow,
+			"protocols":       limits.Protocols,
+		})
+		applied = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply plan: %w", err)
+	}
+
+	fmt.Printf("Plan '%s' applied to %d client(s) successfully\n", plan.Name, applied)
+	return nil
+}
@@ -0,0 +1,188 @@
+package panel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/dnsdispatcher"
+	"github.com/libersuite-org/panel/mixedserver"
+	"github.com/libersuite-org/panel/supervisor"
+	"github.com/libersuite-org/panel/transport"
+	"github.com/libersuite-org/panel/tunnel"
+	"github.com/spf13/cobra"
+)
+
+var relayCmd = &cobra.Command{
+	Use:   "relay",
+	Short: "Forward client connections to an upstream panel",
+	Long: `Run as a bridge in front of a panel server elsewhere: the mixed entrypoint
+passes every connection through to --upstream untouched, and with --dns-domain
+the DNS dispatcher forwards the tunnel domains to the upstream's DNS.
+
+Clients keep their own credentials and authenticate with the upstream, which
+sees every connection as coming from the relay. A relay holds no clients;
+static DNS records added with "panel dns" on the relay are still served.
+
+With --upstream-transport the hop to the upstream is obfuscated, so DPI
+between the two never sees SSH or SOCKS; run the upstream with the same
+--transport and key.
+
+To authenticate clients on this machine and only chain their traffic through
+another server, run "panel server --upstream" instead.`,
+	Example: `  panel relay --upstream exit.example.com:443 --port 443
+  panel relay --upstream exit.example.com:443 --dns-domain t.example.com
+  panel relay --upstream exit.example.com:443 --upstream-transport aead --upstream-transport-key 'long shared secret'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		upstream, _ := cmd.Flags().GetString("upstream")
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetInt("port")
+		probeTimeout, _ := cmd.Flags().GetDuration("mixed-probe-timeout")
+		dnsDomain, _ := cmd.Flags().GetString("dns-domain")
+		dnsUpstream, _ := cmd.Flags().GetString("dns-upstream")
+		dnsListen, _ := cmd.Flags().GetString("dns-listen")
+		dnsUnmatched, _ := cmd.Flags().GetString("dns-unmatched")
+		tcpKeepAlive, _ := cmd.Flags().GetDuration("tcp-keepalive")
+		maxTotalConns, _ := cmd.Flags().GetInt("max-total-connections")
+		shutdownGrace, _ := cmd.Flags().GetDuration("shutdown-grace")
+		transportName, _ := cmd.Flags().GetString("transport")
+		transportKey, _ := cmd.Flags().GetString("transport-key")
+		upstreamTransportName, _ := cmd.Flags().GetString("upstream-transport")
+		upstreamTransportKey, _ := cmd.Flags().GetString("upstream-transport-key")
+
+		upstreamHost, _, err := net.SplitHostPort(upstream)
+		if err != nil {
+			return fmt.Errorf("invalid upstream '%s': expected host:port", upstream)
+		}
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+		if maxTotalConns < 0 {
+			return fmt.Errorf("--max-total-connections cannot be negative")
+		}
+		if shutdownGrace < 0 {
+			return fmt.Errorf("--shutdown-grace cannot be negative")
+		}
+		clientTransport, err := transport.New(transportName, transportKey)
+		if err != nil {
+			return err
+		}
+		upstreamTransport, err := transport.New(upstreamTransportName, upstreamTransportKey)
+		if err != nil {
+			return fmt.Errorf("invalid --upstream-transport: %w", err)
+		}
+
+		// Every protocol goes to the upstream, which sorts them out itself
+		routes := make(map[string]string, len(mixedserver.DefaultRoutes))
+		for proto := range mixedserver.DefaultRoutes {
+			routes[proto] = upstream
+		}
+		mixedServer := mixedserver.New(&mixedserver.Config{
+			Hosts:        parseDomains(host),
+			Port:         port,
+			Routes:       routes,
+			ProbeTimeout: probeTimeout,
+			Timeouts:     &tunnel.Timeouts{KeepAlive: tcpKeepAlive},
+			Limits:       tunnel.NewLimits(maxTotalConns),
+			Transport:    clientTransport,
+			Upstream:     upstreamTransport,
+		})
+
+		var dnsDispatcher *dnsdispatcher.DnsDispatcher
+		dnsDomains := parseDomains(dnsDomain)
+		if len(dnsDomains) > 0 {
+			if dnsUpstream == "" {
+				dnsUpstream = net.JoinHostPort(upstreamHost, "53")
+			}
+			addrs := make([]string, len(dnsDomains))
+			for i := range addrs {
+				addrs[i] = dnsUpstream
+			}
+			dnsDispatcher, err = dnsdispatcher.NewDnsDispatcher(dnsDomains, addrs, &dnsdispatcher.Config{
+				DB:             database.DB,
+				Listen:         parseDomains(dnsListen),
+				HealthInterval: 10 * time.Second,
+				Unmatched:      dnsUnmatched,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create DNS dispatcher: %w", err)
+			}
+			if warning := dnsdispatcher.PrivilegeWarning(dnsDispatcher.ListenAddrs()); warning != "" {
+				log.Printf("Warning: %s", warning)
+			}
+		}
+
+		log.Printf("Relaying %s to %s", joinHosts(parseDomains(host), port), upstream)
+		if dnsDispatcher != nil {
+			log.Printf("Relaying DNS for %s to %s", strings.Join(dnsDomains, ", "), dnsUpstream)
+		}
+		log.Println("Press Ctrl+C to stop the relay")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		services := supervisor.New()
+		services.Add("mixed", mixedServer)
+		if dnsDispatcher != nil {
+			services.Add("dns", dnsDispatcher)
+		}
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- services.Run(ctx)
+		}()
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigChan)
+
+		select {
+		case sig := <-sigChan:
+			log.Printf("Received signal %v, draining connections for up to %s (signal again to close them now)...", sig, shutdownGrace)
+		case err := <-errChan:
+			return fmt.Errorf("relay crashed: %w", err)
+		}
+
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer drainCancel()
+		go func() {
+			select {
+			case sig := <-sigChan:
+				log.Printf("Received signal %v again, closing remaining connections", sig)
+				drainCancel()
+			case <-drainCtx.Done():
+			}
+		}()
+		drain(drainCtx, &statusReporter{mixed: mixedServer, services: services})
+
+		cancel()
+		<-errChan
+		log.Println("Relay stopped")
+		return nil
+	},
+}
+
+func init() {
+	relayCmd.Flags().String("upstream", "", "Mixed entrypoint of the upstream panel server (host:port)")
+	relayCmd.Flags().String("host", "0.0.0.0", "Address(es) to bind to, comma-separated")
+	relayCmd.Flags().Int("port", 2222, "Port clients connect to")
+	relayCmd.Flags().Duration("mixed-probe-timeout", 300*time.Millisecond, "How long to wait for a client to speak before passing the connection on silent")
+	relayCmd.Flags().String("dns-domain", "", "Tunnel domain(s) to relay to the upstream's DNS, comma-separated (DNS is off when empty)")
+	relayCmd.Flags().String("dns-upstream", "", "DNS server the tunnel domains are forwarded to (default: port 53 of the upstream host)")
+	relayCmd.Flags().String("dns-listen", dnsdispatcher.ListenAddr, "DNS listen address(es), comma-separated")
+	relayCmd.Flags().String("dns-unmatched", dnsdispatcher.UnmatchedDrop, "Reply to queries outside the tunnel domains and static records: drop, refused, or nxdomain")
+	relayCmd.Flags().Duration("tcp-keepalive", 0, "TCP keepalive period for client and upstream connections (0 for the system default, negative to disable)")
+	relayCmd.Flags().Int("max-total-connections", 0, "Maximum concurrent relayed connections (0 for unlimited)")
+	relayCmd.Flags().String("transport", "", "Obfuscation clients wrap their connections to the relay in: "+strings.Join(transport.Names(), ", ")+" (none when empty)")
+	relayCmd.Flags().String("transport-key", "", "Shared secret of --transport")
+	relayCmd.Flags().String("upstream-transport", "", "Obfuscation to wrap connections to the upstream in, matching its --transport")
+	relayCmd.Flags().String("upstream-transport-key", "", "Shared secret of --upstream-transport")
+	relayCmd.Flags().Duration("shutdown-grace", 60*time.Second, "How long to let open connections finish on shutdown before closing them")
+	relayCmd.MarkFlagRequired("upstream")
+}
@@ -0,0 +1,186 @@
+package panel
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/bans"
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/dnsdispatcher"
+	"github.com/libersuite-org/panel/features"
+	"github.com/libersuite-org/panel/webserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Re-read the config file of the running server",
+	Long: `Ask the running server to re-read its config file without dropping sessions.
+
+DNS domains and backends, ACL rules and local destination protection, ban
+limits, and the API token are applied in place. Listeners stay up and active
+SSH sessions are kept. Settings that need a restart, such as ports, are
+reported and left unchanged until the next start. Sending SIGHUP to the
+server does the same.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var result reloadResult
+		if err := control.Post(controlSocketPath(), "/reload", &result); err != nil {
+			return fmt.Errorf("failed to reload: %w", err)
+		}
+
+		if len(result.Applied) == 0 {
+			fmt.Println("✓ Config reloaded, no changes")
+		} else {
+			fmt.Println("✓ Config reloaded successfully")
+			for _, name := range result.Applied {
+				fmt.Printf("  applied: %s\n", name)
+			}
+		}
+		for _, name := range result.RestartRequired {
+			fmt.Printf("  restart required: %s\n", name)
+		}
+		return nil
+	},
+}
+
+// dnsDomainFlags are the server flags that set the DNS dispatcher's routes
+var dnsDomainFlags = []string{"dns-domain", "dnstt-addr", "slipstream-domain", "slipstream-addr"}
+
+// reloadable are the server flags a reload applies in place
+var reloadable = []string{
+	"dns-domain", "dnstt-addr", "slipstream-domain", "slipstream-addr",
+	"api-token", "allow-local-destinations",
+	"ban-threshold", "ban-window", "ban-duration",
+}
+
+type reloadResult struct {
+	Applied         []string `json:"applied"`          // settings that changed and were applied
+	RestartRequired []string `json:"restart_required"` // settings that changed but only apply on restart
+}
+
+// reloader re-applies the server config file to the running components
+type reloader struct {
+	mu         sync.Mutex
+	cmd        *cobra.Command
+	configPath string
+	cmdline    map[string]bool // flags given on the command line, never overridden
+	dns        *dnsdispatcher.DnsDispatcher
+	web        *webserver.Server
+	acl        *acl.Engine
+	bans       *bans.Guard
+	auth       *authcache.Cache
+	features   *features.Flags
+}
+
+func (r *reloader) reload() (*reloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flags := r.cmd.Flags()
+	before := make(map[string]string)
+	flags.VisitAll(func(f *pflag.Flag) { before[f.Name] = f.Value.String() })
+
+	if err := applyConfigFile(r.cmd, r.configPath, r.cmdline); err != nil {
+		r.restore(before)
+		return nil, err
+	}
+
+	result := &reloadResult{}
+	changed := make(map[string]bool)
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Value.String() == before[f.Name] {
+			return
+		}
+		changed[f.Name] = true
+		if r.canReload(f.Name) {
+			result.Applied = append(result.Applied, f.Name)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, f.Name)
+		}
+	})
+
+	if r.dns != nil && (changed["dns-domain"] || changed["dnstt-addr"] || changed["slipstream-domain"] || changed["slipstream-addr"]) {
+		if err := r.applyDomains(); err != nil {
+			r.restore(before)
+			return nil, err
+		}
+	}
+
+	if changed["api-token"] {
+		token, _ := flags.GetString("api-token")
+		r.web.SetAPIToken(token)
+	}
+
+	if changed["allow-local-destinations"] {
+		allowLocal, _ := flags.GetBool("allow-local-destinations")
+		r.acl.SetProtectLocal(!allowLocal)
+	}
+
+	if changed["ban-threshold"] || changed["ban-window"] || changed["ban-duration"] {
+		threshold, _ := flags.GetInt("ban-threshold")
+		window, _ := flags.GetDuration("ban-window")
+		duration, _ := flags.GetDuration("ban-duration")
+		r.bans.SetLimits(threshold, window, duration)
+	}
+
+	// Rules and records live in the database; pick up CLI edits right away
+	r.acl.Invalidate()
+	r.features.Invalidate()
+	r.auth.InvalidateAll()
+	r.dns.InvalidateRecords()
+
+	log.Printf("Config reloaded from %s (applied: %v, restart required: %v)", r.path(), result.Applied, result.RestartRequired)
+	return result, nil
+}
+
+// canReload reports whether a change to the named flag applies in place
+func (r *reloader) canReload(name string) bool {
+	if r.bans == nil && strings.HasPrefix(name, "ban-") {
+		// Banning was disabled at startup so there is no guard to update
+		return false
+	}
+	if r.dns == nil && slices.Contains(dnsDomainFlags, name) {
+		// Without domains at startup the DNS dispatcher was not started
+		return false
+	}
+	return slices.Contains(reloadable, name)
+}
+
+func (r *reloader) applyDomains() error {
+	flags := r.cmd.Flags()
+	dnsDomain, _ := flags.GetString("dns-domain")
+	dnsttAddr, _ := flags.GetString("dnstt-addr")
+	slipstreamDomain, _ := flags.GetString("slipstream-domain")
+	slipstreamAddr, _ := flags.GetString("slipstream-addr")
+
+	dnsDomains := parseDomains(dnsDomain)
+	slipstreamDomains := parseDomains(slipstreamDomain)
+
+	domains := append(dnsDomains, slipstreamDomains...)
+	addrs := append(parseDomains(dnsttAddr), parseDomains(slipstreamAddr)...)
+	if err := r.dns.SetRoutes(domains, addrs); err != nil {
+		return fmt.Errorf("invalid DNS domains: %w", err)
+	}
+	r.web.SetTunnelDomains(dnsDomains, slipstreamDomains)
+	return nil
+}
+
+// restore puts the flags back after a reload that could not be applied
+func (r *reloader) restore(values map[string]string) {
+	for name, value := range values {
+		_ = r.cmd.Flags().Set(name, value)
+	}
+}
+
+func (r *reloader) path() string {
+	if r.configPath == "" {
+		return defaultConfigPath()
+	}
+	return r.configPath
+}
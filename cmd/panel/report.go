@@ -0,0 +1,45 @@
+package panel
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/reports"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Show or send the operator report of the running server",
+	Long: `Show the summary the server sends operators with --report-schedule: new
+clients, clients expiring within 7 days, top consumers and total traffic
+over the last whole day or week, and failed logins since the last report
+was sent. With --send it is also delivered to the --report-email addresses
+and --report-telegram-chat chats, which starts the failed login count
+over.`,
+	Example: `  panel report
+  panel report --period weekly --send`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		period, _ := cmd.Flags().GetString("period")
+		send, _ := cmd.Flags().GetBool("send")
+
+		var report reports.Report
+		form := url.Values{"period": {period}, "send": {strconv.FormatBool(send)}}
+		if err := control.PostForm(controlSocketPath(), "/reports/run", form, &report); err != nil {
+			return err
+		}
+		fmt.Print(report.Text())
+		if send {
+			fmt.Println("\nReport sent")
+		}
+		return nil
+	},
+}
+
+func init() {
+	reportCmd.Flags().String("period", reports.Daily, "Period to report on: daily or weekly")
+	reportCmd.Flags().Bool("send", false, "Also deliver the report to its recipients")
+}
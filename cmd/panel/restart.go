@@ -0,0 +1,99 @@
+package panel
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var restartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart all managed services in dependency order",
+	Long: `Restart the panel and its tunnel backends (dnstt, slipstream) through systemd.
+
+The panel service is restarted first and its entrypoint port is probed before the
+tunnel backends, which forward into it, are restarted. Each unit must report active
+within the timeout or the restart stops with an error. Units that are not installed
+are skipped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		units, _ := cmd.Flags().GetStringSlice("units")
+		port, _ := cmd.Flags().GetInt("port")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			return fmt.Errorf("systemctl not found: %w", err)
+		}
+
+		for i, unit := range units {
+			if !unitInstalled(unit) {
+				fmt.Printf("- %s: not installed, skipping\n", unit)
+				continue
+			}
+
+			fmt.Printf("Restarting %s...\n", unit)
+			if out, err := exec.Command("systemctl", "restart", unit).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to restart %s: %v: %s", unit, err, strings.TrimSpace(string(out)))
+			}
+
+			if err := waitUnitActive(unit, timeout); err != nil {
+				return err
+			}
+
+			// The first unit is the panel itself; wait for its entrypoint before
+			// bringing up the backends that forward into it
+			if i == 0 && port > 0 {
+				if err := waitPortOpen(port, timeout); err != nil {
+					return fmt.Errorf("%s is active but not listening: %w", unit, err)
+				}
+			}
+
+			fmt.Printf("✓ %s is healthy\n", unit)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	restartCmd.Flags().StringSlice("units", []string{"libersuite", "dnstt", "slipstream"}, "Systemd units to restart, in order (panel first)")
+	restartCmd.Flags().Int("port", 2222, "Panel entrypoint port probed after restart (0 to skip)")
+	restartCmd.Flags().Duration("timeout", 15*time.Second, "How long to wait for each unit to become healthy")
+}
+
+func unitInstalled(unit string) bool {
+	out, err := exec.Command("systemctl", "list-unit-files", unit+".service", "--no-legend").Output()
+	return err == nil && strings.TrimSpace(string(out)) != ""
+}
+
+func waitUnitActive(unit string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if exec.Command("systemctl", "is-active", "--quiet", unit).Run() == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not become active within %s", unit, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func waitPortOpen(port int, timeout time.Duration) error {
+	addr := net.JoinHostPort("127.0.0.1", fmt.Sprintf("%d", port))
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("port %d not reachable within %s", port, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
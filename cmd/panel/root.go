@@ -10,9 +10,10 @@ import (
 )
 
 var (
-	dbPath    string
-	configDir string
-	rootCmd   *cobra.Command
+	dbPath        string
+	configDir     string
+	controlSocket string
+	rootCmd       *cobra.Command
 )
 
 func init() {
@@ -40,17 +41,52 @@ func init() {
 				fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
 				os.Exit(1)
 			}
+			beginAudit(cmd, args)
 		},
 	}
 
 	rootCmd.PersistentFlags().StringVar(&dbPath, "db", filepath.Join(configDir, "panel.db"), "Database file path")
+	rootCmd.PersistentFlags().StringVar(&controlSocket, "control-socket", "", "Control socket of the running server (default: panel.sock next to the database)")
 
 	// Add subcommands
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(clientCmd)
 	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(templateCmd)
+	rootCmd.AddCommand(restartCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(featureCmd)
+	rootCmd.AddCommand(aclCmd)
+	rootCmd.AddCommand(bansCmd)
+	rootCmd.AddCommand(dnsCmd)
+	rootCmd.AddCommand(dnsttCmd)
+	rootCmd.AddCommand(setupCmd)
+	rootCmd.AddCommand(reloadCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(apikeyCmd)
+	rootCmd.AddCommand(dbCmd)
+	rootCmd.AddCommand(maintenanceCmd)
+	rootCmd.AddCommand(relayCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(paymentCmd)
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(emailCmd)
+}
+
+// controlSocketPath returns the socket the server for this database listens on
+func controlSocketPath() string {
+	if controlSocket != "" {
+		return controlSocket
+	}
+	return filepath.Join(filepath.Dir(dbPath), "panel.sock")
 }
 
 func Execute() error {
-	return rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		return err
+	}
+	finishAudit()
+	return nil
 }
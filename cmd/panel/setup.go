@@ -0,0 +1,332 @@
+package panel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/libersuite-org/panel/crypto"
+	"github.com/spf13/cobra"
+)
+
+const systemdUnitPath = "/etc/systemd/system/libersuite.service"
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Interactively configure the server",
+	Long: `Walk through a first-time setup: tunnel domains, ports, and the API token.
+
+Setup generates the SSH host key and dnstt keypair, writes the server config
+file that 'panel server' reads, prints the DNS records that delegate each
+tunnel domain to this server, and optionally installs and starts the
+libersuite systemd unit. Press Enter to accept the default shown in brackets.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath, _ := cmd.Flags().GetString("config")
+		if configPath == "" {
+			configPath = defaultConfigPath()
+		}
+
+		p := &prompter{in: bufio.NewReader(os.Stdin)}
+
+		if _, err := os.Stat(configPath); err == nil {
+			if !p.yesNo(fmt.Sprintf("%s already exists. Overwrite it?", configPath), false) {
+				fmt.Println("Setup cancelled")
+				return nil
+			}
+		}
+
+		fmt.Println("\n== Server ==")
+		publicHost := p.text("Public IP or hostname of this server", "")
+		port := p.port("Mixed SSH/SOCKS entrypoint port", 2222)
+		sshPort := p.port("Internal SSH port", 2223)
+		socksPort := p.port("SOCKS5 port", 1080)
+		if err := checkUniquePorts(map[string]int{"port": port, "ssh-port": sshPort, "socks-port": socksPort}); err != nil {
+			return err
+		}
+
+		fmt.Println("\n== DNS tunnels ==")
+		dnsttDomains := parseDomains(p.text("dnstt domain(s), comma-separated (empty to skip)", ""))
+		var dnsttAddrs []string
+		if len(dnsttDomains) > 0 {
+			base := p.port("First dnstt-server port (one per domain)", 5300)
+			for i := range dnsttDomains {
+				dnsttAddrs = append(dnsttAddrs, fmt.Sprintf("127.0.0.1:%d", base+i))
+			}
+		}
+		slipstreamDomains := parseDomains(p.text("Slipstream domain(s), comma-separated (empty to skip)", ""))
+		var slipstreamAddrs []string
+		if len(slipstreamDomains) > 0 {
+			base := p.port("First slipstream-server port (one per domain)", 5400)
+			for i := range slipstreamDomains {
+				slipstreamAddrs = append(slipstreamAddrs, fmt.Sprintf("127.0.0.1:%d", base+i))
+			}
+		}
+
+		fmt.Println("\n== Web and API ==")
+		webPort := p.port("Web server port for subscriptions and the API (0 to disable)", 8080)
+		var apiToken string
+		if webPort != 0 {
+			apiToken = p.text("API token (empty to generate one)", "")
+			if apiToken == "" {
+				token, err := crypto.RandomToken(24)
+				if err != nil {
+					return err
+				}
+				apiToken = token
+			}
+		}
+
+		fmt.Println("\n== Backups ==")
+		backupValues, err := promptBackups(p)
+		if err != nil {
+			return err
+		}
+
+		values := map[string]string{
+			"port":       strconv.Itoa(port),
+			"ssh-port":   strconv.Itoa(sshPort),
+			"socks-port": strconv.Itoa(socksPort),
+			"host-key":   filepath.Join(configDir, "id_rsa"),
+		}
+		if publicHost != "" {
+			values["public-host"] = publicHost
+		}
+		if len(dnsttDomains) > 0 {
+			values["dns-domain"] = strings.Join(dnsttDomains, ",")
+			values["dnstt-addr"] = strings.Join(dnsttAddrs, ",")
+		}
+		if len(slipstreamDomains) > 0 {
+			values["slipstream-domain"] = strings.Join(slipstreamDomains, ",")
+			values["slipstream-addr"] = strings.Join(slipstreamAddrs, ",")
+		}
+		if webPort != 0 {
+			values["web-port"] = strconv.Itoa(webPort)
+			values["api-token"] = apiToken
+			if err := checkUniquePorts(map[string]int{"port": port, "ssh-port": sshPort, "socks-port": socksPort, "web-port": webPort}); err != nil {
+				return err
+			}
+		}
+
+		maps.Copy(values, backupValues)
+
+		fmt.Println("\n== Keys ==")
+		hostKey := values["host-key"]
+		if crypto.KeyExists(hostKey) {
+			fmt.Printf("✓ Using existing SSH host key %s\n", hostKey)
+		} else {
+			if err := crypto.GenerateRSAKeyPair(hostKey, 2048); err != nil {
+				return fmt.Errorf("failed to generate host key: %w", err)
+			}
+			fmt.Printf("✓ SSH host key generated at %s\n", hostKey)
+		}
+		if len(dnsttDomains) > 0 {
+			keyPath := defaultDNSTTKeyPath()
+			if !crypto.KeyExists(keyPath) {
+				if err := crypto.GenerateDNSTTKeyPair(keyPath); err != nil {
+					return err
+				}
+				fmt.Printf("✓ dnstt keypair generated at %s\n", keyPath)
+			} else {
+				fmt.Printf("✓ Using existing dnstt keypair %s\n", keyPath)
+			}
+			pubkey, err := crypto.DNSTTPubkey(keyPath)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  dnstt-server needs: -privkey-file %s (pubkey %s)\n", keyPath, pubkey)
+		}
+
+		if path := backupValues[backupSettingPrefix+"passphrase-file"]; path != "" {
+			if _, err := os.Stat(path); err == nil {
+				fmt.Printf("✓ Using existing backup passphrase %s\n", path)
+			} else {
+				passphrase, err := crypto.RandomToken(24)
+				if err != nil {
+					return err
+				}
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					return fmt.Errorf("failed to write backup passphrase: %w", err)
+				}
+				if err := os.WriteFile(path, []byte(passphrase+"\n"), 0600); err != nil {
+					return fmt.Errorf("failed to write backup passphrase: %w", err)
+				}
+				fmt.Printf("✓ Backup passphrase generated at %s; keep a copy off this server to restore backups\n", path)
+			}
+		}
+
+		if err := writeConfigFile(configPath, values); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+		fmt.Printf("\n✓ Config written to %s\n", configPath)
+		if apiToken != "" {
+			fmt.Printf("  API token: %s\n", apiToken)
+		}
+		if at := backupValues[backupSettingPrefix+"time"]; at != "" {
+			fmt.Printf("  Encrypted backups are uploaded every day at %s\n", at)
+		}
+
+		if domains := append(dnsttDomains, slipstreamDomains...); len(domains) > 0 {
+			if err := printDelegation(publicHost, "", domains...); err != nil {
+				return err
+			}
+		}
+
+		fmt.Println()
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			fmt.Printf("systemd not found. Start the server with:\n  panel server --db %s --config %s\n", dbPath, configPath)
+			return nil
+		}
+		if !p.yesNo("Install and start the libersuite systemd unit?", os.Geteuid() == 0) {
+			fmt.Printf("Start the server with:\n  panel server --db %s --config %s\n", dbPath, configPath)
+			return nil
+		}
+		return installSystemdUnit(configPath)
+	},
+}
+
+// promptBackups asks whether and where the server uploads nightly encrypted
+// backups and returns their settings, none when backups are skipped
+func promptBackups(p *prompter) (map[string]string, error) {
+	values := make(map[string]string)
+	if !p.yesNo("Upload an encrypted database backup every night?", false) {
+		return values, nil
+	}
+
+	at := p.text("Time of day to back up (HH:MM)", "03:00")
+	if _, err := parseTimeOfDay(at); err != nil {
+		return nil, fmt.Errorf("invalid backup time '%s': %w", at, err)
+	}
+	values[backupSettingPrefix+"time"] = at
+
+	if token := p.text("Telegram bot token to send backups with (empty to skip)", ""); token != "" {
+		chat := p.text("Telegram chat ID to send backups to", "")
+		if chat == "" {
+			return nil, fmt.Errorf("a Telegram chat ID is required to send backups")
+		}
+		values[backupSettingPrefix+"telegram-token"] = token
+		values[backupSettingPrefix+"telegram-chat"] = chat
+	}
+	if bucket := p.text("S3 bucket to upload backups to (empty to skip)", ""); bucket != "" {
+		values[backupSettingPrefix+"s3-bucket"] = bucket
+		values[backupSettingPrefix+"s3-endpoint"] = p.text("S3-compatible endpoint URL", "https://s3.amazonaws.com")
+		values[backupSettingPrefix+"s3-region"] = p.text("S3 region", "us-east-1")
+		accessKey := p.text("S3 access key", "")
+		secretKey := p.text("S3 secret key", "")
+		if accessKey == "" || secretKey == "" {
+			return nil, fmt.Errorf("S3 credentials are required to upload backups")
+		}
+		values[backupSettingPrefix+"s3-access-key"] = accessKey
+		values[backupSettingPrefix+"s3-secret-key"] = secretKey
+	}
+	if len(values) == 1 {
+		return nil, fmt.Errorf("nightly backups need a Telegram chat or an S3 bucket")
+	}
+
+	values[backupSettingPrefix+"passphrase-file"] = p.text("File holding the backup encryption passphrase (generated if missing)", filepath.Join(configDir, "backup.pass"))
+	return values, nil
+}
+
+func init() {
+	setupCmd.Flags().String("config", "", "Config file to write (default: panel.conf in the config directory)")
+}
+
+// installSystemdUnit writes a unit that runs this binary against the current
+// database and config file, then enables and starts it
+func installSystemdUnit(configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the panel binary: %w", err)
+	}
+	db, err := filepath.Abs(dbPath)
+	if err != nil {
+		return err
+	}
+	config, err := filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	unit := fmt.Sprintf(`[Unit]
+Description=Libersuite Panel
+After=network.target
+
+[Service]
+ExecStart=%s server --db %s --config %s
+Restart=always
+WorkingDirectory=%s
+
+[Install]
+WantedBy=multi-user.target
+`, exe, db, config, filepath.Dir(exe))
+
+	if err := os.WriteFile(systemdUnitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write systemd unit: %w", err)
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", "libersuite"}} {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	fmt.Printf("✓ Installed %s and started libersuite\n", systemdUnitPath)
+	return nil
+}
+
+// prompter reads answers to setup questions, falling back to the default
+// on an empty answer or end of input
+type prompter struct {
+	in *bufio.Reader
+}
+
+func (p *prompter) text(question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if err == io.EOF && line == "" {
+		fmt.Println()
+	}
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+func (p *prompter) port(question string, def int) int {
+	for {
+		answer := p.text(question, strconv.Itoa(def))
+		port, err := strconv.Atoi(answer)
+		if err == nil && port >= 0 && port <= 65535 {
+			return port
+		}
+		fmt.Printf("Invalid port '%s'\n", answer)
+	}
+}
+
+func (p *prompter) yesNo(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer := strings.ToLower(p.text(question+" ("+hint+")", ""))
+		switch answer {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package panel
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/accesslog"
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/sshserver"
+	"github.com/libersuite-org/panel/units"
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show statistics of the running server",
+}
+
+var statsDestinationsCmd = &cobra.Command{
+	Use:   "destinations",
+	Short: "Show the most connected tunnel destinations",
+	Long: `Show the destinations (host:port) clients open the most tunnel connections
+to, overall and per client, to spot abuse such as torrent trackers or spam
+relays. Denied counts connections refused by the ACL or the client's
+forwarding rules; failed counts allowed ones that could not connect.
+
+The server only counts destinations when started with --destination-stats,
+and with --destination-stats-hash it counts keyed hashes of the hosts. The
+counts are kept in memory and start over when the server restarts.`,
+	Example: `  panel stats destinations
+  panel stats destinations --client alice --top 50
+  panel stats destinations --all-clients --top 5`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		top, _ := cmd.Flags().GetInt("top")
+		clients, _ := cmd.Flags().GetStringSlice("client")
+		allClients, _ := cmd.Flags().GetBool("all-clients")
+
+		query := url.Values{"top": {strconv.Itoa(top)}}
+		if allClients {
+			query.Set("client", "")
+		} else {
+			query["client"] = clients
+		}
+
+		var report accesslog.StatsReport
+		if err := control.GetQuery(controlSocketPath(), "/stats/destinations", query, &report); err != nil {
+			return err
+		}
+		if report.Since.IsZero() {
+			fmt.Println("Destination statistics are off; start the server with --destination-stats")
+			return nil
+		}
+
+		fmt.Printf("Since %s\n", report.Since.Format("2006-01-02 15:04:05"))
+		if len(clients) == 0 || allClients {
+			fmt.Println("\nAll clients:")
+			printDestinations(report.Global)
+		}
+
+		names := make([]string, 0, len(report.Clients))
+		for name := range report.Clients {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			fmt.Printf("\n%s:\n", name)
+			printDestinations(report.Clients[name])
+		}
+		return nil
+	},
+}
+
+var statsSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Show the tunnels open in each SSH session",
+	Long: `Show the open SSH sessions with the number of tunnels (direct-tcpip
+channels) each has open, has opened since it started, and has had refused
+over --ssh-max-channels or the client's own limit. Apps that carry everything over one login can
+open thousands of tunnels; the sessions with the most open come first.
+
+--channels also lists each open tunnel with its destination and the bytes
+it has carried.`,
+	Example: `  panel stats sessions
+  panel stats sessions --client alice --channels`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, _ := cmd.Flags().GetString("client")
+		channels, _ := cmd.Flags().GetBool("channels")
+
+		query := url.Values{"client": {client}}
+		if channels {
+			query.Set("channels", "1")
+		}
+		var sessions []sshserver.SessionStats
+		if err := control.GetQuery(controlSocketPath(), "/ssh/sessions", query, &sessions); err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No SSH sessions")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tREMOTE ADDRESS\tOPEN\tOPENED\tREFUSED\tSTARTED AT\tSESSION")
+		fmt.Fprintln(w, "--------\t--------------\t----\t------\t-------\t----------\t-------")
+		for _, sess := range sessions {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%.12s\n",
+				sess.Username,
+				sess.RemoteAddr,
+				sess.OpenChannels,
+				sess.ChannelsOpened,
+				sess.ChannelsRejected,
+				sess.StartedAt.Format("2006-01-02 15:04:05"),
+				sess.SessionID,
+			)
+		}
+		w.Flush()
+
+		if !channels {
+			return nil
+		}
+		for _, sess := range sessions {
+			if len(sess.Channels) == 0 {
+				continue
+			}
+			fmt.Printf("\n%s (session %.12s):\n", sess.Username, sess.SessionID)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DESTINATION\tUPLOAD\tDOWNLOAD\tOPENED AT")
+			fmt.Fprintln(w, "-----------\t------\t--------\t---------")
+			for _, ch := range sess.Channels {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ch.Destination, units.FormatBytes(ch.Upload), units.FormatBytes(ch.Download), ch.OpenedAt.Format("2006-01-02 15:04:05"))
+			}
+			w.Flush()
+		}
+		return nil
+	},
+}
+
+func printDestinations(stats []accesslog.DestinationStats) {
+	if len(stats) == 0 {
+		fmt.Println("No connections")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DESTINATION\tCONNECTIONS\tDENIED\tFAILED\tLAST SEEN")
+	fmt.Fprintln(w, "-----------\t-----------\t------\t------\t---------")
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n",
+			st.Destination,
+			st.Connections,
+			st.Denied,
+			st.Failed,
+			st.LastSeen.Format("2006-01-02 15:04:05"),
+		)
+	}
+	w.Flush()
+}
+
+func init() {
+	statsDestinationsCmd.Flags().Int("top", 20, "Number of destinations to show per table (0 for all)")
+	statsDestinationsCmd.Flags().StringSlice("client", nil, "Show these clients' destinations instead of the overall ones, comma-separated")
+	statsDestinationsCmd.Flags().Bool("all-clients", false, "Also show every client's destinations")
+
+	statsSessionsCmd.Flags().String("client", "", "Show only this client's sessions")
+	statsSessionsCmd.Flags().Bool("channels", false, "Also list each session's open tunnels")
+
+	statsCmd.AddCommand(statsDestinationsCmd)
+	statsCmd.AddCommand(statsSessionsCmd)
+}
@@ -0,0 +1,242 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libersuite-org/panel/control"
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/dnsdispatcher"
+	"github.com/libersuite-org/panel/maintenance"
+	"github.com/libersuite-org/panel/mixedserver"
+	"github.com/libersuite-org/panel/quicserver"
+	"github.com/libersuite-org/panel/socksserver"
+	"github.com/libersuite-org/panel/sshserver"
+	"github.com/libersuite-org/panel/supervisor"
+	"github.com/libersuite-org/panel/tunnel"
+	"github.com/libersuite-org/panel/webserver"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the running server",
+	Long: `Show whether each subsystem of the running server is listening, how many
+sessions it holds, how often it failed and was restarted, database health,
+and uptime.
+
+The same health check backs the web server's unauthenticated /healthz
+endpoint, which answers 503 when a subsystem is down.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var status serverStatus
+		if err := control.Get(controlSocketPath(), "/status", &status); err != nil {
+			return fmt.Errorf("failed to get server status: %w", err)
+		}
+
+		fmt.Printf("Uptime:    %s (since %s)\n", status.Uptime.Truncate(time.Second), status.StartedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Database:  %s\n", status.Database)
+		if status.Maintenance.On {
+			fmt.Printf("Maintenance: on since %s, new logins are refused\n", status.Maintenance.Since.Format("2006-01-02 15:04:05"))
+		}
+		if status.Limit != nil {
+			fmt.Printf("Relayed:   %d of %d connections (%d refused)\n", status.Limit.Active, status.Limit.Max, status.Limit.Rejected)
+		}
+		if status.Dials != nil {
+			fmt.Printf("Dialing:   %d of %d (%d waiting, %d timed out waiting)\n", status.Dials.Active, status.Dials.Max, status.Dials.Waiting, status.Dials.Busy)
+		}
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tADDRESS\tSTATE\tSESSIONS\tRESTARTS")
+		fmt.Fprintln(w, "-------\t-------\t-----\t--------\t--------")
+		for _, svc := range status.Services {
+			addr, sessions, restarts := svc.Addr, "-", "-"
+			if addr == "" {
+				addr = "-"
+			}
+			if svc.Enabled {
+				if svc.Sessions >= 0 {
+					sessions = fmt.Sprintf("%d", svc.Sessions)
+				}
+				restarts = fmt.Sprintf("%d", svc.Restarts)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", svc.Name, addr, svc.State, sessions, restarts)
+		}
+		w.Flush()
+		for _, svc := range status.Services {
+			if svc.LastError != "" {
+				fmt.Printf("%s last failed at %s: %s\n", svc.Name, svc.LastErrorAt.Format("2006-01-02 15:04:05"), svc.LastError)
+			}
+		}
+
+		if err := status.healthy(); err != nil {
+			fmt.Printf("\n✗ Unhealthy: %v\n", err)
+		} else {
+			fmt.Println("\n✓ All enabled services are healthy")
+		}
+		return nil
+	},
+}
+
+type serviceStatus struct {
+	Name        string    `json:"name"`
+	Addr        string    `json:"addr"`
+	Enabled     bool      `json:"enabled"`
+	Listening   bool      `json:"listening"`
+	State       string    `json:"state"`    // disabled, listening, running, down, or a supervisor state
+	Sessions    int64     `json:"sessions"` // -1 when the service does not track sessions
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+type serverStatus struct {
+	StartedAt   time.Time         `json:"started_at"`
+	Uptime      time.Duration     `json:"uptime"`
+	Database    string            `json:"database"` // "ok" or the ping error
+	Services    []serviceStatus   `json:"services"`
+	Limit       *limitStatus      `json:"limit,omitempty"` // nil when connections are unlimited
+	Dials       *dialStatus       `json:"dials,omitempty"` // nil when dials are unlimited
+	Maintenance maintenance.State `json:"maintenance"`
+}
+
+type limitStatus struct {
+	Max      int64 `json:"max"`
+	Active   int64 `json:"active"`
+	Rejected int64 `json:"rejected"`
+}
+
+type dialStatus struct {
+	Max     int   `json:"max"`
+	Active  int   `json:"active"`
+	Waiting int64 `json:"waiting"`
+	Busy    int64 `json:"busy"`
+}
+
+// healthy returns why the server is unfit to serve, or nil
+func (st *serverStatus) healthy() error {
+	if st.Database != "ok" {
+		return fmt.Errorf("database: %s", st.Database)
+	}
+	for _, svc := range st.Services {
+		if !svc.Enabled || svc.State == stateListening || svc.State == supervisor.StateRunning {
+			continue
+		}
+		if svc.LastError != "" {
+			return fmt.Errorf("%s is %s: %s", svc.Name, svc.State, svc.LastError)
+		}
+		return fmt.Errorf("%s is %s", svc.Name, svc.State)
+	}
+	return nil
+}
+
+// Service states besides the supervisor's
+const (
+	stateDisabled  = "disabled"
+	stateListening = "listening"
+	stateDown      = "down"
+)
+
+// statusReporter collects the state of the running servers; nil servers
+// are reported as disabled
+type statusReporter struct {
+	startedAt time.Time
+	hosts     []string
+	internal  []string // bind addresses of the SSH and SOCKS backends
+	ports     map[string]int
+	dohAddr   string
+	ssh       *sshserver.Server
+	socks     *socksserver.Server
+	mixed     *mixedserver.Server
+	quic      *quicserver.Server
+	dns       *dnsdispatcher.DnsDispatcher
+	web       *webserver.Server
+	services  *supervisor.Supervisor
+	limits    *tunnel.Limits      // nil when connections are unlimited
+	dials     *tunnel.DialLimiter // nil when dials are unlimited
+	maint     *maintenance.Mode
+}
+
+func (r *statusReporter) status() *serverStatus {
+	st := &serverStatus{
+		StartedAt:   r.startedAt,
+		Uptime:      time.Since(r.startedAt),
+		Database:    "ok",
+		Maintenance: r.maint.State(),
+	}
+	if err := database.Ping(); err != nil {
+		st.Database = err.Error()
+	}
+	if r.limits != nil {
+		st.Limit = &limitStatus{Max: r.limits.Max(), Active: r.limits.Active(), Rejected: r.limits.Rejected()}
+	}
+	if r.dials != nil {
+		st.Dials = &dialStatus{Max: r.dials.Max(), Active: r.dials.Active(), Waiting: r.dials.Waiting(), Busy: r.dials.Busy()}
+	}
+
+	addr := func(name string) string { return joinHosts(r.hosts, r.ports[name]) }
+	internalAddr := func(name string) string {
+		if r.ports[name] == 0 {
+			return "in-process"
+		}
+		return joinHosts(r.internal, r.ports[name])
+	}
+	dnsAddr := strings.Join(r.dns.ListenAddrs(), ", ")
+	if r.dohAddr != "" {
+		dnsAddr += ", DoH " + r.dohAddr
+	}
+
+	st.Services = []serviceStatus{
+		{Name: "mixed", Addr: addr("port"), Enabled: r.mixed != nil, Listening: r.mixed.Listening(), Sessions: r.mixed.Connections()},
+		{Name: "quic", Addr: addr("quic-port"), Enabled: r.quic != nil, Listening: r.quic.Listening(), Sessions: r.quic.Connections()},
+		{Name: "ssh", Addr: internalAddr("ssh-port"), Enabled: r.ssh != nil, Listening: r.ssh.Listening(), Sessions: int64(r.ssh.Sessions())},
+		{Name: "socks", Addr: internalAddr("socks-port"), Enabled: r.socks != nil, Listening: r.socks.Listening(), Sessions: r.socks.Connections()},
+		{Name: "dns", Addr: dnsAddr, Enabled: r.dns != nil, Listening: r.dns.Listening(), Sessions: -1},
+		{Name: "web", Addr: addr("web-port"), Enabled: r.web != nil, Listening: r.web.Listening(), Sessions: -1},
+	}
+	listed := make(map[string]bool)
+	for i := range st.Services {
+		svc := &st.Services[i]
+		listed[svc.Name] = true
+		if !svc.Enabled {
+			svc.Addr = ""
+			svc.State = stateDisabled
+			continue
+		}
+		svc.State = stateDown
+		sup, ok := r.services.Lookup(svc.Name)
+		if ok {
+			svc.Restarts, svc.LastError, svc.LastErrorAt = sup.Restarts, sup.LastError, sup.LastErrorAt
+			if sup.State != supervisor.StateRunning {
+				svc.State = sup.State
+			}
+		}
+		if svc.Listening {
+			svc.State = stateListening
+		}
+	}
+	// Background services have no address or sessions, only a state
+	for _, sup := range r.services.Status() {
+		if listed[sup.Name] {
+			continue
+		}
+		st.Services = append(st.Services, serviceStatus{
+			Name:        sup.Name,
+			Enabled:     true,
+			State:       sup.State,
+			Sessions:    -1,
+			Restarts:    sup.Restarts,
+			LastError:   sup.LastError,
+			LastErrorAt: sup.LastErrorAt,
+		})
+	}
+	return st
+}
+
+// health backs the /healthz endpoint
+func (r *statusReporter) health() error {
+	return r.status().healthy()
+}
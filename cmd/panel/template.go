@@ -0,0 +1,126 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/export"
+	"github.com/spf13/cobra"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage client export templates",
+	Long: `Add, remove, and list Go text/template export formats used by "client export --template".
+
+Templates are executed against the client's export data. Available fields:
+  .Username .Password .Host .Port .Address .Token .Label .Domain .Domains .Pubkey
+  .Resolver .SSHURL .DNSTTURL .DNSTTURLs .QUICURL .SOCKSURL .HostKeyFingerprint
+  .TrafficLimit .TrafficUsed .ExpiresAt
+.Domain and .DNSTTURL are the first of .Domains and .DNSTTURLs, e.g.
+  {{range .DNSTTURLs}}{{.}}
+  {{end}}
+.Password is the client's token when the server takes tokens as SSH passwords.
+Available functions: base64, json, upper, lower.`,
+}
+
+var templateSetCmd = &cobra.Command{
+	Use:   "set [name] [file]",
+	Short: "Create or replace a template from a file",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		body, err := os.ReadFile(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to read template file: %w", err)
+		}
+
+		if _, err := export.Parse(name, string(body)); err != nil {
+			return err
+		}
+
+		var tmpl models.ExportTemplate
+		database.DB.Where("name = ?", name).First(&tmpl)
+		tmpl.Name = name
+		tmpl.Body = string(body)
+
+		if err := database.DB.Save(&tmpl).Error; err != nil {
+			return fmt.Errorf("failed to save template: %w", err)
+		}
+
+		fmt.Printf("Template '%s' saved successfully\n", name)
+		return nil
+	},
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all templates",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var templates []models.ExportTemplate
+		if err := database.DB.Order("name").Find(&templates).Error; err != nil {
+			return fmt.Errorf("failed to retrieve templates: %w", err)
+		}
+
+		if len(templates) == 0 {
+			fmt.Println("No templates found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tUPDATED AT")
+		fmt.Fprintln(w, "----\t----\t----------")
+		for _, tmpl := range templates {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", tmpl.Name, len(tmpl.Body), tmpl.UpdatedAt.Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var templateShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print a template body",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var tmpl models.ExportTemplate
+		if err := database.DB.Where("name = ?", args[0]).First(&tmpl).Error; err != nil {
+			return fmt.Errorf("template '%s' not found", args[0])
+		}
+
+		fmt.Print(tmpl.Body)
+		return nil
+	},
+}
+
+var templateRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		result := database.DB.Unscoped().Where("name = ?", name).Delete(&models.ExportTemplate{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to remove template: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("template '%s' not found", name)
+		}
+
+		fmt.Printf("Template '%s' removed successfully\n", name)
+		return nil
+	},
+}
+
+func init() {
+	templateCmd.AddCommand(templateSetCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateShowCmd)
+	templateCmd.AddCommand(templateRemoveCmd)
+}
@@ -0,0 +1,172 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Server answers CLI requests over a unix socket that only the panel's
+// user can reach, so commands like "dns stats" can query the running server
+type Server struct {
+	path   string
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func New(path string) *Server {
+	return &Server{path: path, mux: http.NewServeMux()}
+}
+
+// HandleJSON registers a GET route that responds with the JSON of fn()
+func (s *Server) HandleJSON(route string, fn func() any) {
+	s.mux.HandleFunc("GET "+route, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(fn())
+	})
+}
+
+// HandleQuery is HandleJSON for reports that take parameters, passing fn
+// the query values sent with GetQuery
+func (s *Server) HandleQuery(route string, fn func(query url.Values) any) {
+	s.mux.HandleFunc("GET "+route, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(fn(r.URL.Query()))
+	})
+}
+
+// HandleAction registers a POST route that runs fn and responds with the
+// JSON of its result, or with the error text when fn fails
+func (s *Server) HandleAction(route string, fn func() (any, error)) {
+	s.HandleForm(route, func(url.Values) (any, error) { return fn() })
+}
+
+// HandleForm is HandleAction for actions that take parameters, passing fn
+// the form values sent with PostForm
+func (s *Server) HandleForm(route string, fn func(form url.Values) (any, error)) {
+	s.mux.HandleFunc("POST "+route, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v, err := fn(r.PostForm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	})
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	// A socket left behind by a crashed server would make Listen fail
+	if conn, err := net.Dial("unix", s.path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("control socket %s is in use by another server", s.path)
+	}
+	_ = os.Remove(s.path)
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket %s: %w", s.path, err)
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to secure control socket: %w", err)
+	}
+
+	s.server = &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Control socket listening on %s", s.path)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.server.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	defer os.Remove(s.path)
+	return s.server.Shutdown(ctx)
+}
+
+// Get requests route from the server listening on socketPath and decodes
+// the JSON response into v
+func Get(socketPath, route string, v any) error {
+	return call(socketPath, http.MethodGet, route, nil, v)
+}
+
+// GetQuery is Get with query values for a HandleQuery route
+func GetQuery(socketPath, route string, query url.Values, v any) error {
+	if len(query) > 0 {
+		route += "?" + query.Encode()
+	}
+	return call(socketPath, http.MethodGet, route, nil, v)
+}
+
+// Post runs the action at route on the server listening on socketPath and
+// decodes the JSON response into v
+func Post(socketPath, route string, v any) error {
+	return call(socketPath, http.MethodPost, route, nil, v)
+}
+
+// PostForm is Post with form values for a HandleForm route
+func PostForm(socketPath, route string, form url.Values, v any) error {
+	return call(socketPath, http.MethodPost, route, form, v)
+}
+
+func call(socketPath, method, route string, form url.Values, v any) error {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, "http://panel"+route, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the running server at %s (is it running?): %w", socketPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GenerateDNSTTKeyPair creates a dnstt server keypair in the hex format
+// dnstt-server reads with -privkey-file and -pubkey-file
+func GenerateDNSTTKeyPair(keyPath string) error {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate dnstt key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(privateKey.Bytes())+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write private key file: %w", err)
+	}
+	if err := os.WriteFile(keyPath+".pub", []byte(hex.EncodeToString(privateKey.PublicKey().Bytes())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write public key file: %w", err)
+	}
+
+	return nil
+}
+
+// DNSTTPubkey returns the hex public key of the dnstt private key at keyPath
+func DNSTTPubkey(keyPath string) (string, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read dnstt key: %w", err)
+	}
+
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse dnstt key: %w", err)
+	}
+	privateKey, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse dnstt key: %w", err)
+	}
+
+	return hex.EncodeToString(privateKey.PublicKey().Bytes()), nil
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // GenerateRSAKeyPair generates a new RSA key pair and saves it to the specified path
@@ -116,3 +118,19 @@ func KeyExists(keyPath string) bool {
 	_, err := os.Stat(keyPath)
 	return err == nil
 }
+
+// HostKeyFingerprint returns the OpenSSH SHA256 fingerprint of the public half
+// of the private key at keyPath
+func HostKeyFingerprint(keyPath string) (string, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse key: %w", err)
+	}
+
+	return ssh.FingerprintSHA256(signer.PublicKey()), nil
+}
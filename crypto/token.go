@@ -0,0 +1,38 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// RandomToken returns a hex-encoded random token built from n random bytes
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Alphabets for RandomString. Look-alike characters (0/O, 1/l/I) are left
+// out since credentials are often read out or typed from a screenshot.
+const (
+	PasswordAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	UsernameAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+// RandomString returns n characters drawn uniformly from alphabet
+func RandomString(n int, alphabet string) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	out := make([]byte, n)
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random string: %w", err)
+		}
+		out[i] = alphabet[idx.Int64()]
+	}
+	return string(out), nil
+}
@@ -3,28 +3,58 @@ package database
 import (
 	"fmt"
 
-	"github.com/libersuite-org/panel/database/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// DB is the database of the panel's own commands. Packages meant to be
+// embedded take their *gorm.DB from their Config instead; see Connect.
 var DB *gorm.DB
 
-func Initialize(dbPath string) error {
+// Ping runs a trivial query to check the database is readable
+func Ping() error {
+	return DB.Exec("SELECT 1").Error
+}
+
+// Open connects to the database without touching its schema
+func Open(dbPath string) error {
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
+	DB, err = open(dbPath)
+	return err
+}
+
+// Initialize opens the database and applies pending migrations
+func Initialize(dbPath string) error {
+	db, err := Connect(dbPath)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return err
 	}
+	DB = db
+	return nil
+}
 
-	if err := DB.AutoMigrate(&models.Client{}); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+// Connect opens the database at dbPath and applies pending migrations,
+// returning it rather than setting DB, for programs that embed the panel
+func Connect(dbPath string) (*gorm.DB, error) {
+	db, err := open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
+	return db, nil
+}
 
-	return nil
+func open(dbPath string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
 }
 
 func Close() error {
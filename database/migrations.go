@@ -0,0 +1,356 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned schema change. Migrations run in order of
+// Version, each in its own transaction, and are recorded in the
+// schema_migrations table once applied. Released migrations must never be
+// edited; change the schema by appending a new one. Since the initial
+// migration creates tables from the current models, Up must tolerate finding
+// its change already made, e.g. by checking Migrator().HasColumn first.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil when the change cannot be undone
+}
+
+// Migrations is the schema history, oldest first
+var Migrations = []Migration{
+	{
+		// Databases created before versioned migrations already have these
+		// tables; AutoMigrate only adds what they lack
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Client{}, &models.ExportTemplate{}, &models.FeatureFlag{}, &models.ACLRule{}, &models.Ban{}, &models.DNSRecord{}, &models.Plan{}, &models.TrafficLog{}, &models.APIKey{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "client locations",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.ClientLocation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.ClientLocation{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "client outbound address",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.Client{}, "OutboundIP") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.Client{}, "OutboundIP")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Client{}, "OutboundIP")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "client upstream",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.Client{}, "Upstream") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.Client{}, "Upstream")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Client{}, "Upstream")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "quota actions",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Client{}, &models.Plan{}} {
+				for _, column := range quotaColumns {
+					if tx.Migrator().HasColumn(model, column) {
+						continue
+					}
+					if err := tx.Migrator().AddColumn(model, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Client{}, &models.Plan{}} {
+				for _, column := range quotaColumns {
+					if err := tx.Migrator().DropColumn(model, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "payments",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Payment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.Payment{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "admin audit",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.AdminAudit{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.AdminAudit{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "client email",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.Client{}, "Email") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.Client{}, "Email")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Client{}, "Email")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "allowed protocols",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Client{}, &models.Plan{}} {
+				if tx.Migrator().HasColumn(model, "Protocols") {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(model, "Protocols"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Client{}, &models.Plan{}} {
+				if err := tx.Migrator().DropColumn(model, "Protocols"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 10,
+		Name:    "client channel limit",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.Client{}, "MaxChannels") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.Client{}, "MaxChannels")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Client{}, "MaxChannels")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "client auth tokens",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&models.Client{}, "AuthToken") {
+				if err := tx.Migrator().AddColumn(&models.Client{}, "AuthToken"); err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&models.Client{}, "AuthToken") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&models.Client{}, "AuthToken")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&models.Client{}, "AuthToken"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.Client{}, "AuthToken")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "client token rotation",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range tokenColumns {
+				if tx.Migrator().HasColumn(&models.Client{}, column) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&models.Client{}, column); err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&models.Client{}, "PrevAuthToken") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&models.Client{}, "PrevAuthToken")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&models.Client{}, "PrevAuthToken"); err != nil {
+				return err
+			}
+			for _, column := range tokenColumns {
+				if err := tx.Migrator().DropColumn(&models.Client{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// quotaColumns are added to clients and plans by the quota actions migration
+var quotaColumns = []string{"QuotaAction", "QuotaRate", "QuotaAllow"}
+
+// tokenColumns are added to clients by the token rotation migration
+var tokenColumns = []string{"AuthTokenExpiresAt", "PrevAuthToken", "PrevAuthTokenUntil"}
+
+// schemaMigration records an applied migration
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationState is a migration and when it was applied, zero if pending
+type MigrationState struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Pending reports whether the migration has yet to be applied
+func (m MigrationState) Pending() bool {
+	return m.AppliedAt.IsZero()
+}
+
+func applied(db *gorm.DB) (map[int]schemaMigration, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	done := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// checkKnown fails when the database was migrated by a newer panel, whose
+// schema this one may not understand
+func checkKnown(done map[int]schemaMigration) error {
+	latest := Migrations[len(Migrations)-1].Version
+	for version := range done {
+		if version > latest {
+			return fmt.Errorf("database schema version %d is newer than this panel supports (%d); upgrade the panel, or roll back with the newer one", version, latest)
+		}
+	}
+	return nil
+}
+
+// Migrate applies every pending migration in order and returns the ones it
+// applied. It stops at the first failure, leaving that migration unapplied.
+func Migrate(db *gorm.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKnown(done); err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range Migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Rollback undoes the latest steps applied migrations, newest first, and
+// returns the ones it undid
+func Rollback(db *gorm.DB, steps int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKnown(done); err != nil {
+		return nil, err
+	}
+
+	var undone []Migration
+	for i := len(Migrations) - 1; i >= 0 && len(undone) < steps; i-- {
+		m := Migrations[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return undone, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{Version: m.Version}).Error
+		})
+		if err != nil {
+			return undone, fmt.Errorf("rolling back migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		undone = append(undone, m)
+	}
+	return undone, nil
+}
+
+// MigrationStatus lists every known migration with when it was applied
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(Migrations))
+	for _, m := range Migrations {
+		states = append(states, MigrationState{Version: m.Version, Name: m.Name, AppliedAt: done[m.Version].AppliedAt})
+		delete(done, m.Version)
+	}
+	// Applied by a newer panel
+	for _, row := range done {
+		states = append(states, MigrationState{Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// ACLRule allows or denies tunneled connections to a destination
+type ACLRule struct {
+	gorm.Model
+	ClientID uint   `gorm:"index;default:0"` // 0 applies the rule to every client
+	Action   string `gorm:"not null"`        // "allow" or "deny"
+	Target   string `gorm:"not null"`        // CIDR, IP, domain suffix, or "*"
+	Ports    string // e.g. "25,465,6000-7000", empty matches every port
+	Note     string
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognize
+const APIKeyPrefix = "lsk_"
+
+// APIScopes are the permissions an API key can be granted. "admin" grants
+// all of them.
+var APIScopes = []string{"clients:read", "clients:write", "acl:read", "acl:write", "stats:read", "audit:read", "admin"}
+
+// APIKey is a named bearer token for the REST API. Only a hash of the key is
+// stored; the key itself is shown once on creation.
+type APIKey struct {
+	gorm.Model
+	Name       string `gorm:"uniqueIndex;not null"`
+	Hash       string `gorm:"uniqueIndex;not null"` // hex SHA-256 of the key
+	Hint       string // first characters of the key, to tell keys apart
+	Scopes     string // comma-separated APIScopes
+	RateLimit  int    `gorm:"default:0"` // requests per minute, 0 means unlimited
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
+
+// HashAPIKey returns the stored form of an API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Allows reports whether the key grants scope
+func (k *APIKey) Allows(scope string) bool {
+	scopes := strings.Split(k.Scopes, ",")
+	return slices.Contains(scopes, scope) || slices.Contains(scopes, "admin")
+}
+
+// Revoked reports whether the key was revoked
+func (k *APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
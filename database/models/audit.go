@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Audit sources
+const (
+	AuditCLI = "cli"
+	AuditAPI = "api"
+)
+
+// AdminAudit records one change made by an operator through the CLI or the
+// web API, so panels shared by several operators can tell who did what
+type AdminAudit struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	Actor     string    `gorm:"index"` // OS user for the CLI, API key name for the API
+	Source    string    // one of the Audit* sources
+	IP        string    // where the actor connected from, empty for a local shell
+	Action    string    `gorm:"index"` // e.g. "client update" or "acl add"
+	Target    string    // arguments and flags of the action
+	Before    string    // JSON of the fields the action changed, empty when the object didn't exist
+	After     string    // JSON of the same fields afterwards, empty when the object is gone
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ban blocks a source IP after repeated failed logins
+type Ban struct {
+	gorm.Model
+	IP        string `gorm:"uniqueIndex;not null"`
+	Reason    string
+	Failures  int
+	ExpiresAt time.Time
+}
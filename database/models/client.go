@@ -1,8 +1,14 @@
 package models
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/libersuite-org/panel/clock"
 	"gorm.io/gorm"
 )
 
@@ -13,9 +19,137 @@ type Client struct {
 	Password       string    `gorm:"not null"`
 	TrafficLimit   int64     `gorm:"default:0"` // in bytes, 0 means unlimited
 	TrafficUsed    int64     `gorm:"default:0"` // in bytes
-	ExpiresAt      time.Time // expiration date
+	ExpiresAt      time.Time `gorm:"index"`     // expiration date
 	Enabled        bool      `gorm:"default:true"`
-	LastConnection time.Time
+	LastConnection time.Time `gorm:"index"`         // latest login, written in batches by the accountant
+	SubToken       string    `gorm:"index"`         // subscription link token
+	ActivateDays   int       `gorm:"default:0"`     // expiry in days counted from first login, 0 once activated
+	NotifiedExpiry bool      `gorm:"default:false"` // expiry warning sent for the current ExpiresAt
+	NotifiedQuota  bool      `gorm:"default:false"` // quota warning sent for the current usage cycle
+	Countries      string    // comma-separated source countries allowed for this client, empty uses the server policy
+	LockIP         bool      `gorm:"default:false"` // only accept logins from BoundIP
+	BoundIP        string    // first source IP seen while LockIP is set
+	ForwardPorts   string    // ports and ranges the client may forward to, empty allows all, "none" denies forwarding
+	AllowReverse   bool      `gorm:"default:false"` // may bind server ports with ssh -R
+	ResetDay       int       `gorm:"default:0"`     // day of month TrafficUsed resets on, 0 for a one-shot quota
+	LastResetAt    time.Time
+	PlanID         uint   `gorm:"index"`     // plan the limits came from, 0 for none
+	SpeedLimit     int64  `gorm:"default:0"` // bytes per second across all connections, 0 means unlimited
+	MaxConnections int    `gorm:"default:0"` // concurrent SSH sessions, 0 means unlimited
+	Notes          string // free-text admin notes
+	Tags           string // comma-separated labels, e.g. reseller1,vip
+	OnlineSeconds  int64  `gorm:"default:0"` // total time with at least one open connection
+	OutboundIP     string // source address for the client's outbound connections, empty uses the server default
+	Upstream       string // proxy URL the client's connections go through, "direct" for none, empty uses the server default
+	QuotaAction    string // one of the Quota* actions, copied from the plan; empty cuts
+	QuotaRate      int64  `gorm:"default:0"` // bytes per second once out of traffic with QuotaThrottle
+	QuotaAllow     string // comma-separated domains and IPs reachable once out of traffic with QuotaAllowlist
+	Email          string // where credentials and expiry reminders are sent, empty for none
+	Protocols      string // comma-separated Protocols the client may log in over, empty allows all
+	MaxChannels    int    `gorm:"default:0"` // tunnels one SSH session may have open at once, 0 uses the server default
+	AuthToken      string `gorm:"index"`     // logs in to SOCKS as the username with no password where token auth is on
+	// Token validity windows, see TokenValid
+	AuthTokenExpiresAt time.Time // AuthToken stops working after this, zero for never
+	PrevAuthToken      string    `gorm:"index"` // token replaced by the latest rotation
+	PrevAuthTokenUntil time.Time // PrevAuthToken stops working after this
+}
+
+// What happens to a client that runs out of traffic
+const (
+	QuotaCut       = "cut"       // close every connection and refuse logins
+	QuotaThrottle  = "throttle"  // carry on at QuotaRate
+	QuotaAllowlist = "allowlist" // reach only the QuotaAllow destinations, e.g. the renewal site
+)
+
+// Entry protocols a client can be limited to. Logins through a DNS tunnel
+// count as ProtocolDNS whichever protocol runs inside it.
+const (
+	ProtocolSSH   = "ssh"
+	ProtocolSOCKS = "socks"
+	ProtocolDNS   = "dns"  // dnstt and Slipstream
+	ProtocolQUIC  = "quic" // the QUIC listener
+)
+
+// Protocols lists the entry protocols in display order
+var Protocols = []string{ProtocolSSH, ProtocolSOCKS, ProtocolDNS, ProtocolQUIC}
+
+// ParseProtocols validates a comma-separated protocol list and returns it
+// normalized; "all" or an empty list allows every protocol and returns ""
+func ParseProtocols(s string) (string, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "all") {
+		return "", nil
+	}
+	given := make(map[string]bool)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if p == "dnstt" || p == "slipstream" {
+			p = ProtocolDNS
+		}
+		if !slices.Contains(Protocols, p) {
+			return "", fmt.Errorf("invalid protocol '%s' (expected %s, or all)", p, strings.Join(Protocols, ", "))
+		}
+		given[p] = true
+	}
+	if len(given) == len(Protocols) {
+		return "", nil
+	}
+	var allowed []string
+	for _, p := range Protocols {
+		if given[p] {
+			allowed = append(allowed, p)
+		}
+	}
+	return strings.Join(allowed, ","), nil
+}
+
+// AllowsProtocol reports whether the client may log in over protocol
+func (c *Client) AllowsProtocol(protocol string) bool {
+	return c.Protocols == "" || slices.Contains(strings.Split(c.Protocols, ","), protocol)
+}
+
+// SourceIP returns the client IP of addr, or "" for loopback sources such as
+// the DNS tunnels, which share one address and can't be locked to an IP
+func SourceIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsLoopback() {
+		return ""
+	}
+	return host
+}
+
+// EntryProtocol names the protocol a login from addr came in over: QUIC
+// streams keep their UDP source and the DNS tunnels hand their connections
+// over from loopback. Any other login came straight in over direct, the
+// protocol of the server it reached.
+func EntryProtocol(addr net.Addr, direct string) string {
+	if _, ok := addr.(*net.UDPAddr); ok {
+		return ProtocolQUIC
+	}
+	if SourceIP(addr) == "" {
+		return ProtocolDNS
+	}
+	return direct
+}
+
+// TokenValid reports whether token is the client's auth token, or the one
+// its latest rotation replaced, and still within its validity window
+func (c *Client) TokenValid(token string) bool {
+	now := clock.Now()
+	switch {
+	case token == "":
+		return false
+	case subtle.ConstantTimeCompare([]byte(token), []byte(c.AuthToken)) == 1:
+		return c.AuthTokenExpiresAt.IsZero() || now.Before(c.AuthTokenExpiresAt)
+	case subtle.ConstantTimeCompare([]byte(token), []byte(c.PrevAuthToken)) == 1:
+		return now.Before(c.PrevAuthTokenUntil)
+	}
+	return false
 }
 
 // IsExpired checks if the client's access has expired
@@ -23,7 +157,77 @@ func (c *Client) IsExpired() bool {
 	if c.ExpiresAt.IsZero() {
 		return false
 	}
-	return time.Now().After(c.ExpiresAt)
+	return clock.Now().After(c.ExpiresAt)
+}
+
+// Activate starts the expiry clock for a client created with start-on-first-use.
+// It reports whether the client changed and needs saving.
+func (c *Client) Activate(now time.Time) bool {
+	if c.ActivateDays == 0 || !c.ExpiresAt.IsZero() {
+		return false
+	}
+	c.ExpiresAt = now.AddDate(0, 0, c.ActivateDays)
+	c.ActivateDays = 0
+	return true
+}
+
+// CheckIP enforces IP locking for a login from ip, binding the client to ip
+// on its first locked login. It reports whether the login may proceed.
+func (c *Client) CheckIP(db *gorm.DB, ip string) (bool, error) {
+	if !c.LockIP || ip == "" {
+		return true, nil
+	}
+	if c.BoundIP != "" {
+		return c.BoundIP == ip, nil
+	}
+
+	// Bind atomically so two first logins from different IPs can't both win
+	result := db.Model(&Client{}).Where("id = ? AND (bound_ip = '' OR bound_ip IS NULL)", c.ID).Update("bound_ip", ip)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := db.Model(&Client{}).Where("id = ?", c.ID).Pluck("bound_ip", &c.BoundIP).Error; err != nil {
+			return false, err
+		}
+		return c.BoundIP == ip, nil
+	}
+
+	c.BoundIP = ip
+	return true, nil
+}
+
+// TrafficResetDue reports whether a monthly reset day has passed since the
+// last reset
+func (c *Client) TrafficResetDue(now time.Time) bool {
+	return c.ResetDay > 0 && c.LastResetAt.Before(c.lastResetBoundary(now))
+}
+
+// NextTrafficReset returns when TrafficUsed next resets, or the zero time
+// for a one-shot quota
+func (c *Client) NextTrafficReset(now time.Time) time.Time {
+	if c.ResetDay == 0 {
+		return time.Time{}
+	}
+	last := c.lastResetBoundary(now)
+	return resetDate(last.Year(), last.Month()+1, c.ResetDay, now.Location())
+}
+
+// lastResetBoundary returns the latest reset day at or before now
+func (c *Client) lastResetBoundary(now time.Time) time.Time {
+	boundary := resetDate(now.Year(), now.Month(), c.ResetDay, now.Location())
+	if boundary.After(now) {
+		boundary = resetDate(now.Year(), now.Month()-1, c.ResetDay, now.Location())
+	}
+	return boundary
+}
+
+// resetDate returns midnight on day of the given month, clamped to the
+// month's last day so a reset day of 31 still happens in February
+func resetDate(year int, month time.Month, day int, loc *time.Location) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, lastDay)-1)
 }
 
 // HasTrafficRemaining checks if the client has traffic quota remaining
@@ -39,6 +243,52 @@ func (c *Client) IsActive() bool {
 	return c.Enabled && !c.IsExpired() && c.HasTrafficRemaining()
 }
 
+// CanLogin reports whether the client may log in: it is active, or out of
+// traffic with a quota action that keeps it connected
+func (c *Client) CanLogin() bool {
+	if c.IsActive() {
+		return true
+	}
+	keeps := c.QuotaAction == QuotaThrottle || c.QuotaAction == QuotaAllowlist
+	return keeps && c.Enabled && !c.IsExpired()
+}
+
+// QuotaKeeps reports whether a connection to dest ("host:port", empty for
+// reverse forwards) carries on once the client is out of traffic: with
+// QuotaThrottle every one does, with QuotaAllowlist those to QuotaAllow
+func (c *Client) QuotaKeeps(dest string) bool {
+	switch c.QuotaAction {
+	case QuotaThrottle:
+		return true
+	case QuotaAllowlist:
+		host, _, err := net.SplitHostPort(dest)
+		if err != nil || host == "" {
+			return false
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		for _, allowed := range strings.Split(c.QuotaAllow, ",") {
+			allowed = strings.ToLower(strings.TrimSpace(allowed))
+			if allowed != "" && (host == allowed || strings.HasSuffix(host, "."+allowed)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Status names the client's state as one of ClientStatuses
+func (c *Client) Status() string {
+	switch {
+	case !c.Enabled:
+		return "disabled"
+	case c.IsExpired():
+		return "expired"
+	case !c.HasTrafficRemaining():
+		return "no-traffic"
+	}
+	return "active"
+}
+
 // RemainingTraffic returns the remaining traffic in bytes
 func (c *Client) RemainingTraffic() int64 {
 	if c.TrafficLimit == 0 {
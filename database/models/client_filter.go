@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/clock"
+	"gorm.io/gorm"
+)
+
+// ClientStatuses are the values ClientFilter.Status accepts, matching the
+// states IsActive distinguishes
+var ClientStatuses = []string{"active", "disabled", "expired", "no-traffic"}
+
+// clientSorts maps ClientFilter.Sort values to columns
+var clientSorts = map[string]string{
+	"id":        "id",
+	"username":  "username",
+	"traffic":   "traffic_used",
+	"expires":   "expires_at",
+	"last-seen": "last_connection",
+	"online":    "online_seconds",
+}
+
+// ClientFilter narrows, orders, and pages a client query. Zero fields don't
+// filter.
+type ClientFilter struct {
+	Status string // one of ClientStatuses
+	Tag    string // exact tag
+	Search string // substring of the username or notes
+	Sort   string // id, username, traffic, expires, last-seen, or online
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// Where applies the filter's conditions to db, leaving order and paging out
+// so the result can also be counted
+func (f *ClientFilter) Where(db *gorm.DB) (*gorm.DB, error) {
+	if f.Status != "" {
+		now := clock.Now()
+		const notExpired = "(expires_at = ? OR expires_at > ?)"
+		const hasTraffic = "(traffic_limit = 0 OR traffic_used < traffic_limit)"
+
+		switch f.Status {
+		case "active":
+			db = db.Where("enabled = ? AND "+notExpired+" AND "+hasTraffic, true, time.Time{}, now)
+		case "disabled":
+			db = db.Where("enabled = ?", false)
+		case "expired":
+			db = db.Where("enabled = ? AND expires_at <> ? AND expires_at <= ?", true, time.Time{}, now)
+		case "no-traffic":
+			db = db.Where("enabled = ? AND "+notExpired+" AND NOT "+hasTraffic, true, time.Time{}, now)
+		default:
+			return nil, fmt.Errorf("unknown status '%s' (want one of %s)", f.Status, strings.Join(ClientStatuses, ", "))
+		}
+	}
+
+	if f.Tag != "" {
+		db = db.Where("',' || tags || ',' LIKE ? ESCAPE '\\'", "%,"+escapeLike(f.Tag)+",%")
+	}
+	if f.Search != "" {
+		pattern := "%" + escapeLike(f.Search) + "%"
+		db = db.Where("username LIKE ? ESCAPE '\\' OR notes LIKE ? ESCAPE '\\'", pattern, pattern)
+	}
+	return db, nil
+}
+
+// Page applies the filter's order, limit, and offset to db
+func (f *ClientFilter) Page(db *gorm.DB) (*gorm.DB, error) {
+	sort := f.Sort
+	if sort == "" {
+		sort = "id"
+	}
+	column, ok := clientSorts[sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort '%s' (want id, username, traffic, expires, last-seen, or online)", f.Sort)
+	}
+	if f.Desc {
+		column += " DESC"
+	}
+	db = db.Order(column)
+
+	if f.Limit > 0 {
+		db = db.Limit(f.Limit)
+	}
+	if f.Offset > 0 {
+		db = db.Offset(f.Offset)
+	}
+	return db, nil
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ParseTags splits a comma-separated tag list, dropping blanks and
+// duplicates. Tags may not contain commas or whitespace.
+func ParseTags(s string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if strings.ContainsAny(tag, " \t") {
+			return nil, fmt.Errorf("invalid tag '%s': tags may not contain spaces", tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// DNSRecord is a static record the DNS dispatcher answers itself, e.g. the
+// apex NS records or an ACME DNS-01 challenge
+type DNSRecord struct {
+	gorm.Model
+	Name  string `gorm:"index;not null"` // fully qualified, lowercase, trailing dot
+	Type  string `gorm:"not null"`       // A, AAAA, NS, TXT, ...
+	Value string `gorm:"not null"`
+	TTL   uint32
+}
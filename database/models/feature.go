@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// FeatureFlag gates a subsystem for all, some, or a percentage of clients
+type FeatureFlag struct {
+	gorm.Model
+	Name    string `gorm:"uniqueIndex;not null"`
+	Enabled bool   `gorm:"default:false"`
+	Percent int    `gorm:"default:0"` // share of clients the flag is rolled out to, 0-100
+	Clients string // comma-separated usernames that always get the feature
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Kinds of ClientLocation
+const (
+	LocationCountry = "country" // Value is an ISO country code
+	LocationASN     = "asn"     // Value is an autonomous system number
+)
+
+// ClientLocation is a source country or network a client has logged in
+// from, so logins from new ones can be flagged
+type ClientLocation struct {
+	ID        uint      `gorm:"primarykey"`
+	ClientID  uint      `gorm:"uniqueIndex:idx_client_locations_client_kind_value;not null"`
+	Kind      string    `gorm:"uniqueIndex:idx_client_locations_client_kind_value;not null"`
+	Value     string    `gorm:"uniqueIndex:idx_client_locations_client_kind_value;not null"`
+	FirstSeen time.Time `gorm:"not null"`
+}
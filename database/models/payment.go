@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payment statuses
+const (
+	PaymentPending = "pending" // invoice created, waiting for the gateway
+	PaymentPaid    = "paid"    // confirmed and the client created or renewed
+	PaymentFailed  = "failed"  // expired, refunded, or rejected by the gateway
+)
+
+// Payment is an invoice for a plan. Once the gateway confirms it, the client
+// is renewed on the plan, or created when it doesn't exist yet.
+type Payment struct {
+	gorm.Model
+	OrderID   string `gorm:"uniqueIndex;not null"` // reference sent to the gateway
+	Provider  string `gorm:"not null"`
+	InvoiceID string // the gateway's reference
+	PayURL    string // payment page of the invoice, empty when the gateway has none
+	PlanID    uint   `gorm:"not null"`
+	Username  string `gorm:"index;not null"` // client to renew or create
+	Password  string // for a client created on payment
+	SubToken  string // for a client created on payment, so its link can be handed out up front
+	Amount    string // decimal, e.g. "4.99"
+	Currency  string // e.g. "USD"
+	Status    string `gorm:"index;not null"` // one of the Payment* statuses
+	PaidAt    time.Time
+}
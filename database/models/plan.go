@@ -0,0 +1,33 @@
+package models
+
+import "gorm.io/gorm"
+
+// Plan is a reusable set of client limits. Clients remember their plan so
+// changes to it can be rolled out to all of them.
+type Plan struct {
+	gorm.Model
+	Name           string `gorm:"uniqueIndex;not null"`
+	TrafficLimit   int64  `gorm:"default:0"` // in bytes, 0 means unlimited
+	DurationDays   int    `gorm:"default:0"` // validity from assignment, 0 never expires
+	SpeedLimit     int64  `gorm:"default:0"` // bytes per second, 0 means unlimited
+	MaxConnections int    `gorm:"default:0"` // concurrent SSH sessions, 0 means unlimited
+	ResetDay       int    `gorm:"default:0"` // monthly traffic reset day, 0 for a one-shot quota
+	QuotaAction    string // one of the Quota* actions, empty cuts
+	QuotaRate      int64  `gorm:"default:0"` // bytes per second once out of traffic with QuotaThrottle
+	QuotaAllow     string // comma-separated domains and IPs reachable once out of traffic with QuotaAllowlist
+	Protocols      string // comma-separated Protocols the plan's clients may log in over, empty allows all
+}
+
+// ApplyTo copies the plan's limits onto c and assigns c to the plan. The
+// expiry is left alone since it depends on when the plan was bought.
+func (p *Plan) ApplyTo(c *Client) {
+	c.PlanID = p.ID
+	c.TrafficLimit = p.TrafficLimit
+	c.SpeedLimit = p.SpeedLimit
+	c.MaxConnections = p.MaxConnections
+	c.ResetDay = p.ResetDay
+	c.QuotaAction = p.QuotaAction
+	c.QuotaRate = p.QuotaRate
+	c.QuotaAllow = p.QuotaAllow
+	c.Protocols = p.Protocols
+}
@@ -0,0 +1,10 @@
+package models
+
+import "gorm.io/gorm"
+
+// ExportTemplate is an admin-defined text/template used by client export
+type ExportTemplate struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex;not null"`
+	Body string `gorm:"not null"`
+}
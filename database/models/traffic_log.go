@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TrafficDayFormat is the layout of TrafficLog.Day, a date in server time
+const TrafficDayFormat = "2006-01-02"
+
+// TrafficLog is one client's traffic for one day. Unlike Client.TrafficUsed
+// it is never reset, so it shows where a quota went.
+type TrafficLog struct {
+	ID       uint   `gorm:"primarykey"`
+	ClientID uint   `gorm:"uniqueIndex:idx_traffic_logs_client_day;not null"`
+	Day      string `gorm:"uniqueIndex:idx_traffic_logs_client_day;not null"`
+	Bytes    int64  `gorm:"default:0"`
+}
+
+// TrafficHistory returns a client's daily traffic for the days days up to
+// and including now, oldest first, with zeroes for days without traffic
+func TrafficHistory(db *gorm.DB, clientID uint, days int, now time.Time) ([]TrafficLog, error) {
+	first := now.AddDate(0, 0, 1-days).Format(TrafficDayFormat)
+
+	var rows []TrafficLog
+	if err := db.Where("client_id = ? AND day >= ?", clientID, first).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	bytes := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		bytes[r.Day] = r.Bytes
+	}
+
+	history := make([]TrafficLog, days)
+	for i := range history {
+		day := now.AddDate(0, 0, i+1-days).Format(TrafficDayFormat)
+		history[i] = TrafficLog{ClientID: clientID, Day: day, Bytes: bytes[day]}
+	}
+	return history, nil
+}
@@ -0,0 +1,84 @@
+package debugserver
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+type Config struct {
+	Addr string                // host:port to listen on, which must be a loopback address
+	Vars map[string]func() any // published in /debug/vars next to Go's memstats and cmdline
+}
+
+// Server serves Go's runtime profiles and expvar metrics, so throughput
+// regressions can be profiled on a production server with
+// "go tool pprof http://127.0.0.1:6060/debug/pprof/profile". Profiles show
+// what the process holds in memory, so it only listens on loopback.
+type Server struct {
+	cfg    *Config
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func New(cfg *Config) (*Server, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if ip := net.ParseIP(host); err != nil || (host != "localhost" && (ip == nil || !ip.IsLoopback())) {
+		return nil, fmt.Errorf("'%s' is not a loopback host:port such as 127.0.0.1:6060", cfg.Addr)
+	}
+
+	// expvar names are process-wide and can't be published twice
+	for name, fn := range cfg.Vars {
+		if expvar.Get(name) == nil {
+			expvar.Publish(name, expvar.Func(fn))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return &Server{cfg: cfg, mux: mux}, nil
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start debug listener on %s: %w", s.cfg.Addr, err)
+	}
+	// No write timeout: CPU profiles and traces take as long as asked
+	s.server = &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving profiles and metrics on http://%s/debug/pprof/", s.cfg.Addr)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.server.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		_ = s.server.Close()
+		return err
+	}
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
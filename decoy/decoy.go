@@ -0,0 +1,108 @@
+package decoy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Dir      string // static site served to probes
+	Upstream string // http(s) URL of a site probes are proxied to instead of Dir
+}
+
+// Decoy answers HTTP that isn't meant for the panel, such as active probes
+// on the mixed port, with an ordinary website so the server looks like one.
+// A nil Decoy is valid and answers 404 as before.
+type Decoy struct {
+	handler http.Handler
+}
+
+func New(cfg *Config) (*Decoy, error) {
+	if cfg.Upstream != "" {
+		u, err := url.Parse(cfg.Upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid decoy upstream '%s': expected http(s)://host[:port]", cfg.Upstream)
+		}
+		proxy := &httputil.ReverseProxy{
+			// The upstream sees an ordinary visitor: its own Host and no
+			// forwarding headers
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(u)
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		}
+		return &Decoy{handler: proxy}, nil
+	}
+
+	if cfg.Dir == "" {
+		return nil, errors.New("the decoy needs a site directory or an upstream")
+	}
+	if info, err := os.Stat(cfg.Dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("decoy site '%s' is not a directory", cfg.Dir)
+	}
+	return &Decoy{handler: http.FileServer(http.Dir(cfg.Dir))}, nil
+}
+
+func (d *Decoy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if d == nil {
+		http.NotFound(w, r)
+		return
+	}
+	d.handler.ServeHTTP(w, r)
+}
+
+// ServeConn answers the HTTP requests on conn until the client or a timeout
+// closes it
+func (d *Decoy) ServeConn(conn net.Conn) {
+	l := &connListener{conn: conn, done: make(chan struct{})}
+	server := &http.Server{
+		Handler:           d,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       30 * time.Second,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				l.close()
+			}
+		},
+	}
+	_ = server.Serve(l)
+}
+
+// connListener hands out one connection and then blocks until it closes
+type connListener struct {
+	conn   net.Conn
+	served bool
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if !l.served {
+		l.served = true
+		return l.conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) close() {
+	l.once.Do(func() { close(l.done) })
+}
+
+func (l *connListener) Close() error {
+	l.close()
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
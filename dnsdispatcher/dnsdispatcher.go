@@ -4,26 +4,102 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/libersuite-org/panel/bans"
 	"github.com/miekg/dns"
+	"gorm.io/gorm"
 )
 
 const (
 	ListenAddr = "0.0.0.0:53"
 )
 
+// How queries outside every tunnel domain and static record are answered
+const (
+	UnmatchedDrop     = "drop"
+	UnmatchedRefused  = "refused"
+	UnmatchedNXDomain = "nxdomain"
+)
+
+type Config struct {
+	DB             *gorm.DB      // static records to serve, nil serves none
+	Listen         []string      // UDP (and with MaxUDPResponse, TCP) listen addresses, ListenAddr when empty
+	HealthInterval time.Duration // backend probe interval, 0 disables active probing
+	Unmatched      string        // one of the Unmatched* modes, defaults to UnmatchedDrop
+	DoHAddr        string        // DNS-over-HTTPS listen address, DoH disabled when empty
+	DoHCert        string        // TLS certificate for DoH, plain HTTP when empty
+	DoHKey         string
+	MaxUDPResponse int    // UDP replies above this are truncated so resolvers retry over TCP, 0 disables truncation and the TCP listener
+	PayloadSize    uint16 // minimum EDNS(0) payload size advertised to backends, 0 forwards queries as received
+	LogOversize    bool   // log UDP replies larger than the requester takes
+
+	RateLimit        int         // UDP queries accepted per second from one source IP, 0 disables
+	RateBan          bool        // ban sources that stay over RateLimit through Bans
+	MaxAmplification float64     // largest UDP reply to query size ratio, 0 disables
+	Bans             *bans.Guard // drops queries from banned IPs, nil disables
+}
+
 type DnsDispatcher struct {
-	routes []domainRoute
+	cfg         Config
+	routes      atomic.Pointer[[]domainRoute] // swapped whole by SetRoutes
+	limiter     *sourceLimiter                // nil when queries are not rate limited
+	unmatched   int64
+	rateLimited int64
+	amplified   int64
+	listening   atomic.Int32 // UDP listeners up
+	records     recordCache
 }
 
 type domainRoute struct {
-	domain     string
-	backendUDP *net.UDPAddr
+	domain   string
+	backends []*backend
+	next     uint32 // round-robin cursor
+	stats    *routeStats
+}
+
+// NewDnsDispatcher routes each domain to its backend address entry. An entry
+// may list several addresses joined by BackendGroupSeparator, which are then
+// used round-robin with failover.
+func NewDnsDispatcher(domains []string, backendAddrs []string, cfg *Config) (*DnsDispatcher, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	switch cfg.Unmatched {
+	case "":
+		cfg.Unmatched = UnmatchedDrop
+	case UnmatchedDrop, UnmatchedRefused, UnmatchedNXDomain:
+	default:
+		return nil, fmt.Errorf("unknown unmatched query mode '%s'", cfg.Unmatched)
+	}
+	if cfg.MaxUDPResponse != 0 && (cfg.MaxUDPResponse < dns.MinMsgSize || cfg.MaxUDPResponse > dns.MaxMsgSize) {
+		return nil, fmt.Errorf("maximum UDP response size must be between %d and %d", dns.MinMsgSize, dns.MaxMsgSize)
+	}
+	if cfg.PayloadSize != 0 && cfg.PayloadSize < dns.MinMsgSize {
+		return nil, fmt.Errorf("forwarded payload size must be at least %d", dns.MinMsgSize)
+	}
+	for _, addr := range cfg.Listen {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid DNS listen address '%s': expected host:port", addr)
+		}
+	}
+	if cfg.RateLimit < 0 || cfg.MaxAmplification < 0 {
+		return nil, fmt.Errorf("rate limit and amplification ratio cannot be negative")
+	}
+
+	d := &DnsDispatcher{cfg: *cfg, limiter: newSourceLimiter(cfg.RateLimit)}
+	if err := d.SetRoutes(domains, backendAddrs); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
-func NewDnsDispatcher(domains []string, backendAddrs []string) (*DnsDispatcher, error) {
+// SetRoutes replaces the domain routes without restarting the listeners.
+// Domains whose backends are unchanged keep their stats and health state.
+func (d *DnsDispatcher) SetRoutes(domains []string, backendAddrs []string) error {
 	normalizedDomains := make([]string, 0, len(domains))
 	for _, domain := range domains {
 		domain = strings.TrimSpace(strings.ToLower(domain))
@@ -37,7 +113,7 @@ func NewDnsDispatcher(domains []string, backendAddrs []string) (*DnsDispatcher,
 	}
 
 	if len(normalizedDomains) == 0 {
-		return nil, fmt.Errorf("at least one domain is required")
+		return fmt.Errorf("at least one domain is required")
 	}
 
 	normalizedAddrs := make([]string, 0, len(backendAddrs))
@@ -50,11 +126,17 @@ func NewDnsDispatcher(domains []string, backendAddrs []string) (*DnsDispatcher,
 	}
 
 	if len(normalizedAddrs) == 0 {
-		return nil, fmt.Errorf("at least one backend address is required")
+		return fmt.Errorf("at least one backend address is required")
 	}
 
 	if len(normalizedAddrs) != 1 && len(normalizedAddrs) != len(normalizedDomains) {
-		return nil, &net.AddrError{Err: "backend addr count must be 1 or match domain count"}
+		return &net.AddrError{Err: "backend addr count must be 1 or match domain count"}
+	}
+
+	current := d.currentRoutes()
+	previous := make(map[string]*domainRoute, len(current))
+	for i := range current {
+		previous[current[i].domain] = &current[i]
 	}
 
 	routes := make([]domainRoute, 0, len(normalizedDomains))
@@ -64,62 +146,202 @@ func NewDnsDispatcher(domains []string, backendAddrs []string) (*DnsDispatcher,
 			addr = normalizedAddrs[i]
 		}
 
-		backendUDP, err := net.ResolveUDPAddr("udp", addr)
-		if err != nil {
-			return nil, err
+		var backends []*backend
+		for _, member := range strings.Split(addr, BackendGroupSeparator) {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			backendUDP, err := net.ResolveUDPAddr("udp", member)
+			if err != nil {
+				return err
+			}
+			backends = append(backends, &backend{addr: backendUDP.String()})
+		}
+		if len(backends) == 0 {
+			return &net.AddrError{Err: "empty backend group", Addr: addr}
 		}
 
-		routes = append(routes, domainRoute{domain: domain, backendUDP: backendUDP})
+		if old, ok := previous[domain]; ok && sameBackends(old.backends, backends) {
+			routes = append(routes, domainRoute{domain: domain, backends: old.backends, stats: old.stats})
+			continue
+		}
+		routes = append(routes, domainRoute{domain: domain, backends: backends, stats: &routeStats{}})
 	}
 
-	return &DnsDispatcher{routes: routes}, nil
+	d.routes.Store(&routes)
+	return nil
+}
+
+func (d *DnsDispatcher) currentRoutes() []domainRoute {
+	if routes := d.routes.Load(); routes != nil {
+		return *routes
+	}
+	return nil
+}
+
+func sameBackends(a, b []*backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].addr != b[i].addr {
+			return false
+		}
+	}
+	return true
 }
 
 func (d *DnsDispatcher) Start(ctx context.Context) error {
-	server := &dns.Server{Addr: ListenAddr, Net: "udp"}
+	defer d.listening.Store(0)
+	// The health checks and rate limiter sweeps end with this run, so a
+	// restart doesn't start a second set
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	server.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
-		if len(r.Question) == 0 {
+	udpHandler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if d.cfg.Bans.Banned(w.RemoteAddr()) || !d.admitUDP(w.RemoteAddr()) {
 			return
 		}
-
-		qName := strings.ToLower(r.Question[0].Name)
-		target := d.matchTarget(qName)
-		if target != nil {
-			forwardDNS(w, r, target)
+		if m := d.answer(r); m != nil {
+			d.fitUDP(r, m)
+			if m = d.limitAmplification(r, m); m != nil {
+				w.WriteMsg(m)
+			}
+		}
+	})
+	tcpHandler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if d.cfg.Bans.Banned(w.RemoteAddr()) {
+			return
+		}
+		if m := d.answer(r); m != nil {
+			w.WriteMsg(m)
 		}
 	})
 
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- server.ListenAndServe()
-	}()
+	var servers []*dns.Server
+	for _, addr := range d.ListenAddrs() {
+		udp := &dns.Server{Addr: addr, Net: "udp", Handler: udpHandler}
+		udp.NotifyStartedFunc = func() { d.listening.Add(1) }
+		servers = append(servers, udp)
+		// Truncated replies are retried over TCP
+		if d.cfg.MaxUDPResponse > 0 {
+			servers = append(servers, &dns.Server{Addr: addr, Net: "tcp", Handler: tcpHandler})
+		}
+	}
+
+	errChan := make(chan error, len(servers)+1)
+	for _, server := range servers {
+		go func() {
+			errChan <- bindError(server.ListenAndServe())
+		}()
+	}
+	var doh *http.Server
+	if d.cfg.DoHAddr != "" {
+		doh = d.newDoHServer()
+		go func() {
+			errChan <- d.serveDoH(doh)
+		}()
+	}
+	go d.checkHealth(ctx)
+	go d.limiter.sweep(ctx)
 
+	var err error
 	select {
 	case <-ctx.Done():
-		return server.Shutdown()
-	case err := <-errChan:
-		return err
+	case err = <-errChan:
+	}
+	if doh != nil {
+		doh.Close()
+	}
+	for _, server := range servers {
+		server.Shutdown()
+	}
+	return err
+}
+
+// Listening reports whether every UDP listener is up
+func (d *DnsDispatcher) Listening() bool {
+	return d != nil && int(d.listening.Load()) == len(d.ListenAddrs())
+}
+
+// ListenAddrs returns the addresses the dispatcher serves DNS on
+func (d *DnsDispatcher) ListenAddrs() []string {
+	if d == nil {
+		return nil
+	}
+	if len(d.cfg.Listen) == 0 {
+		return []string{ListenAddr}
 	}
+	return d.cfg.Listen
 }
 
-func (d *DnsDispatcher) matchTarget(qName string) *net.UDPAddr {
-	for _, route := range d.routes {
-		if strings.HasSuffix(qName, route.domain) {
-			return route.backendUDP
+// answer returns the reply to r, or nil when the query should be dropped
+func (d *DnsDispatcher) answer(r *dns.Msg) *dns.Msg {
+	if len(r.Question) == 0 {
+		return nil
+	}
+
+	if m, ok := d.staticAnswer(r); ok {
+		return m
+	}
+
+	qName := strings.ToLower(r.Question[0].Name)
+	route := d.matchRoute(qName)
+	if route == nil {
+		atomic.AddInt64(&d.unmatched, 1)
+		return d.answerUnmatched(r)
+	}
+	return d.forwardDNS(r, route)
+}
+
+func (d *DnsDispatcher) matchRoute(qName string) *domainRoute {
+	routes := d.currentRoutes()
+	for i := range routes {
+		if strings.HasSuffix(qName, routes[i].domain) {
+			return &routes[i]
 		}
 	}
 	return nil
 }
 
-func forwardDNS(w dns.ResponseWriter, r *dns.Msg, target *net.UDPAddr) {
+func (d *DnsDispatcher) answerUnmatched(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	switch d.cfg.Unmatched {
+	case UnmatchedRefused:
+		m.SetRcode(r, dns.RcodeRefused)
+	case UnmatchedNXDomain:
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Authoritative = true
+	default:
+		return nil
+	}
+	return m
+}
+
+func (d *DnsDispatcher) forwardDNS(r *dns.Msg, route *domainRoute) *dns.Msg {
 	c := dns.Client{}
 	c.Timeout = 2 * time.Second
+	q := withPayloadSize(r, d.cfg.PayloadSize)
 
-	resp, _, err := c.Exchange(r, target.String())
-	if err != nil {
-		return
+	candidates := route.candidates()
+	if len(candidates) > forwardTries {
+		candidates = candidates[:forwardTries]
 	}
+	for _, b := range candidates {
+		resp, rtt, err := c.Exchange(q, b.addr)
+		if err != nil {
+			b.fail(route.domain, err)
+			continue
+		}
+		b.succeed(route.domain)
+		if q != r && r.IsEdns0() == nil {
+			stripEdns0(resp)
+		}
 
-	w.WriteMsg(resp)
+		route.stats.record(r.Len(), resp.Len(), rtt, false)
+		return resp
+	}
+	route.stats.record(r.Len(), 0, 0, true)
+	return nil
 }
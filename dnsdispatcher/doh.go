@@ -0,0 +1,109 @@
+package dnsdispatcher
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DoHPath is the RFC 8484 endpoint
+const DoHPath = "/dns-query"
+
+const dohContentType = "application/dns-message"
+
+func (d *DnsDispatcher) newDoHServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(DoHPath, d.handleDoH)
+
+	return &http.Server{
+		Addr:              d.cfg.DoHAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func (d *DnsDispatcher) serveDoH(server *http.Server) error {
+	var err error
+	if d.cfg.DoHCert != "" {
+		log.Printf("Starting DNS-over-HTTPS on https://%s%s", server.Addr, DoHPath)
+		err = server.ListenAndServeTLS(d.cfg.DoHCert, d.cfg.DoHKey)
+	} else {
+		log.Printf("Starting DNS-over-HTTPS on http://%s%s (TLS terminated upstream)", server.Addr, DoHPath)
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return fmt.Errorf("DoH server: %w", err)
+}
+
+// handleDoH answers RFC 8484 GET (?dns=) and POST queries through the same
+// routing as UDP queries
+func (d *DnsDispatcher) handleDoH(w http.ResponseWriter, r *http.Request) {
+	var wire []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		wire, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+		wire, err = io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil || len(wire) == 0 {
+		http.Error(w, "invalid DNS query", http.StatusBadRequest)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(wire); err != nil {
+		http.Error(w, "invalid DNS query", http.StatusBadRequest)
+		return
+	}
+
+	// HTTP needs a reply even where UDP would stay silent
+	resp := d.answer(req)
+	if resp == nil {
+		resp = new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeServerFailure)
+	}
+
+	out, err := resp.Pack()
+	if err != nil {
+		http.Error(w, "failed to encode reply", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohContentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minTTL(resp)))
+	w.Write(out)
+}
+
+// minTTL is the freshness lifetime of a reply per RFC 8484 section 5.1
+func minTTL(m *dns.Msg) uint32 {
+	var ttl uint32
+	first := true
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if first || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				first = false
+			}
+		}
+	}
+	return ttl
+}
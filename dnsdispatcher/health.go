@@ -0,0 +1,110 @@
+package dnsdispatcher
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// BackendGroupSeparator splits one backend address entry into a
+	// failover pool, e.g. "127.0.0.1:5300|127.0.0.1:5301"
+	BackendGroupSeparator = "|"
+
+	// downAfter consecutive failed exchanges take a backend out of rotation
+	downAfter     = 3
+	probeTimeout  = 2 * time.Second
+	forwardTries  = 2
+	probeHostname = "health"
+)
+
+type backend struct {
+	addr     string
+	failures int32
+	down     atomic.Bool
+}
+
+// succeed puts the backend back into rotation
+func (b *backend) succeed(domain string) {
+	atomic.StoreInt32(&b.failures, 0)
+	if b.down.CompareAndSwap(true, false) {
+		log.Printf("DNS backend %s for %s is healthy again", b.addr, domain)
+	}
+}
+
+// fail takes the backend out of rotation after downAfter failures in a row
+func (b *backend) fail(domain string, err error) {
+	if atomic.AddInt32(&b.failures, 1) < downAfter {
+		return
+	}
+	if b.down.CompareAndSwap(false, true) {
+		log.Printf("DNS backend %s for %s is down: %v", b.addr, domain, err)
+	}
+}
+
+// candidates returns the backends to try for one query, healthy ones first
+// in round-robin order. When every backend is down they are all tried
+// anyway so a flapping health check cannot blackhole the domain.
+func (r *domainRoute) candidates() []*backend {
+	n := len(r.backends)
+	start := 0
+	if n > 1 {
+		start = int(atomic.AddUint32(&r.next, 1) % uint32(n))
+	}
+
+	healthy := make([]*backend, 0, n)
+	var down []*backend
+	for i := 0; i < n; i++ {
+		b := r.backends[(start+i)%n]
+		if b.down.Load() {
+			down = append(down, b)
+		} else {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		return down
+	}
+	return healthy
+}
+
+// checkHealth probes every backend each interval until ctx is done
+func (d *DnsDispatcher) checkHealth(ctx context.Context) {
+	if d.cfg.HealthInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.cfg.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, route := range d.currentRoutes() {
+				for _, b := range route.backends {
+					go probe(route.domain, b)
+				}
+			}
+		}
+	}
+}
+
+// probe sends a test query; any well-formed reply counts as healthy since
+// tunnel servers answer unknown names with an error rcode
+func probe(domain string, b *backend) {
+	m := new(dns.Msg)
+	m.SetQuestion(probeHostname+"."+strings.TrimPrefix(domain, "."), dns.TypeTXT)
+
+	c := dns.Client{Timeout: probeTimeout}
+	if _, _, err := c.Exchange(m, b.addr); err != nil {
+		b.fail(domain, err)
+		return
+	}
+	b.succeed(domain)
+}
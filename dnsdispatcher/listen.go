@@ -0,0 +1,76 @@
+package dnsdispatcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// capNetBindService is the Linux capability that allows binding ports below
+// ip_unprivileged_port_start
+const capNetBindService = 10
+
+// bindHint explains how to serve port 53 without running as root
+const bindHint = "ports below 1024 need root or CAP_NET_BIND_SERVICE: grant it with " +
+	"'setcap cap_net_bind_service=+ep <panel binary>' (or AmbientCapabilities=CAP_NET_BIND_SERVICE in the systemd unit), " +
+	"or listen on a high port such as :5353 and redirect 53 to it with " +
+	"'iptables -t nat -A PREROUTING -p udp --dport 53 -j REDIRECT --to-ports 5353'"
+
+// bindError adds bindHint to permission errors from starting a listener
+func bindError(err error) error {
+	if err != nil && errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w; %s", err, bindHint)
+	}
+	return err
+}
+
+// PrivilegeWarning returns why this process likely can't bind the listen
+// addresses, or "" when it can or that can't be told. It is only a hint:
+// the listeners report the actual error.
+func PrivilegeWarning(addrs []string) string {
+	if os.Geteuid() == 0 || hasCapability(capNetBindService) {
+		return ""
+	}
+	unprivileged := 1024
+	if b, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+			unprivileged = n
+		}
+	}
+
+	for _, addr := range addrs {
+		_, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if port, err := strconv.Atoi(portStr); err == nil && port > 0 && port < unprivileged {
+			return fmt.Sprintf("not running as root, so binding DNS on %s will likely fail; %s", addr, bindHint)
+		}
+	}
+	return ""
+}
+
+// hasCapability reports whether the process has capability bit in its
+// effective set, per /proc/self/status. It is false where that can't be read.
+func hasCapability(bit uint) bool {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		return err == nil && caps&(1<<bit) != 0
+	}
+	return false
+}
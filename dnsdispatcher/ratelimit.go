@@ -0,0 +1,156 @@
+package dnsdispatcher
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rateBanAfter consecutive seconds over the rate limit get a source banned
+// when RateBan is on
+const rateBanAfter = 10
+
+// sourceLimiter caps the UDP queries accepted per second from each source
+// IP. Spoofed sources are how an open resolver port is turned into a
+// reflection attack, so only UDP is limited.
+type sourceLimiter struct {
+	rate    int
+	mu      sync.Mutex
+	sources map[string]*sourceRate
+}
+
+type sourceRate struct {
+	second   int64 // unix second the count belongs to
+	count    int
+	lastOver int64 // last second the source went over the rate
+	strikes  int   // consecutive seconds over the rate
+}
+
+func newSourceLimiter(rate int) *sourceLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &sourceLimiter{rate: rate, sources: make(map[string]*sourceRate)}
+}
+
+// allow counts a query from ip and reports whether it is within the rate,
+// and whether the source has now been over it for rateBanAfter seconds in a
+// row
+func (l *sourceLimiter) allow(ip string) (ok, persistent bool) {
+	if l == nil {
+		return true, false
+	}
+	now := time.Now().Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	src, found := l.sources[ip]
+	if !found {
+		src = &sourceRate{}
+		l.sources[ip] = src
+	}
+	if src.second != now {
+		src.second, src.count = now, 0
+	}
+	src.count++
+	if src.count <= l.rate {
+		return true, false
+	}
+
+	// Strikes are counted once per second, on the first query over the rate
+	if src.count == l.rate+1 {
+		if src.lastOver == now-1 {
+			src.strikes++
+		} else {
+			src.strikes = 1
+		}
+		src.lastOver = now
+		if src.strikes >= rateBanAfter {
+			src.strikes = 0
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// sweep forgets sources that have been quiet for a minute until ctx is done
+func (l *sourceLimiter) sweep(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Unix() - 60
+			l.mu.Lock()
+			for ip, src := range l.sources {
+				if src.second < cutoff {
+					delete(l.sources, ip)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// admitUDP reports whether a UDP query from addr may be answered, banning
+// sources that keep flooding when RateBan is on
+func (d *DnsDispatcher) admitUDP(addr net.Addr) bool {
+	udp, isUDP := addr.(*net.UDPAddr)
+	if !isUDP {
+		return true
+	}
+	ok, persistent := d.limiter.allow(udp.IP.String())
+	if ok {
+		return true
+	}
+	atomic.AddInt64(&d.rateLimited, 1)
+	if persistent && d.cfg.RateBan {
+		d.cfg.Bans.Ban(addr, "DNS query flood")
+	}
+	return false
+}
+
+// limitAmplification replaces a UDP reply more than MaxAmplification times
+// the size of its query. With the TCP listener up the resolver gets an empty
+// truncated reply to retry over TCP, which can't be spoofed; otherwise the
+// reply is dropped.
+func (d *DnsDispatcher) limitAmplification(r, m *dns.Msg) *dns.Msg {
+	if d.cfg.MaxAmplification <= 0 || float64(m.Len()) <= d.cfg.MaxAmplification*float64(r.Len()) {
+		return m
+	}
+	atomic.AddInt64(&d.amplified, 1)
+	if d.cfg.MaxUDPResponse == 0 {
+		return nil
+	}
+	tc := new(dns.Msg)
+	tc.SetReply(r)
+	tc.Truncated = true
+	return tc
+}
+
+// RateLimited returns how many UDP queries were dropped over the per-source
+// rate limit
+func (d *DnsDispatcher) RateLimited() int64 {
+	if d == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&d.rateLimited)
+}
+
+// Amplified returns how many UDP replies were withheld for being too large
+// next to their query
+func (d *DnsDispatcher) Amplified() int64 {
+	if d == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&d.amplified)
+}
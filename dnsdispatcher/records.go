@@ -0,0 +1,127 @@
+package dnsdispatcher
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/miekg/dns"
+)
+
+// DefaultRecordTTL is used for static records saved without a TTL
+const DefaultRecordTTL = 300
+
+// recordsTTL bounds how long record changes made from the CLI take to apply
+const recordsTTL = 30 * time.Second
+
+// recordCache holds the static records of the database, reloaded every
+// recordsTTL
+type recordCache struct {
+	mu       sync.RWMutex
+	records  map[string][]dns.RR // by owner name
+	loadedAt time.Time
+}
+
+// ParseRecord normalizes rec in place and returns it as a resource record
+func ParseRecord(rec *models.DNSRecord) (dns.RR, error) {
+	rec.Name = dns.Fqdn(strings.ToLower(strings.TrimSpace(rec.Name)))
+	rec.Type = strings.ToUpper(strings.TrimSpace(rec.Type))
+	rec.Value = strings.TrimSpace(rec.Value)
+	if _, ok := dns.IsDomainName(rec.Name); !ok || rec.Name == "." {
+		return nil, fmt.Errorf("invalid record name '%s'", rec.Name)
+	}
+	if _, ok := dns.StringToType[rec.Type]; !ok {
+		return nil, fmt.Errorf("unknown record type '%s'", rec.Type)
+	}
+	if rec.Value == "" {
+		return nil, fmt.Errorf("record value is required")
+	}
+	if rec.TTL == 0 {
+		rec.TTL = DefaultRecordTTL
+	}
+
+	value := rec.Value
+	if rec.Type == "TXT" && !strings.HasPrefix(value, `"`) {
+		value = strconv.Quote(value)
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", rec.Name, rec.TTL, rec.Type, value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s record: %w", rec.Type, err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("invalid %s record", rec.Type)
+	}
+	return rr, nil
+}
+
+// InvalidateRecords forces the next lookup to reload records from the database
+func (d *DnsDispatcher) InvalidateRecords() {
+	if d == nil {
+		return
+	}
+	d.records.mu.Lock()
+	d.records.loadedAt = time.Time{}
+	d.records.mu.Unlock()
+}
+
+// staticAnswer builds an authoritative reply when the question's name has
+// static records. A name with records of other types gets an empty answer.
+func (d *DnsDispatcher) staticAnswer(r *dns.Msg) (*dns.Msg, bool) {
+	if d.cfg.DB == nil {
+		return nil, false
+	}
+	q := r.Question[0]
+	rrs, ok := d.lookupRecords(strings.ToLower(q.Name))
+	if !ok {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	for _, rr := range rrs {
+		if q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype {
+			rr = dns.Copy(rr)
+			rr.Header().Name = q.Name
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	return m, true
+}
+
+func (d *DnsDispatcher) lookupRecords(name string) ([]dns.RR, bool) {
+	c := &d.records
+	c.mu.RLock()
+	fresh := time.Since(c.loadedAt) < recordsTTL
+	rrs, ok := c.records[name]
+	c.mu.RUnlock()
+	if fresh {
+		return rrs, ok
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.loadedAt) >= recordsTTL {
+		var all []models.DNSRecord
+		if err := d.cfg.DB.Find(&all).Error; err != nil {
+			log.Printf("Failed to load DNS records: %v", err)
+		} else {
+			c.records = make(map[string][]dns.RR, len(all))
+			for i := range all {
+				rr, err := ParseRecord(&all[i])
+				if err != nil {
+					log.Printf("Skipping DNS record %d: %v", all[i].ID, err)
+					continue
+				}
+				c.records[all[i].Name] = append(c.records[all[i].Name], rr)
+			}
+		}
+		c.loadedAt = time.Now()
+	}
+	rrs, ok = c.records[name]
+	return rrs, ok
+}
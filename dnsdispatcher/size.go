@@ -0,0 +1,78 @@
+package dnsdispatcher
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// withPayloadSize returns r advertising at least size bytes of EDNS(0) UDP
+// payload, so backends such as dnstt-server answer resolvers that advertise
+// less, or no EDNS at all, instead of failing them with FORMERR
+func withPayloadSize(r *dns.Msg, size uint16) *dns.Msg {
+	if size == 0 {
+		return r
+	}
+	if opt := r.IsEdns0(); opt != nil && opt.UDPSize() >= size {
+		return r
+	}
+
+	q := r.Copy()
+	if opt := q.IsEdns0(); opt != nil {
+		opt.SetUDPSize(size)
+	} else {
+		q.SetEdns0(size, false)
+	}
+	return q
+}
+
+// stripEdns0 drops the OPT record from a reply to a query without one
+func stripEdns0(m *dns.Msg) {
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+}
+
+// udpLimit is the largest UDP reply the requester of r takes: its EDNS(0)
+// payload size, or 512 without EDNS, capped at MaxUDPResponse
+func (d *DnsDispatcher) udpLimit(r *dns.Msg) int {
+	limit := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil && int(opt.UDPSize()) > limit {
+		limit = int(opt.UDPSize())
+	}
+	if d.cfg.MaxUDPResponse > 0 && limit > d.cfg.MaxUDPResponse {
+		limit = d.cfg.MaxUDPResponse
+	}
+	return limit
+}
+
+// fitUDP handles a UDP reply m to r that is larger than udpLimit: it is
+// logged with LogOversize, and with MaxUDPResponse set it is truncated with
+// the TC bit so the resolver retries over TCP
+func (d *DnsDispatcher) fitUDP(r, m *dns.Msg) {
+	limit := d.udpLimit(r)
+	size := m.Len()
+	if size <= limit {
+		return
+	}
+
+	name := strings.ToLower(r.Question[0].Name)
+	if d.cfg.LogOversize {
+		log.Printf("DNS reply for %s is %d bytes, over the %d the requester takes over UDP", name, size, limit)
+	}
+	if d.cfg.MaxUDPResponse == 0 {
+		return
+	}
+	m.Truncate(limit)
+	if m.Truncated {
+		if route := d.matchRoute(name); route != nil {
+			atomic.AddInt64(&route.stats.truncated, 1)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package dnsdispatcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// BackendStatus reports whether a backend is currently in rotation
+type BackendStatus struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+}
+
+// DomainStats is a snapshot of the traffic carried for one tunnel domain
+type DomainStats struct {
+	Domain      string          `json:"domain"`
+	Backends    []BackendStatus `json:"backends"`
+	Queries     int64           `json:"queries"`
+	Errors      int64           `json:"errors"`
+	BytesIn     int64           `json:"bytes_in"`  // query bytes received from resolvers
+	BytesOut    int64           `json:"bytes_out"` // response bytes sent back
+	Truncated   int64           `json:"truncated"` // UDP replies cut down for resolvers to retry over TCP
+	AvgLatency  time.Duration   `json:"avg_latency_ns"`
+	MaxLatency  time.Duration   `json:"max_latency_ns"`
+	LastQueryAt time.Time       `json:"last_query_at,omitzero"`
+}
+
+type routeStats struct {
+	queries    int64
+	errors     int64
+	bytesIn    int64
+	bytesOut   int64
+	truncated  int64
+	latencyNs  int64 // sum over answered queries
+	maxLatency int64
+	lastQuery  int64 // unix nanoseconds
+}
+
+func (s *routeStats) record(in, out int, latency time.Duration, failed bool) {
+	atomic.AddInt64(&s.queries, 1)
+	atomic.AddInt64(&s.bytesIn, int64(in))
+	atomic.StoreInt64(&s.lastQuery, time.Now().UnixNano())
+	if failed {
+		atomic.AddInt64(&s.errors, 1)
+		return
+	}
+
+	atomic.AddInt64(&s.bytesOut, int64(out))
+	atomic.AddInt64(&s.latencyNs, int64(latency))
+	for {
+		cur := atomic.LoadInt64(&s.maxLatency)
+		if int64(latency) <= cur || atomic.CompareAndSwapInt64(&s.maxLatency, cur, int64(latency)) {
+			break
+		}
+	}
+}
+
+// Stats returns per-domain counters since the dispatcher started
+func (d *DnsDispatcher) Stats() []DomainStats {
+	if d == nil {
+		return nil
+	}
+
+	routes := d.currentRoutes()
+	out := make([]DomainStats, 0, len(routes))
+	for _, route := range routes {
+		s := route.stats
+		stat := DomainStats{
+			Domain:     route.domain,
+			Queries:    atomic.LoadInt64(&s.queries),
+			Errors:     atomic.LoadInt64(&s.errors),
+			BytesIn:    atomic.LoadInt64(&s.bytesIn),
+			BytesOut:   atomic.LoadInt64(&s.bytesOut),
+			Truncated:  atomic.LoadInt64(&s.truncated),
+			MaxLatency: time.Duration(atomic.LoadInt64(&s.maxLatency)),
+		}
+		if answered := stat.Queries - stat.Errors; answered > 0 {
+			stat.AvgLatency = time.Duration(atomic.LoadInt64(&s.latencyNs) / answered)
+		}
+		if last := atomic.LoadInt64(&s.lastQuery); last > 0 {
+			stat.LastQueryAt = time.Unix(0, last)
+		}
+		for _, b := range route.backends {
+			stat.Backends = append(stat.Backends, BackendStatus{Addr: b.addr, Healthy: !b.down.Load()})
+		}
+		out = append(out, stat)
+	}
+	return out
+}
+
+// Unmatched returns how many queries matched no tunnel domain
+func (d *DnsDispatcher) Unmatched() int64 {
+	if d == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&d.unmatched)
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"maps"
+	"slices"
+)
+
+// Presets are built-in templates for client apps that can't import the
+// generic links as is, keyed by the name "client export --format" takes
+var Presets = map[string]string{
+	// The links as printed without a format, which NetMod imports directly
+	"netmod": `{{.SSHURL}}{{range .DNSTTURLs}}
+{{.}}{{end}}
+`,
+	// The account string HTTP Injector and HTTP Custom take in their SSH
+	// settings
+	"http-injector": `{{.Address}}@{{.Username}}:{{.Password}}
+`,
+	// A block for ~/.ssh/config; OpenSSH has no place for the password, so
+	// it is left in a comment to type at the prompt
+	"openssh-config": `# {{.Label}}: run "ssh -N {{.Username}}-vpn" and point apps at SOCKS5 127.0.0.1:1080
+# Password: {{.Password}}{{if .HostKeyFingerprint}}
+# Host key: {{.HostKeyFingerprint}}{{end}}
+Host {{.Username}}-vpn
+    HostName {{.Host}}
+    Port {{.Port}}
+    User {{.Username}}
+    DynamicForward 1080
+    ServerAliveInterval 30
+    ExitOnForwardFailure yes
+`,
+	"json": `{{json .}}
+`,
+}
+
+// PresetNames returns the preset names in order
+func PresetNames() []string {
+	return slices.Sorted(maps.Keys(Presets))
+}
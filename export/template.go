@@ -0,0 +1,70 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Data is the value export templates are executed against
+type Data struct {
+	Username           string
+	Password           string
+	Host               string
+	Port               int
+	Address            string // Host and Port joined, with IPv6 hosts bracketed
+	Token              string
+	Label              string
+	Domain             string   // first of Domains
+	Domains            []string // every dnstt domain
+	Pubkey             string
+	Resolver           string
+	SSHURL             string
+	DNSTTURL           string   // first of DNSTTURLs
+	DNSTTURLs          []string // one dnstt URI per domain
+	QUICURL            string   // empty without a QUIC listener
+	SOCKSURL           string   // empty unless the server takes SOCKS token logins
+	HostKeyFingerprint string
+	TrafficLimit       int64
+	TrafficUsed        int64
+	ExpiresAt          time.Time
+}
+
+var funcs = template.FuncMap{
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Parse validates a template body
+func Parse(name, body string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template '%s': %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Render executes a template body against data
+func Render(name, body string, data Data) (string, error) {
+	tmpl, err := Parse(name, body)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template '%s': %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,101 @@
+package features
+
+import (
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// cacheTTL bounds how long flag changes made from the CLI take to apply
+const cacheTTL = 30 * time.Second
+
+// Flags answers which features are on from the flags stored in a database,
+// reloading them every cacheTTL. A nil *Flags has every feature off.
+type Flags struct {
+	db *gorm.DB
+
+	mu       sync.RWMutex
+	flags    map[string]models.FeatureFlag
+	loadedAt time.Time
+}
+
+func New(db *gorm.DB) *Flags {
+	return &Flags{db: db}
+}
+
+// Enabled reports whether the named feature is on for username. An empty
+// username asks whether the feature is on globally (enabled at 100%).
+func (f *Flags) Enabled(name, username string) bool {
+	if f == nil {
+		return false
+	}
+	flag, ok := f.lookup(name)
+	if !ok || !flag.Enabled {
+		return false
+	}
+	return Evaluate(flag, username)
+}
+
+// Evaluate applies a flag's rollout rules to username
+func Evaluate(flag models.FeatureFlag, username string) bool {
+	if flag.Percent >= 100 {
+		return true
+	}
+	if username == "" {
+		return false
+	}
+
+	for _, c := range strings.Split(flag.Clients, ",") {
+		if strings.TrimSpace(c) == username {
+			return true
+		}
+	}
+
+	// Hash name and username together so each flag samples a different cohort
+	h := fnv.New32a()
+	h.Write([]byte(flag.Name + ":" + username))
+	return int(h.Sum32()%100) < flag.Percent
+}
+
+// Invalidate forces the next lookup to reload flags from the database
+func (f *Flags) Invalidate() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	f.loadedAt = time.Time{}
+	f.mu.Unlock()
+}
+
+func (f *Flags) lookup(name string) (models.FeatureFlag, bool) {
+	f.mu.RLock()
+	fresh := time.Since(f.loadedAt) < cacheTTL
+	flag, ok := f.flags[name]
+	f.mu.RUnlock()
+	if fresh {
+		return flag, ok
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.loadedAt) >= cacheTTL {
+		var all []models.FeatureFlag
+		if err := f.db.Find(&all).Error; err != nil {
+			log.Printf("Failed to load feature flags: %v", err)
+		} else {
+			f.flags = make(map[string]models.FeatureFlag, len(all))
+			for _, flag := range all {
+				f.flags[flag.Name] = flag
+			}
+		}
+		f.loadedAt = time.Now()
+	}
+
+	flag, ok = f.flags[name]
+	return flag, ok
+}
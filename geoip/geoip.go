@@ -0,0 +1,90 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB looks up countries in a MaxMind GeoLite2/GeoIP2 Country or City database,
+// or networks in an ASN database. A nil DB knows neither.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	return &DB{reader: reader}, nil
+}
+
+// Country returns the ISO country code for ip, or "" when unknown
+func (d *DB) Country(ip net.IP) string {
+	if d == nil || ip == nil {
+		return ""
+	}
+
+	var record countryRecord
+	if err := d.reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode
+	}
+	return record.RegisteredCountry.ISOCode
+}
+
+// ASN returns the autonomous system number and organization for ip, or 0
+// when unknown
+func (d *DB) ASN(ip net.IP) (uint, string) {
+	if d == nil || ip == nil {
+		return 0, ""
+	}
+
+	var record asnRecord
+	if err := d.reader.Lookup(ip, &record); err != nil {
+		return 0, ""
+	}
+	return record.Number, record.Organization
+}
+
+func (d *DB) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.reader.Close()
+}
+
+// ParseCountries turns a comma-separated list into upper-case ISO codes
+func ParseCountries(value string) ([]string, error) {
+	var codes []string
+	for _, part := range strings.Split(value, ",") {
+		code := strings.ToUpper(strings.TrimSpace(part))
+		if code == "" {
+			continue
+		}
+		if len(code) != 2 {
+			return nil, fmt.Errorf("invalid country code '%s'", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
@@ -0,0 +1,115 @@
+package geoip
+
+import (
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy decides which source countries may connect and counts connections
+// per country. A nil Policy allows everything.
+type Policy struct {
+	DB    *DB
+	Allow []string // if set, only these countries may connect
+	Deny  []string // countries that may not connect
+
+	stats sync.Map // country -> *countryCounter
+}
+
+type countryCounter struct {
+	accepted int64
+	rejected int64
+}
+
+// CountryStats is the number of connections seen from one country
+type CountryStats struct {
+	Country  string `json:"country"`
+	Accepted int64  `json:"accepted"`
+	Rejected int64  `json:"rejected"`
+}
+
+// Check reports whether a client connecting from addr may log in.
+// clientCountries is the client's own allow list, which replaces the global
+// policy when set. Loopback and private sources are always allowed.
+func (p *Policy) Check(addr net.Addr, clientCountries []string) (string, bool) {
+	if p == nil || p.DB == nil {
+		return "", true
+	}
+
+	ip := addrIP(addr)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return "", true
+	}
+
+	country := p.DB.Country(ip)
+
+	var ok bool
+	switch {
+	case len(clientCountries) > 0:
+		ok = slices.Contains(clientCountries, country)
+	case slices.Contains(p.Deny, country):
+		ok = false
+	case len(p.Allow) > 0:
+		ok = slices.Contains(p.Allow, country)
+	default:
+		ok = true
+	}
+
+	p.count(country, ok)
+	return country, ok
+}
+
+func (p *Policy) count(country string, accepted bool) {
+	if country == "" {
+		country = "??"
+	}
+
+	v, _ := p.stats.LoadOrStore(country, &countryCounter{})
+	c := v.(*countryCounter)
+	if accepted {
+		atomic.AddInt64(&c.accepted, 1)
+	} else {
+		atomic.AddInt64(&c.rejected, 1)
+	}
+}
+
+// Stats returns connection counts by source country since startup
+func (p *Policy) Stats() []CountryStats {
+	if p == nil {
+		return nil
+	}
+
+	var out []CountryStats
+	p.stats.Range(func(k, v any) bool {
+		c := v.(*countryCounter)
+		out = append(out, CountryStats{
+			Country:  k.(string),
+			Accepted: atomic.LoadInt64(&c.accepted),
+			Rejected: atomic.LoadInt64(&c.rejected),
+		})
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Accepted+out[i].Rejected > out[j].Accepted+out[j].Rejected
+	})
+	return out
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,100 @@
+package inproc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"slices"
+	"sync"
+)
+
+// Listener is a net.Listener whose connections are handed over by Dispatch
+// from elsewhere in the process instead of accepted from a socket, so the
+// mixed entrypoint can pass connections to the backends without a loopback
+// hop
+type Listener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  net.Addr
+}
+
+func NewListener(addr net.Addr) *Listener {
+	return &Listener{conns: make(chan net.Conn), done: make(chan struct{}), addr: addr}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Attach returns a listener accepting from l whose Close only ends its own
+// Accept calls, for servers that stop on an error and start again. Close l
+// itself when the server shuts down for good.
+func (l *Listener) Attach() net.Listener {
+	return &attached{Listener: l, done: make(chan struct{})}
+}
+
+type attached struct {
+	*Listener
+	done chan struct{}
+	once sync.Once
+}
+
+func (a *attached) Accept() (net.Conn, error) {
+	select {
+	case conn := <-a.conns:
+		return conn, nil
+	case <-a.Listener.done:
+		return nil, net.ErrClosed
+	case <-a.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (a *attached) Close() error {
+	a.once.Do(func() { close(a.done) })
+	return nil
+}
+
+// Dispatch hands conn to whoever is accepting. It fails once the listener is
+// closed, in which case the caller still owns conn.
+func (l *Listener) Dispatch(conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.done:
+		return net.ErrClosed
+	}
+}
+
+// WithPrefix returns conn with prefix put back in front of its unread data,
+// for connections whose first bytes were read to decide where they go
+func WithPrefix(conn net.Conn, prefix []byte) net.Conn {
+	if len(prefix) == 0 {
+		return conn
+	}
+	return &prefixConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(slices.Clone(prefix)), conn)}
+}
+
+type prefixConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
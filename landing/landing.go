@@ -0,0 +1,154 @@
+package landing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+// DefaultPage is the landing page shown when no template is configured
+const DefaultPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Account {{.Status}}</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 4em auto; padding: 0 1em">
+<h1>Your account has {{if eq .Status "expired"}}expired{{else}}run out of traffic{{end}}</h1>
+<p>The account <b>{{.Username}}</b> can no longer browse through this server.</p>
+{{- if .RenewURL}}
+<p><a href="{{.RenewURL}}">Renew here</a></p>
+{{- end}}
+{{- if .Support}}
+<p>Support: {{.Support}}</p>
+{{- end}}
+</body>
+</html>
+`
+
+// requestTimeout is how long a lapsed client gets to send its HTTP request
+const requestTimeout = 30 * time.Second
+
+// PageData is the value landing page templates are executed against
+type PageData struct {
+	Username string
+	Status   string // expired or out of traffic
+	RenewURL string
+	Support  string
+}
+
+type Config struct {
+	RenewURL string             // where lapsed clients renew, linked from the page
+	Page     *template.Template // landing page, nil redirects to RenewURL when set and otherwise uses DefaultPage
+	Support  string             // shown on the page
+}
+
+// Landing lets expired and out-of-traffic clients log in and answers their
+// plain HTTP requests with a renewal page instead of failing silently.
+// Other traffic, HTTPS included, is closed. A nil Landing is valid and
+// turns lapsed clients away as before.
+type Landing struct {
+	cfg       *Config
+	renewHost string // host:port of RenewURL, reachable while lapsed
+}
+
+// ParsePage validates a landing page template; an empty body selects
+// DefaultPage
+func ParsePage(body string) (*template.Template, error) {
+	if strings.TrimSpace(body) == "" {
+		body = DefaultPage
+	}
+	tmpl, err := template.New("landing").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid landing page template: %w", err)
+	}
+	return tmpl, nil
+}
+
+var defaultPage = template.Must(ParsePage(""))
+
+func New(cfg *Config) (*Landing, error) {
+	l := &Landing{cfg: cfg}
+	if cfg.RenewURL != "" {
+		u, err := url.Parse(cfg.RenewURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid renewal URL '%s': expected http(s)://host/...", cfg.RenewURL)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		l.renewHost = net.JoinHostPort(u.Hostname(), port)
+	}
+	return l, nil
+}
+
+// Admits reports whether client may log in to be shown the landing page:
+// it is enabled but expired or out of traffic
+func (l *Landing) Admits(client *models.Client) bool {
+	return l != nil && client.Enabled && !client.IsActive()
+}
+
+// Exempt reports whether dest ("host:port") is the renewal site, which
+// lapsed clients may still reach so the redirect works
+func (l *Landing) Exempt(dest string) bool {
+	return l != nil && l.renewHost != "" && strings.EqualFold(dest, l.renewHost)
+}
+
+// Serve answers one HTTP request read from conn with the landing page, or
+// a redirect to the renewal URL when there is no custom page, and closes
+// conn
+func (l *Landing) Serve(conn io.ReadWriteCloser, client *models.Client) {
+	defer conn.Close()
+	timer := time.AfterFunc(requestTimeout, func() { _ = conn.Close() })
+	defer timer.Stop()
+
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+
+	status := "expired"
+	if !client.IsExpired() {
+		status = "out of traffic"
+	}
+	tmpl := l.cfg.Page
+	if tmpl == nil {
+		tmpl = defaultPage
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, PageData{
+		Username: client.Username,
+		Status:   status,
+		RenewURL: l.cfg.RenewURL,
+		Support:  l.cfg.Support,
+	}); err != nil {
+		log.Printf("Failed to render landing page for '%s': %v", client.Username, err)
+		return
+	}
+
+	header := "HTTP/1.1 200 OK\r\n"
+	if l.cfg.Page == nil && l.cfg.RenewURL != "" {
+		header = "HTTP/1.1 302 Found\r\nLocation: " + l.cfg.RenewURL + "\r\n"
+	}
+	header += "Content-Type: text/html; charset=utf-8\r\n" +
+		"Cache-Control: no-store\r\n" +
+		"Connection: close\r\n" +
+		"Content-Length: " + strconv.Itoa(body.Len()) + "\r\n\r\n"
+	if req.Method == http.MethodHead {
+		body.Reset()
+	}
+	_, _ = io.WriteString(conn, header)
+	_, _ = conn.Write(body.Bytes())
+}
@@ -450,7 +450,12 @@ set_ports() {
 
 start()   { need_root; for svc in $(tunnel_services); do systemctl start "$svc"; done; ok "Started"; }
 stop()    { need_root; for svc in $(tunnel_services); do systemctl stop "$svc"; done; ok "Stopped"; }
-restart() { need_root; for svc in $(tunnel_services); do systemctl restart "$svc"; done; ok "Restarted"; }
+restart() {
+  need_root
+  load_conf
+  "$LIBER_BIN" restart --units "$(tunnel_services | tr ' ' ',')" --port "$LIBERSUITE_PORT"
+  ok "Restarted"
+}
 enable()  { need_root; for svc in $(tunnel_services); do systemctl enable "$svc"; done; ok "Enabled at boot"; }
 disable() { need_root; for svc in $(tunnel_services); do systemctl disable "$svc"; done; ok "Disabled at boot"; }
 
@@ -541,14 +546,14 @@ export_profile() {
   if use_dnstt && [[ ${#DOMAINS[@]} -gt 0 ]]; then
     if [[ -f "$DNSTT_DIR/server.pub" ]]; then
       PUBKEY="$(cat "$DNSTT_DIR/server.pub")"
-      ARGS+=("--domain" "${DOMAINS[0]}" "--pubkey" "$PUBKEY")
+      ARGS+=("--domain" "$(IFS=,; echo "${DOMAINS[*]}")" "--pubkey" "$PUBKEY")
     else
       warn "DNSTT public key not found: $DNSTT_DIR/server.pub"
     fi
   fi
 
   if use_slipstream && [[ ${#SLIPSTREAM_DOMAINS[@]} -gt 0 ]]; then
-    ARGS+=("--slipstream-domain" "${SLIPSTREAM_DOMAINS[0]}")
+    ARGS+=("--slipstream-domain" "$(IFS=,; echo "${SLIPSTREAM_DOMAINS[*]}")")
     if [[ -f "$SLIPSTREAM_DIR/cert.pem" ]]; then
       ARGS+=("--slipstream-cert" "$SLIPSTREAM_DIR/cert.pem")
     fi
@@ -0,0 +1,219 @@
+package locations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/geoip"
+	"github.com/libersuite-org/panel/notifier"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// What happens when a client logs in from a new location
+const (
+	ActionNotify  = "notify"  // log it and notify the admin
+	ActionDisable = "disable" // also refuse the login and disable the client until re-enabled
+)
+
+// ValidAction reports whether action is one of the Action* values
+func ValidAction(action string) bool {
+	return action == ActionNotify || action == ActionDisable
+}
+
+type Config struct {
+	DB        *gorm.DB         // where seen locations are kept
+	Auth      *authcache.Cache // told about clients disabled for a new location, nil when not caching
+	Countries *geoip.DB        // country database, nil ignores countries
+	ASNs      *geoip.DB        // ASN database, nil ignores networks
+	Action    string           // one of the Action* values
+}
+
+// Watcher remembers the countries and networks each client has logged in
+// from and flags logins from new ones, a sign of shared or resold
+// credentials. The first login of a client only records where it came from.
+// Loopback and private sources, such as the DNS tunnels, are not tracked. A
+// nil Watcher allows everything.
+type Watcher struct {
+	cfg      *Config
+	notifier *notifier.Notifier
+	mu       sync.Mutex
+	known    map[uint]map[string]bool // client ID -> recorded "kind:value" keys
+}
+
+func New(cfg *Config, n *notifier.Notifier) *Watcher {
+	return &Watcher{cfg: cfg, notifier: n, known: make(map[uint]map[string]bool)}
+}
+
+// location is one place a login came from
+type location struct {
+	kind  string
+	value string
+	label string // for messages, e.g. "AS12345 (Example ISP)"
+}
+
+func (l location) key() string { return l.kind + ":" + l.value }
+
+// Check records where client logged in from and reports whether the login
+// may go ahead, which is false only when the location is new and Action is
+// ActionDisable
+func (w *Watcher) Check(client *models.Client, addr net.Addr) bool {
+	if w == nil {
+		return true
+	}
+	seen := w.locate(addr)
+	if len(seen) == 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	known, err := w.load(client.ID)
+	if err != nil {
+		log.Printf("Failed to load locations of '%s': %v", client.Username, err)
+		return true
+	}
+	first := len(known) == 0
+
+	var fresh []location
+	for _, l := range seen {
+		if !known[l.key()] {
+			fresh = append(fresh, l)
+		}
+	}
+	if len(fresh) == 0 {
+		return true
+	}
+	if err := w.record(client.ID, fresh); err != nil {
+		log.Printf("Failed to record locations of '%s': %v", client.Username, err)
+		return true
+	}
+	for _, l := range fresh {
+		known[l.key()] = true
+	}
+	if first {
+		return true
+	}
+
+	labels := make([]string, len(fresh))
+	for i, l := range fresh {
+		labels[i] = l.label
+	}
+	message := fmt.Sprintf("Client '%s' logged in from a new location: %s", client.Username, strings.Join(labels, ", "))
+	if w.cfg.Action == ActionDisable {
+		if err := w.cfg.DB.Model(&models.Client{}).Where("id = ?", client.ID).Update("enabled", false).Error; err != nil {
+			log.Printf("Failed to disable '%s': %v", client.Username, err)
+		} else {
+			w.cfg.Auth.Invalidate(client.Username)
+			message += "; the client was disabled until re-enabled"
+		}
+	}
+	log.Println(message)
+	go w.notify(client, message, sourceAddr(addr), labels)
+
+	return w.cfg.Action != ActionDisable
+}
+
+// Invalidate drops the cached locations so they are read again from the
+// database, picking up CLI edits
+func (w *Watcher) Invalidate() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	clear(w.known)
+	w.mu.Unlock()
+}
+
+// locate returns the country and network of addr that the configured
+// databases know
+func (w *Watcher) locate(addr net.Addr) []location {
+	ip := net.ParseIP(sourceAddr(addr))
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return nil
+	}
+
+	var out []location
+	if country := w.cfg.Countries.Country(ip); country != "" {
+		out = append(out, location{kind: models.LocationCountry, value: country, label: "country " + country})
+	}
+	if asn, org := w.cfg.ASNs.ASN(ip); asn != 0 {
+		label := fmt.Sprintf("AS%d", asn)
+		if org != "" {
+			label += " (" + org + ")"
+		}
+		out = append(out, location{kind: models.LocationASN, value: strconv.FormatUint(uint64(asn), 10), label: label})
+	}
+	return out
+}
+
+// load returns the recorded location keys of a client, reading them from the
+// database on first use. w.mu must be held.
+func (w *Watcher) load(clientID uint) (map[string]bool, error) {
+	if known, ok := w.known[clientID]; ok {
+		return known, nil
+	}
+
+	var rows []models.ClientLocation
+	if err := w.cfg.DB.Where("client_id = ?", clientID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		known[r.Kind+":"+r.Value] = true
+	}
+	w.known[clientID] = known
+	return known, nil
+}
+
+func (w *Watcher) record(clientID uint, locs []location) error {
+	now := time.Now()
+	rows := make([]models.ClientLocation, len(locs))
+	for i, l := range locs {
+		rows[i] = models.ClientLocation{ClientID: clientID, Kind: l.kind, Value: l.value, FirstSeen: now}
+	}
+	return w.cfg.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+func (w *Watcher) notify(client *models.Client, message, source string, locations []string) {
+	if w.notifier == nil || !w.notifier.Enabled() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := w.notifier.Send(ctx, notifier.Event{
+		Type:     "new-location",
+		Username: client.Username,
+		Message:  message,
+		Details: map[string]any{
+			"source":    source,
+			"locations": locations,
+			"disabled":  w.cfg.Action == ActionDisable,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to send new location notification: %v", err)
+	}
+}
+
+// sourceAddr returns the IP of addr without the port
+func sourceAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,167 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/libersuite-org/panel/clock"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/units"
+)
+
+// Message kinds, each rendered from the template of the same name
+const (
+	Credentials = "credentials" // a client's login details, executed against ClientData
+	Expiry      = "expiry"      // reminder that a client expires soon, executed against ClientData
+	Alert       = "alert"       // admin notification, executed against notifier.Event
+)
+
+// Kinds lists the message kinds
+var Kinds = []string{Credentials, Expiry, Alert}
+
+// defaultTemplates are used for kinds without a template file. Templates
+// start with a "Subject:" line followed by a blank line and the body.
+var defaultTemplates = map[string]string{
+	Credentials: `Subject: Your account {{.Username}}
+
+Hello,
+
+Your account is ready.
+
+Username: {{.Username}}
+Password: {{.Password}}
+{{- if .SubURL}}
+Subscription link: {{.SubURL}}
+{{- end}}
+Traffic: {{.TrafficLimit}}
+{{- if not .ExpiresAt.IsZero}}
+Expires: {{.ExpiresAt.Format "2006-01-02"}}
+{{- end}}
+{{- if .Support}}
+
+Support: {{.Support}}
+{{- end}}
+`,
+	Expiry: `Subject: Your account {{.Username}} expires in {{.DaysLeft}} day(s)
+
+Hello,
+
+Your account {{.Username}} expires on {{.ExpiresAt.Format "2006-01-02 15:04"}}.
+Renew before then to stay connected.
+{{- if .Support}}
+
+Support: {{.Support}}
+{{- end}}
+`,
+	Alert: `Subject: Panel alert: {{.Type}}
+
+{{.Message}}
+
+Time: {{.Time.Format "2006-01-02 15:04:05 MST"}}
+`,
+}
+
+// ClientData is the value client message templates are executed against
+type ClientData struct {
+	Username     string
+	Password     string
+	SubURL       string // subscription link, empty without a public web server
+	TrafficLimit string // e.g. "50.0 GB" or "Unlimited"
+	TrafficUsed  string
+	ExpiresAt    time.Time // zero for never
+	DaysLeft     int
+	Support      string
+}
+
+// Templates renders the messages of each kind
+type Templates struct {
+	byKind map[string]*template.Template
+}
+
+// LoadTemplates reads <kind>.tmpl files from dir, using the default
+// template for missing kinds; an empty dir selects all defaults
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{byKind: make(map[string]*template.Template)}
+	for _, kind := range Kinds {
+		body := defaultTemplates[kind]
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, kind+".tmpl"))
+			if err == nil {
+				body = string(data)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to read %s email template: %w", kind, err)
+			}
+		}
+		tmpl, err := template.New(kind).Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s email template: %w", kind, err)
+		}
+		t.byKind[kind] = tmpl
+	}
+	return t, nil
+}
+
+var defaults, _ = LoadTemplates("")
+
+// Render executes the template of kind and splits off its subject
+func (t *Templates) Render(kind string, data any) (subject, body string, err error) {
+	if t == nil {
+		t = defaults
+	}
+	tmpl, ok := t.byKind[kind]
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template '%s'", kind)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s email: %w", kind, err)
+	}
+	first, rest, _ := strings.Cut(buf.String(), "\n")
+	subject, ok = strings.CutPrefix(first, "Subject:")
+	if !ok {
+		return "", "", fmt.Errorf("%s email template must start with a Subject: line", kind)
+	}
+	return strings.TrimSpace(subject), strings.TrimLeft(rest, "\r\n"), nil
+}
+
+// SendTemplate renders the message of kind for data and mails it to to
+func (m *Mailer) SendTemplate(to []string, kind string, data any) error {
+	if m == nil {
+		return errors.New("email is not configured")
+	}
+	subject, body, err := m.cfg.Templates.Render(kind, data)
+	if err != nil {
+		return err
+	}
+	return m.Send(to, subject, body)
+}
+
+// ClientData returns the template data of c
+func (m *Mailer) ClientData(c *models.Client) ClientData {
+	data := ClientData{
+		Username:     c.Username,
+		Password:     c.Password,
+		TrafficLimit: "Unlimited",
+		TrafficUsed:  units.FormatBytes(c.TrafficUsed),
+		ExpiresAt:    c.ExpiresAt,
+	}
+	if c.TrafficLimit > 0 {
+		data.TrafficLimit = units.FormatBytes(c.TrafficLimit)
+	}
+	if !c.ExpiresAt.IsZero() {
+		data.DaysLeft = max(0, int(c.ExpiresAt.Sub(clock.Now()).Hours()/24+0.5))
+	}
+	if m != nil {
+		data.Support = m.cfg.Support
+		if m.cfg.SubscriptionURL != "" && c.SubToken != "" {
+			data.SubURL = strings.TrimRight(m.cfg.SubscriptionURL, "/") + "/sub/" + c.SubToken
+		}
+	}
+	return data
+}
@@ -0,0 +1,71 @@
+package maintenance
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMessage is shown when maintenance is turned on without a message
+const DefaultMessage = "The server is under maintenance, please try again later."
+
+// Mode turns new tunnel logins away while sessions already connected carry
+// on, so a server can be drained before an upgrade. It lasts until turned off
+// or the server restarts. A nil *Mode is never on.
+type Mode struct {
+	mu      sync.RWMutex
+	on      bool
+	message string
+	since   time.Time
+}
+
+// State is a snapshot of the mode
+type State struct {
+	On      bool      `json:"on"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+func New() *Mode {
+	return &Mode{}
+}
+
+// Enable turns maintenance on with message, or DefaultMessage if empty.
+// Enabling it again only changes the message.
+func (m *Mode) Enable(message string) {
+	if message == "" {
+		message = DefaultMessage
+	}
+	m.mu.Lock()
+	if !m.on {
+		m.since = time.Now()
+	}
+	m.on, m.message = true, message
+	m.mu.Unlock()
+}
+
+// Disable turns maintenance off
+func (m *Mode) Disable() {
+	m.mu.Lock()
+	m.on, m.message, m.since = false, "", time.Time{}
+	m.mu.Unlock()
+}
+
+// Active returns the message to turn logins away with, if maintenance is on
+func (m *Mode) Active() (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.message, m.on
+}
+
+// State returns a snapshot of the mode
+func (m *Mode) State() State {
+	if m == nil {
+		return State{}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return State{On: m.on, Message: m.message, Since: m.since}
+}
@@ -0,0 +1,133 @@
+package mixedserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Protocols the entrypoint recognizes from a connection's first bytes.
+// Silent connections sent nothing within the probe timeout, as SSH clients
+// that wait for the server banner do.
+const (
+	ProtoSSH     = "ssh"
+	ProtoSOCKS5  = "socks5"
+	ProtoSOCKS4  = "socks4"
+	ProtoTLS     = "tls"
+	ProtoHTTP    = "http"
+	ProtoSilent  = "silent"
+	ProtoUnknown = "unknown"
+)
+
+// Route targets besides a host:port to forward to as is
+const (
+	TargetSSH   = "ssh"
+	TargetSOCKS = "socks"
+	TargetWeb   = "web"
+	TargetDecoy = "decoy" // the decoy website, see Config.Decoy
+	TargetDrop  = "drop"
+)
+
+// DefaultRoutes sends each protocol to the backend that speaks it. The SOCKS
+// backend only speaks SOCKS5, so SOCKS4 is dropped unless routed elsewhere.
+// Silent and unrecognized connections go to SSH, as they always have.
+var DefaultRoutes = map[string]string{
+	ProtoSSH:     TargetSSH,
+	ProtoSOCKS5:  TargetSOCKS,
+	ProtoSOCKS4:  TargetDrop,
+	ProtoTLS:     TargetDrop,
+	ProtoHTTP:    TargetWeb,
+	ProtoSilent:  TargetSSH,
+	ProtoUnknown: TargetSSH,
+}
+
+var protocols = []string{ProtoSSH, ProtoSOCKS5, ProtoSOCKS4, ProtoTLS, ProtoHTTP, ProtoSilent, ProtoUnknown}
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("HEAD"), []byte("POST"), []byte("PUT "), []byte("DELE"),
+	[]byte("CONN"), []byte("OPTI"), []byte("PATC"), []byte("TRAC"),
+}
+
+// ParseRoutes reads "protocol=target" overrides on top of DefaultRoutes.
+// A target is ssh, socks, web, decoy, drop, or a host:port.
+func ParseRoutes(specs []string) (map[string]string, error) {
+	routes := make(map[string]string, len(DefaultRoutes))
+	for proto, target := range DefaultRoutes {
+		routes[proto] = target
+	}
+
+	for _, spec := range specs {
+		proto, target, ok := strings.Cut(spec, "=")
+		proto, target = strings.TrimSpace(proto), strings.TrimSpace(target)
+		if !ok || target == "" {
+			return nil, fmt.Errorf("invalid route '%s': expected protocol=target", spec)
+		}
+		if !slices.Contains(protocols, proto) {
+			return nil, fmt.Errorf("invalid route '%s': unknown protocol '%s' (want one of %s)", spec, proto, strings.Join(protocols, ", "))
+		}
+		if !validTarget(target) {
+			return nil, fmt.Errorf("invalid route '%s': target must be ssh, socks, web, decoy, drop, or host:port", spec)
+		}
+		if proto == ProtoSOCKS4 && target == TargetSOCKS {
+			return nil, fmt.Errorf("invalid route '%s': the SOCKS backend only speaks SOCKS5", spec)
+		}
+		routes[proto] = target
+	}
+	return routes, nil
+}
+
+func validTarget(target string) bool {
+	switch target {
+	case TargetSSH, TargetSOCKS, TargetWeb, TargetDecoy, TargetDrop:
+		return true
+	}
+	_, _, err := net.SplitHostPort(target)
+	return err == nil
+}
+
+// builtIn reports whether target is one of the panel's own backends
+func builtIn(target string) bool {
+	return target == TargetSSH || target == TargetSOCKS || target == TargetWeb || target == TargetDecoy
+}
+
+// detect peeks at the first bytes of conn to name its protocol, leaving
+// them buffered in r. It waits up to timeout for the first byte and as long
+// again for enough bytes to tell SSH and HTTP apart.
+func detect(conn net.Conn, r *bufio.Reader, timeout time.Duration) (string, error) {
+	defer conn.SetReadDeadline(time.Time{})
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	first, err := r.Peek(1)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return ProtoSilent, nil
+		}
+		return "", err
+	}
+
+	switch first[0] {
+	case 0x05:
+		return ProtoSOCKS5, nil
+	case 0x04:
+		return ProtoSOCKS4, nil
+	case 0x16: // TLS handshake record
+		return ProtoTLS, nil
+	}
+
+	// A client that sent one byte sends the rest of its first line promptly
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	head, _ := r.Peek(4)
+	if bytes.Equal(head, []byte("SSH-")) {
+		return ProtoSSH, nil
+	}
+	if slices.ContainsFunc(httpMethods, func(m []byte) bool { return bytes.Equal(head, m) }) {
+		return ProtoHTTP, nil
+	}
+	return ProtoUnknown, nil
+}
@@ -1,73 +1,138 @@
 package mixedserver
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/libersuite-org/panel/bans"
+	"github.com/libersuite-org/panel/decoy"
+	"github.com/libersuite-org/panel/inproc"
+	"github.com/libersuite-org/panel/transport"
+	"github.com/libersuite-org/panel/tunnel"
 )
 
-const socksVersion5 = 0x05
+// defaultProbeTimeout is how long a client may stay silent before it is
+// taken for an SSH client waiting for the server banner
+const defaultProbeTimeout = 300 * time.Millisecond
 
 type Config struct {
-	Host        string
-	Port        int
-	BackendHost string
-	SSHPort     int
-	SOCKSPort   int
+	Hosts        []string // bind addresses, every interface when empty
+	Port         int
+	SSHPipe      *inproc.Listener    // hands SSH connections over in process, nil when SSH is disabled
+	SOCKSPipe    *inproc.Listener    // hands SOCKS connections over in process, nil when SOCKS is disabled
+	WebPipe      *inproc.Listener    // hands HTTP connections over in process, nil when the web server is disabled
+	Routes       map[string]string   // protocol to target, see ParseRoutes; nil uses DefaultRoutes
+	SNIRoutes    map[string]string   // TLS server name to target, see ParseSNIRoutes; overrides the tls route
+	TLS          *tls.Config         // decrypts TLS routed to a built-in backend, nil passes it on as is
+	Decoy        *decoy.Decoy        // answers HTTP routed to decoy, and to web while the web server is disabled
+	Transport    transport.Transport // obfuscation clients wrap their connections in, nil for none; only remote TCP clients use it
+	Upstream     transport.Transport // obfuscation wrapped around connections to host:port targets, nil for none
+	ProbeTimeout time.Duration       // how long to wait for a client to speak first, 300ms when zero
+	Bans         *bans.Guard         // drops connections from banned IPs, nil disables
+	Timeouts     *tunnel.Timeouts    // keepalive and deadlines of relayed connections
+	Limits       *tunnel.Limits      // server-wide tunnel cap for external routes, nil allows everything
 }
 
 type Server struct {
-	cfg      *Config
-	listener net.Listener
-	ctx      context.Context
-	wg       sync.WaitGroup
+	cfg       *Config
+	listeners []net.Listener
+	sessions  *tunnel.Sessions
+	wg        sync.WaitGroup
+	listening atomic.Bool
+	active    atomic.Int64 // open client connections
 }
 
 func New(cfg *Config) *Server {
-	return &Server{cfg: cfg}
+	return &Server{cfg: cfg, sessions: tunnel.NewSessions()}
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	s.ctx = ctx
-	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
-
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to start mixed listener on %s: %w", addr, err)
+	s.listeners = nil
+	for _, addr := range tunnel.ListenAddrs(s.cfg.Hosts, s.cfg.Port) {
+		listener, err := s.cfg.Timeouts.Listen(addr)
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to start mixed listener on %s: %w", addr, err)
+		}
+		log.Printf("Starting mixed SSH/SOCKS listener on %s", addr)
+		s.listeners = append(s.listeners, listener)
 	}
 
-	s.listener = listener
-	log.Printf("Starting mixed SSH/SOCKS listener on %s", addr)
+	s.listening.Store(true)
+	defer s.listening.Store(false)
 
 	go func() {
 		<-ctx.Done()
-		_ = listener.Close()
+		s.closeListeners()
 	}()
 
+	var serving sync.WaitGroup
+	for _, listener := range s.listeners {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			s.serve(ctx, listener)
+		}()
+	}
+	serving.Wait()
+	return nil
+}
+
+func (s *Server) serve(ctx context.Context, listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
-				return nil
+				return
 			}
 			log.Printf("Mixed accept error: %v", err)
 			continue
 		}
 
-		s.wg.Add(1)
-		go s.handleConnection(conn)
+		s.Serve(conn)
 	}
 }
 
-func (s *Server) Shutdown(ctx context.Context) error {
-	if s.listener != nil {
-		_ = s.listener.Close()
+// Serve routes a connection accepted elsewhere, such as a QUIC stream, as if
+// it came in on the mixed port. Shutdown waits for it like for the others.
+func (s *Server) Serve(conn net.Conn) {
+	s.wg.Add(1)
+	go s.handleConnection(conn)
+}
+
+func (s *Server) closeListeners() {
+	for _, listener := range s.listeners {
+		_ = listener.Close()
 	}
+}
+
+// Listening reports whether the server is accepting connections
+func (s *Server) Listening() bool {
+	return s != nil && s.listening.Load()
+}
+
+// Connections returns the number of open client connections
+func (s *Server) Connections() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.active.Load()
+}
+
+// Shutdown stops accepting connections and waits for the relayed ones to
+// end until ctx is done, then closes the ones left and waits for them to go.
+// Connections handed over in process are the backends' to close.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListeners()
 
 	done := make(chan struct{})
 	go func() {
@@ -79,71 +144,155 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	case <-done:
 		return nil
 	case <-ctx.Done():
+		s.sessions.CloseAll()
+		<-done
 		return ctx.Err()
 	}
 }
 
 func (s *Server) handleConnection(clientConn net.Conn) {
 	defer s.wg.Done()
-	defer clientConn.Close()
+	s.active.Add(1)
+	defer s.active.Add(-1)
 
-	buffer := make([]byte, 1)
-	hasFirstByte := false
+	// Connections handed over in process belong to the backend from then on
+	handedOver := false
+	defer func() {
+		if !handedOver {
+			_ = clientConn.Close()
+		}
+	}()
+
+	if s.cfg.Bans.Banned(clientConn.RemoteAddr()) {
+		return
+	}
 
-	_ = clientConn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
-	n, err := clientConn.Read(buffer)
-	if err == nil && n == 1 {
-		hasFirstByte = true
-	} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+	// Until it's handed over, ending the session closes the connection
+	sess := s.sessions.Open()
+	defer sess.End()
+	rawConn := clientConn
+	stop := context.AfterFunc(sess.Context(), func() { _ = rawConn.Close() })
+
+	if s.cfg.Transport != nil && external(clientConn.RemoteAddr()) {
+		clientConn = s.cfg.Transport.Server(clientConn)
+	}
+
+	timeout := s.cfg.ProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	reader := bufio.NewReaderSize(clientConn, maxHelloSize)
+	proto, err := detect(clientConn, reader, timeout)
+	if err != nil {
 		if err != io.EOF {
 			log.Printf("Mixed read probe error: %v", err)
 		}
 		return
 	}
-	_ = clientConn.SetReadDeadline(time.Time{})
 
-	targetPort := s.cfg.SSHPort
-	if hasFirstByte && buffer[0] == socksVersion5 {
-		targetPort = s.cfg.SOCKSPort
+	routes := s.cfg.Routes
+	if routes == nil {
+		routes = DefaultRoutes
 	}
+	target := routes[proto]
 
-	targetAddr := net.JoinHostPort(s.cfg.BackendHost, fmt.Sprintf("%d", targetPort))
-	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
-	if err != nil {
-		log.Printf("Mixed dial backend %s failed: %v", targetAddr, err)
+	if proto == ProtoTLS && len(s.cfg.SNIRoutes) > 0 {
+		name, err := readServerName(clientConn, reader, timeout)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Mixed read ClientHello error: %v", err)
+			}
+			return
+		}
+		if sniTarget, ok := matchSNI(s.cfg.SNIRoutes, name); ok {
+			target = sniTarget
+		}
+	}
+
+	// Whatever the probes read goes ahead of the rest of the stream
+	prefix, _ := reader.Peek(reader.Buffered())
+
+	if proto == ProtoTLS && builtIn(target) && s.cfg.TLS != nil {
+		tlsConn, err := s.decrypt(inproc.WithPrefix(clientConn, prefix))
+		if err != nil {
+			log.Printf("Mixed TLS handshake with %s failed: %v", clientConn.RemoteAddr(), err)
+			return
+		}
+		clientConn, prefix = tlsConn, nil
+	}
+
+	var pipe *inproc.Listener
+	switch target {
+	case TargetSSH:
+		pipe = s.cfg.SSHPipe
+	case TargetSOCKS:
+		pipe = s.cfg.SOCKSPipe
+	case TargetWeb:
+		pipe = s.cfg.WebPipe
+		if pipe == nil && s.cfg.Decoy != nil {
+			target = TargetDecoy
+		}
+	case TargetDrop, "":
 		return
 	}
-	defer targetConn.Close()
 
-	if hasFirstByte {
-		if _, err := targetConn.Write(buffer); err != nil {
-			log.Printf("Mixed forward first byte to %s failed: %v", targetAddr, err)
+	// Probes get a website rather than a closed connection
+	if target == TargetDecoy {
+		s.cfg.Decoy.ServeConn(s.cfg.Timeouts.Wrap(inproc.WithPrefix(clientConn, prefix)))
+		return
+	}
+
+	// Built-in backends are handed the connection in process, so they see
+	// the client's address without trusting anything a socket tells them
+	if builtIn(target) {
+		if pipe == nil || !stop() {
+			return
+		}
+		if err := pipe.Dispatch(inproc.WithPrefix(clientConn, prefix)); err != nil {
 			return
 		}
+		handedOver = true
+		return
 	}
 
-	var closeOnce sync.Once
-	closeBoth := func() {
-		closeOnce.Do(func() {
-			_ = clientConn.Close()
-			_ = targetConn.Close()
-		})
+	// Everything else is a host:port target relayed as is
+	if !s.cfg.Limits.Acquire() {
+		log.Printf("Mixed refusing %s to %s: server connection limit reached", clientConn.RemoteAddr(), target)
+		return
 	}
+	defer s.cfg.Limits.Release()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	targetConn, err := s.cfg.Timeouts.Dialer(10*time.Second).DialContext(sess.Context(), "tcp", target)
+	if err != nil {
+		log.Printf("Mixed dial %s failed: %v", target, err)
+		return
+	}
+	defer targetConn.Close()
+	if s.cfg.Upstream != nil {
+		targetConn = s.cfg.Upstream.Client(targetConn)
+	}
 
-	go func() {
-		defer wg.Done()
-		_, _ = io.Copy(targetConn, clientConn)
-		closeBoth()
-	}()
+	if len(prefix) > 0 {
+		if _, err := targetConn.Write(prefix); err != nil {
+			log.Printf("Mixed forward first bytes to %s failed: %v", target, err)
+			return
+		}
+	}
 
-	go func() {
-		defer wg.Done()
-		_, _ = io.Copy(clientConn, targetConn)
-		closeBoth()
-	}()
+	clientConn = s.cfg.Timeouts.Wrap(clientConn)
+
+	// The probe's bytes were sent above and nothing else is buffered, so
+	// the upload reads the socket directly and TCP to TCP can splice
+	tunnel.Relay(sess.Context(),
+		func() { _, _ = tunnel.Copy(targetConn, clientConn) },
+		func() { _, _ = tunnel.Copy(clientConn, targetConn) },
+		clientConn, targetConn)
+}
 
-	wg.Wait()
+// external reports whether addr is a remote TCP client. Local sources, such
+// as a DNS tunnel forwarding its sessions, and QUIC streams, encrypted
+// already, are not.
+func external(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && !tcpAddr.IP.IsLoopback()
 }
@@ -0,0 +1,160 @@
+package mixedserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// maxHelloSize is the largest ClientHello read for its server name: one
+// full TLS record
+const maxHelloSize = 5 + 16384
+
+// handshakeTimeout bounds the TLS handshake of connections decrypted for
+// built-in backends
+const handshakeTimeout = 10 * time.Second
+
+// ParseSNIRoutes reads "hostname=target" routes for TLS connections by the
+// server name they ask for. "*.example.com" matches every subdomain of
+// example.com; targets are as in ParseRoutes. Names without a route follow
+// the tls protocol route.
+func ParseSNIRoutes(specs []string) (map[string]string, error) {
+	routes := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, target, ok := strings.Cut(spec, "=")
+		name, target = normalizeName(name), strings.TrimSpace(target)
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid SNI route '%s': expected hostname=target", spec)
+		}
+		if strings.ContainsAny(name, ":/ ") || strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return nil, fmt.Errorf("invalid SNI route '%s': '%s' is not a hostname", spec, name)
+		}
+		if !validTarget(target) {
+			return nil, fmt.Errorf("invalid SNI route '%s': target must be ssh, socks, web, decoy, drop, or host:port", spec)
+		}
+		routes[name] = target
+	}
+	return routes, nil
+}
+
+// NeedsCertificate reports whether any of routes sends TLS to a built-in
+// backend or the decoy, which only speak it once the entrypoint decrypts it
+func NeedsCertificate(routes map[string]string) bool {
+	for _, target := range routes {
+		if builtIn(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// matchSNI returns the route for name: an exact match, else the closest
+// wildcard
+func matchSNI(routes map[string]string, name string) (string, bool) {
+	name = normalizeName(name)
+	if name == "" {
+		return "", false
+	}
+	if target, ok := routes[name]; ok {
+		return target, true
+	}
+	for rest := name; ; {
+		_, parent, ok := strings.Cut(rest, ".")
+		if !ok {
+			return "", false
+		}
+		if target, ok := routes["*."+parent]; ok {
+			return target, true
+		}
+		rest = parent
+	}
+}
+
+// readServerName peeks at the ClientHello buffered in r and returns the
+// server name it asks for, "" when it has none or doesn't fit in one
+// record. The bytes stay buffered.
+func readServerName(conn net.Conn, r *bufio.Reader, timeout time.Duration) (string, error) {
+	defer conn.SetReadDeadline(time.Time{})
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	header, err := r.Peek(5)
+	if err != nil {
+		return "", err
+	}
+	length := int(header[3])<<8 | int(header[4])
+	if 5+length > r.Size() {
+		return "", nil
+	}
+	record, err := r.Peek(5 + length)
+	if err != nil {
+		return "", err
+	}
+	return parseServerName(record[5:]), nil
+}
+
+// parseServerName extracts the server_name extension from a ClientHello
+// handshake message
+func parseServerName(msg []byte) string {
+	s := cryptobyte.String(msg)
+	var msgType uint8
+	var hello cryptobyte.String
+	if !s.ReadUint8(&msgType) || msgType != 1 || !s.ReadUint24LengthPrefixed(&hello) {
+		return ""
+	}
+
+	var sessionID, suites, compression, extensions cryptobyte.String
+	if !hello.Skip(2+32) || // version and random
+		!hello.ReadUint8LengthPrefixed(&sessionID) ||
+		!hello.ReadUint16LengthPrefixed(&suites) ||
+		!hello.ReadUint8LengthPrefixed(&compression) ||
+		!hello.ReadUint16LengthPrefixed(&extensions) {
+		return ""
+	}
+
+	for !extensions.Empty() {
+		var extType uint16
+		var ext cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&ext) {
+			return ""
+		}
+		if extType != 0 { // server_name
+			continue
+		}
+		var names cryptobyte.String
+		if !ext.ReadUint16LengthPrefixed(&names) {
+			return ""
+		}
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return ""
+			}
+			if nameType == 0 { // host_name
+				return string(name)
+			}
+		}
+	}
+	return ""
+}
+
+// decrypt completes the TLS handshake on conn and returns the plaintext
+// stream for a built-in backend
+func (s *Server) decrypt(conn net.Conn) (net.Conn, error) {
+	tlsConn := tls.Server(conn, s.cfg.TLS)
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
@@ -0,0 +1,134 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/mailer"
+)
+
+// Event is a notification about a client or the server
+type Event struct {
+	Type     string    `json:"event"`
+	Username string    `json:"username,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+	Details  any       `json:"details,omitempty"`
+}
+
+type Config struct {
+	WebhookURL    string
+	TelegramToken string
+	TelegramChat  string
+	Mailer        *mailer.Mailer // sends the alert email to Emails
+	Emails        []string
+}
+
+// Notifier delivers events to the configured webhook, Telegram chat, and
+// email addresses
+type Notifier struct {
+	cfg    *Config
+	client *http.Client
+}
+
+func New(cfg *Config) *Notifier {
+	return &Notifier{cfg: cfg, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Enabled reports whether any delivery channel is configured
+func (n *Notifier) Enabled() bool {
+	return n.cfg.WebhookURL != "" || (n.cfg.TelegramToken != "" && n.cfg.TelegramChat != "") || n.emails()
+}
+
+// Send delivers e to every configured channel and returns the first error
+func (n *Notifier) Send(ctx context.Context, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	var errs []string
+	if n.cfg.WebhookURL != "" {
+		if err := n.sendWebhook(ctx, e); err != nil {
+			errs = append(errs, fmt.Sprintf("webhook: %v", err))
+		}
+	}
+	if n.cfg.TelegramToken != "" && n.cfg.TelegramChat != "" {
+		if err := n.SendTelegram(ctx, e.Message); err != nil {
+			errs = append(errs, fmt.Sprintf("telegram: %v", err))
+		}
+	}
+	if n.emails() {
+		if err := n.cfg.Mailer.SendTemplate(n.cfg.Emails, mailer.Alert, e); err != nil {
+			errs = append(errs, fmt.Sprintf("email: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notification failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (n *Notifier) emails() bool {
+	return n.cfg.Mailer.Enabled() && len(n.cfg.Emails) > 0
+}
+
+func (n *Notifier) sendWebhook(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return n.do(req)
+}
+
+// SendTelegram posts a plain text message to the configured chat
+func (n *Notifier) SendTelegram(ctx context.Context, text string) error {
+	return n.SendTelegramTo(ctx, n.cfg.TelegramChat, text)
+}
+
+// SendTelegramTo posts a plain text message to chat with the configured bot
+func (n *Notifier) SendTelegramTo(ctx context.Context, chat, text string) error {
+	if n.cfg.TelegramToken == "" {
+		return fmt.Errorf("no Telegram bot token configured")
+	}
+	form := url.Values{}
+	form.Set("chat_id", chat)
+	form.Set("text", text)
+
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.cfg.TelegramToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return n.do(req)
+}
+
+func (n *Notifier) do(req *http.Request) error {
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// Fulfill marks the payment orderID in db paid and puts its client on the plan,
+// creating the client when it doesn't exist and otherwise renewing it: the
+// plan's duration is added to the time it has left and its traffic is reset.
+// It reports false for an order already paid, so repeated callbacks are
+// harmless. Late confirmations of failed orders are honored.
+func Fulfill(db *gorm.DB, orderID string) (*models.Payment, bool, error) {
+	var payment models.Payment
+	fulfilled := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("order_id = ?", orderID).First(&payment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w '%s'", ErrUnknownOrder, orderID)
+			}
+			return err
+		}
+		if payment.Status == models.PaymentPaid {
+			return nil
+		}
+
+		var plan models.Plan
+		if err := tx.First(&plan, payment.PlanID).Error; err != nil {
+			return fmt.Errorf("plan of order '%s' no longer exists", orderID)
+		}
+
+		now := time.Now()
+		var client models.Client
+		err := tx.Where("username = ?", payment.Username).First(&client).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			client = models.Client{
+				Username:    payment.Username,
+				Password:    payment.Password,
+				SubToken:    payment.SubToken,
+				Enabled:     true,
+				LastResetAt: now,
+			}
+			plan.ApplyTo(&client)
+			client.ExpiresAt = expiresAfter(now, plan.DurationDays, now)
+			if err := tx.Create(&client).Error; err != nil {
+				return fmt.Errorf("failed to create client: %w", err)
+			}
+		case err != nil:
+			return err
+		default:
+			if client.ResetDay == 0 && plan.ResetDay > 0 {
+				client.LastResetAt = now
+			}
+			plan.ApplyTo(&client)
+			client.ExpiresAt = expiresAfter(client.ExpiresAt, plan.DurationDays, now)
+			client.ActivateDays = 0
+			client.TrafficUsed = 0
+			client.Enabled = true
+			client.NotifiedExpiry = false
+			client.NotifiedQuota = false
+			columns := []string{"plan_id", "traffic_limit", "speed_limit", "max_connections", "reset_day", "quota_action", "quota_rate", "quota_allow",
+				"protocols", "last_reset_at", "expires_at", "activate_days", "traffic_used", "enabled", "notified_expiry", "notified_quota"}
+			if err := tx.Model(&client).Select(columns).Updates(&client).Error; err != nil {
+				return fmt.Errorf("failed to renew client: %w", err)
+			}
+		}
+
+		payment.Status = models.PaymentPaid
+		payment.PaidAt = now
+		if err := tx.Model(&payment).Select("status", "paid_at").Updates(&payment).Error; err != nil {
+			return err
+		}
+		fulfilled = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &payment, fulfilled, nil
+}
@@ -0,0 +1,132 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+const nowPaymentsAPI = "https://api.nowpayments.io/v1"
+
+// NOWPayments takes crypto payments through NOWPayments invoices. The buyer
+// pays on the invoice page and NOWPayments reports the outcome with signed
+// IPN callbacks.
+type NOWPayments struct {
+	apiKey    string
+	ipnSecret string
+	client    *http.Client
+}
+
+func NewNOWPayments(apiKey, ipnSecret string) (*NOWPayments, error) {
+	if apiKey == "" || ipnSecret == "" {
+		return nil, errors.New("NOWPayments needs both an API key and an IPN secret")
+	}
+	return &NOWPayments{
+		apiKey:    apiKey,
+		ipnSecret: ipnSecret,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *NOWPayments) Name() string {
+	return "nowpayments"
+}
+
+func (p *NOWPayments) CreateInvoice(ctx context.Context, inv *Invoice) (string, string, error) {
+	body, err := json.Marshal(map[string]any{
+		"price_amount":      json.Number(inv.Payment.Amount),
+		"price_currency":    strings.ToLower(inv.Payment.Currency),
+		"order_id":          inv.Payment.OrderID,
+		"order_description": inv.Description,
+		"ipn_callback_url":  inv.CallbackURL,
+		"success_url":       inv.SuccessURL,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, nowPaymentsAPI+"/invoice", bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", "", fmt.Errorf("NOWPayments returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var invoice struct {
+		ID         json.Number `json:"id"`
+		InvoiceURL string      `json:"invoice_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&invoice); err != nil {
+		return "", "", fmt.Errorf("failed to decode NOWPayments invoice: %w", err)
+	}
+	if invoice.InvoiceURL == "" {
+		return "", "", errors.New("NOWPayments returned no invoice URL")
+	}
+	return invoice.ID.String(), invoice.InvoiceURL, nil
+}
+
+// ParseWebhook verifies an IPN callback: x-nowpayments-sig is the
+// HMAC-SHA512 of the body re-serialized with sorted keys
+func (p *NOWPayments) ParseWebhook(r *http.Request, body []byte) (*Update, error) {
+	sig, err := hex.DecodeString(r.Header.Get("x-nowpayments-sig"))
+	if err != nil || len(sig) == 0 {
+		return nil, ErrSignature
+	}
+
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid IPN body: %w", err)
+	}
+	// encoding/json writes map keys sorted, like the JSON.stringify of
+	// sorted objects NOWPayments signs
+	var sorted bytes.Buffer
+	enc := json.NewEncoder(&sorted)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(payload); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha512.New, []byte(p.ipnSecret))
+	mac.Write(bytes.TrimRight(sorted.Bytes(), "\n"))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return nil, ErrSignature
+	}
+
+	var ipn struct {
+		OrderID string `json:"order_id"`
+		Status  string `json:"payment_status"`
+	}
+	if err := json.Unmarshal(body, &ipn); err != nil {
+		return nil, fmt.Errorf("invalid IPN body: %w", err)
+	}
+	switch ipn.Status {
+	case "finished":
+		return &Update{OrderID: ipn.OrderID, Status: models.PaymentPaid}, nil
+	case "failed", "expired", "refunded":
+		return &Update{OrderID: ipn.OrderID, Status: models.PaymentFailed}, nil
+	}
+	// waiting, confirming, confirmed, sending and partially_paid are
+	// steps on the way
+	return nil, nil
+}
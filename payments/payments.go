@@ -0,0 +1,251 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/crypto"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/notifier"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown payment provider")
+	ErrUnknownOrder    = errors.New("unknown order")
+	ErrSignature       = errors.New("invalid webhook signature")
+)
+
+// Provider verifies the callbacks a payment gateway sends when an invoice
+// changes state
+type Provider interface {
+	Name() string
+	// ParseWebhook checks the signature of a callback and returns the
+	// update it carries, or nil for callbacks that change nothing
+	ParseWebhook(r *http.Request, body []byte) (*Update, error)
+}
+
+// Invoicer is a Provider that also creates invoices with a payment page.
+// Orders for other providers are created by the shop in front of them,
+// which passes the order ID on.
+type Invoicer interface {
+	Provider
+	CreateInvoice(ctx context.Context, inv *Invoice) (id, payURL string, err error)
+}
+
+// Invoice is what an Invoicer needs to bill a payment
+type Invoice struct {
+	Payment     *models.Payment
+	Description string
+	CallbackURL string // where the gateway reports the outcome
+	SuccessURL  string // where the buyer is sent after paying
+}
+
+// Update is a payment state change reported by a gateway
+type Update struct {
+	OrderID string
+	Status  string // one of the models.Payment* statuses
+}
+
+type Config struct {
+	DB        *gorm.DB         // plans, payments, and the clients they create or renew
+	Auth      *authcache.Cache // told about renewed clients, nil when not caching
+	Providers []Provider
+	PublicURL string             // base URL of the web server, for callback and success links
+	Notifier  *notifier.Notifier // told about confirmed payments, nil disables
+}
+
+// Service creates invoices for plans and creates or renews clients when
+// gateways confirm them. A nil Service has no providers.
+type Service struct {
+	cfg       *Config
+	providers map[string]Provider
+}
+
+func New(cfg *Config) (*Service, error) {
+	if _, err := url.Parse(cfg.PublicURL); err != nil || !strings.HasPrefix(cfg.PublicURL, "http") {
+		return nil, fmt.Errorf("invalid public URL '%s': expected http(s)://host[:port]", cfg.PublicURL)
+	}
+	s := &Service{cfg: cfg, providers: make(map[string]Provider, len(cfg.Providers))}
+	for _, p := range cfg.Providers {
+		s.providers[p.Name()] = p
+	}
+	return s, nil
+}
+
+// Providers returns the names of the configured providers
+func (s *Service) Providers() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.cfg.Providers))
+	for _, p := range s.cfg.Providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Request asks for an invoice for a plan
+type Request struct {
+	Provider string
+	Plan     string // plan name
+	Username string // client to renew or create, empty creates one with a random username
+	Amount   string // decimal, e.g. "4.99"
+	Currency string
+}
+
+// CreateInvoice records a pending payment for req and, for an Invoicer,
+// creates the gateway invoice
+func (s *Service) CreateInvoice(ctx context.Context, req *Request) (*models.Payment, error) {
+	if s == nil {
+		return nil, errors.New("payments are not enabled on this server")
+	}
+	provider, ok := s.providers[req.Provider]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s' (configured: %s)", ErrUnknownProvider, req.Provider, strings.Join(s.Providers(), ", "))
+	}
+	if amount, err := strconv.ParseFloat(req.Amount, 64); err != nil || amount <= 0 {
+		return nil, fmt.Errorf("invalid amount '%s'", req.Amount)
+	}
+	if req.Currency == "" {
+		return nil, errors.New("currency is required")
+	}
+
+	var plan models.Plan
+	if err := s.cfg.DB.Where("name = ?", req.Plan).First(&plan).Error; err != nil {
+		return nil, fmt.Errorf("plan '%s' not found", req.Plan)
+	}
+
+	orderID, err := crypto.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	payment := &models.Payment{
+		OrderID:  orderID,
+		Provider: provider.Name(),
+		PlanID:   plan.ID,
+		Username: req.Username,
+		Amount:   req.Amount,
+		Currency: strings.ToUpper(req.Currency),
+		Status:   models.PaymentPending,
+	}
+
+	// A new client gets its credentials now so its subscription link can be
+	// the page the buyer lands on after paying
+	var client models.Client
+	if req.Username == "" || s.cfg.DB.Where("username = ?", req.Username).First(&client).Error != nil {
+		if payment.Username == "" {
+			if payment.Username, err = crypto.RandomString(8, crypto.UsernameAlphabet); err != nil {
+				return nil, err
+			}
+		}
+		if payment.Password, err = crypto.RandomString(12, crypto.PasswordAlphabet); err != nil {
+			return nil, err
+		}
+		if payment.SubToken, err = crypto.RandomToken(16); err != nil {
+			return nil, err
+		}
+		client.SubToken = payment.SubToken
+	}
+
+	if err := s.cfg.DB.Create(payment).Error; err != nil {
+		return nil, fmt.Errorf("failed to record payment: %w", err)
+	}
+
+	invoicer, ok := provider.(Invoicer)
+	if !ok {
+		return payment, nil
+	}
+	base := strings.TrimRight(s.cfg.PublicURL, "/")
+	id, payURL, err := invoicer.CreateInvoice(ctx, &Invoice{
+		Payment:     payment,
+		Description: fmt.Sprintf("%s for %s", plan.Name, payment.Username),
+		CallbackURL: base + "/payments/" + provider.Name() + "/webhook",
+		SuccessURL:  base + "/sub/" + client.SubToken,
+	})
+	if err != nil {
+		s.cfg.DB.Model(payment).Update("status", models.PaymentFailed)
+		return nil, fmt.Errorf("failed to create invoice: %w", err)
+	}
+	payment.InvoiceID, payment.PayURL = id, payURL
+	if err := s.cfg.DB.Model(payment).Select("invoice_id", "pay_url").Updates(payment).Error; err != nil {
+		return nil, fmt.Errorf("failed to record invoice: %w", err)
+	}
+	return payment, nil
+}
+
+// HandleWebhook verifies a callback from the named provider and applies it
+func (s *Service) HandleWebhook(ctx context.Context, name string, r *http.Request, body []byte) error {
+	if s == nil {
+		return ErrUnknownProvider
+	}
+	provider, ok := s.providers[name]
+	if !ok {
+		return ErrUnknownProvider
+	}
+	update, err := provider.ParseWebhook(r, body)
+	if err != nil || update == nil {
+		return err
+	}
+
+	switch update.Status {
+	case models.PaymentPaid:
+		payment, fulfilled, err := Fulfill(s.cfg.DB, update.OrderID)
+		if err != nil || !fulfilled {
+			return err
+		}
+		s.cfg.Auth.Invalidate(payment.Username)
+		log.Printf("Payment %s confirmed by %s, client '%s' is on plan %d", payment.OrderID, name, payment.Username, payment.PlanID)
+		s.notify(ctx, payment)
+	case models.PaymentFailed:
+		result := s.cfg.DB.Model(&models.Payment{}).
+			Where("order_id = ? AND status = ?", update.OrderID, models.PaymentPending).
+			Update("status", models.PaymentFailed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Payment %s failed at %s", update.OrderID, name)
+		}
+	}
+	return nil
+}
+
+func (s *Service) notify(ctx context.Context, payment *models.Payment) {
+	if s.cfg.Notifier == nil || !s.cfg.Notifier.Enabled() {
+		return
+	}
+	err := s.cfg.Notifier.Send(ctx, notifier.Event{
+		Type:     "payment",
+		Username: payment.Username,
+		Message:  fmt.Sprintf("Payment of %s %s received from '%s'", payment.Amount, payment.Currency, payment.Username),
+		Details: map[string]any{
+			"order_id": payment.OrderID,
+			"provider": payment.Provider,
+			"plan_id":  payment.PlanID,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to send payment notification: %v", err)
+	}
+}
+
+// expiresAfter returns the expiry of a client renewed for days from now,
+// stacked on time it still has left; 0 days never expires
+func expiresAfter(current time.Time, days int, now time.Time) time.Time {
+	if days == 0 {
+		return time.Time{}
+	}
+	if current.Before(now) {
+		current = now
+	}
+	return current.AddDate(0, 0, days)
+}
@@ -0,0 +1,61 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+// Webhook accepts callbacks from any shop or gateway bridge that signs them
+// with a shared secret. The body is {"order_id": "...", "status": "paid"},
+// status being one of the models.Payment* statuses, and the X-Signature
+// header holds the hex HMAC-SHA256 of the raw body, optionally prefixed
+// with "sha256=".
+type Webhook struct {
+	secret string
+}
+
+func NewWebhook(secret string) (*Webhook, error) {
+	if secret == "" {
+		return nil, errors.New("the payment webhook needs a secret")
+	}
+	return &Webhook{secret: secret}, nil
+}
+
+func (p *Webhook) Name() string {
+	return "webhook"
+}
+
+func (p *Webhook) ParseWebhook(r *http.Request, body []byte) (*Update, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("X-Signature"), "sha256="))
+	if err != nil || len(sig) == 0 {
+		return nil, ErrSignature
+	}
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return nil, ErrSignature
+	}
+
+	var update struct {
+		OrderID string `json:"order_id"`
+		Status  string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, fmt.Errorf("invalid webhook body: %w", err)
+	}
+	switch update.Status {
+	case models.PaymentPaid, models.PaymentFailed:
+		return &Update{OrderID: update.OrderID, Status: update.Status}, nil
+	case models.PaymentPending:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("invalid status '%s'", update.Status)
+}
@@ -0,0 +1,239 @@
+package quicserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libersuite-org/panel/bans"
+	"github.com/libersuite-org/panel/tunnel"
+	"github.com/quic-go/quic-go"
+)
+
+// ALPN is the application protocol clients negotiate in the QUIC handshake
+const ALPN = "libersuite"
+
+const (
+	// idleTimeout closes connections that lost their peer; clients keep
+	// theirs open with keepalives
+	idleTimeout     = 60 * time.Second
+	keepAlivePeriod = 20 * time.Second
+)
+
+// Error codes sent when closing connections and resetting streams
+const (
+	codeNoError  quic.ApplicationErrorCode = 0
+	codeShutdown quic.ApplicationErrorCode = 1
+	codeBanned   quic.ApplicationErrorCode = 2
+)
+
+type Config struct {
+	Hosts   []string // bind addresses, every interface when empty
+	Port    int
+	TLS     *tls.Config    // certificate of the QUIC handshake; NextProtos is set to ALPN
+	Handler func(net.Conn) // takes over each stream, normally the mixed entrypoint's Serve
+	Bans    *bans.Guard    // drops connections from banned IPs, nil disables
+}
+
+// Server accepts QUIC connections on UDP and hands each stream a client
+// opens to Handler as a net.Conn, whose RemoteAddr is the client's UDP
+// address. Streams so go through the same detection, auth, and accounting
+// as TCP connections to the mixed port, while QUIC's loss recovery copes
+// better with lossy links than TCP does.
+type Server struct {
+	cfg        *Config
+	transports []*quic.Transport
+	listeners  []*quic.Listener
+	listening  atomic.Bool
+	active     atomic.Int64 // open QUIC connections
+
+	mu      sync.Mutex
+	closing bool
+	streams sync.WaitGroup // streams not yet closed by their handler
+}
+
+func New(cfg *Config) *Server {
+	return &Server{cfg: cfg}
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	tlsConf := s.cfg.TLS.Clone()
+	tlsConf.NextProtos = []string{ALPN}
+	quicConf := &quic.Config{
+		MaxIdleTimeout:  idleTimeout,
+		KeepAlivePeriod: keepAlivePeriod,
+	}
+
+	s.transports, s.listeners = nil, nil
+	for _, addr := range tunnel.ListenAddrs(s.cfg.Hosts, s.cfg.Port) {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			s.closeTransports()
+			return fmt.Errorf("failed to start QUIC listener on %s: %w", addr, err)
+		}
+		conn, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			s.closeTransports()
+			return fmt.Errorf("failed to start QUIC listener on %s: %w", addr, err)
+		}
+		// Listening on our own Transport keeps accepted connections open
+		// when the listener closes, so they can drain on shutdown
+		tr := &quic.Transport{Conn: conn}
+		s.transports = append(s.transports, tr)
+		listener, err := tr.Listen(tlsConf, quicConf)
+		if err != nil {
+			s.closeTransports()
+			return fmt.Errorf("failed to start QUIC listener on %s: %w", addr, err)
+		}
+		log.Printf("Starting QUIC listener on %s/udp", addr)
+		s.listeners = append(s.listeners, listener)
+	}
+
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	go func() {
+		<-ctx.Done()
+		s.closeListeners()
+	}()
+
+	var serving sync.WaitGroup
+	for _, listener := range s.listeners {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			s.serve(ctx, listener)
+		}()
+	}
+	serving.Wait()
+	return nil
+}
+
+func (s *Server) serve(ctx context.Context, listener *quic.Listener) {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) || ctx.Err() != nil {
+				return
+			}
+			log.Printf("QUIC accept error: %v", err)
+			continue
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection hands the streams of conn to the handler until either
+// side closes it
+func (s *Server) handleConnection(conn *quic.Conn) {
+	if s.cfg.Bans.Banned(conn.RemoteAddr()) {
+		_ = conn.CloseWithError(codeBanned, "")
+		return
+	}
+	s.active.Add(1)
+	defer s.active.Add(-1)
+
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			stream.CancelRead(quic.StreamErrorCode(codeShutdown))
+			stream.CancelWrite(quic.StreamErrorCode(codeShutdown))
+			continue
+		}
+		s.streams.Add(1)
+		s.mu.Unlock()
+
+		s.cfg.Handler(&streamConn{Stream: stream, conn: conn, done: s.streams.Done})
+	}
+}
+
+func (s *Server) closeListeners() {
+	for _, listener := range s.listeners {
+		_ = listener.Close()
+	}
+}
+
+func (s *Server) closeTransports() {
+	for _, tr := range s.transports {
+		_ = tr.Close()
+	}
+}
+
+// Listening reports whether the server is accepting connections
+func (s *Server) Listening() bool {
+	return s != nil && s.listening.Load()
+}
+
+// Connections returns the number of open QUIC connections
+func (s *Server) Connections() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.active.Load()
+}
+
+// Shutdown stops accepting connections and streams, waits for the open
+// streams to close until ctx is done, and then closes every connection
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListeners()
+
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.streams.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.closeTransports()
+	return err
+}
+
+// streamConn is a QUIC stream seen as a net.Conn, addressed like the
+// connection it belongs to
+type streamConn struct {
+	*quic.Stream
+	conn *quic.Conn
+	once sync.Once
+	done func()
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes both directions of the stream, unlike quic.Stream's Close
+// which only ends the sending side
+func (c *streamConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.Stream.CancelRead(quic.StreamErrorCode(codeNoError))
+		err = c.Stream.Close()
+		c.done()
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package reports
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/units"
+	"gorm.io/gorm"
+)
+
+const (
+	// listLimit caps the clients named in each section
+	listLimit = 10
+	// expiringWithin is how far ahead "expiring soon" looks
+	expiringWithin = 7 * 24 * time.Hour
+)
+
+// Report periods
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// Consumer is a client and its traffic over the report period
+type Consumer struct {
+	Username string `json:"username"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Expiring is a client that expires soon
+type Expiring struct {
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Report summarizes the whole days from Since up to Until
+type Report struct {
+	Period        string           `json:"period"`
+	Since         time.Time        `json:"since"`
+	Until         time.Time        `json:"until"`
+	NewClients    int64            `json:"new_clients"`
+	NewNames      []string         `json:"new_names"`
+	Expiring      []Expiring       `json:"expiring"` // within the next 7 days
+	TopConsumers  []Consumer       `json:"top_consumers"`
+	TotalTraffic  int64            `json:"total_traffic"`
+	FailuresSince time.Time        `json:"failures_since"`
+	AuthFailures  map[string]int64 `json:"auth_failures"` // by service, since FailuresSince
+}
+
+// build reads the report for the whole days of period before now from db
+func build(db *gorm.DB, period string, now time.Time) (*Report, error) {
+	days := 1
+	switch period {
+	case Daily:
+	case Weekly:
+		days = 7
+	default:
+		return nil, fmt.Errorf("unknown report period '%s' (want daily or weekly)", period)
+	}
+	until := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	r := &Report{Period: period, Since: until.AddDate(0, 0, -days), Until: until}
+
+	if err := db.Model(&models.Client{}).Where("created_at >= ? AND created_at < ?", r.Since, r.Until).Count(&r.NewClients).Error; err != nil {
+		return nil, fmt.Errorf("failed to count new clients: %w", err)
+	}
+	db.Model(&models.Client{}).Where("created_at >= ? AND created_at < ?", r.Since, r.Until).
+		Order("created_at").Limit(listLimit).Pluck("username", &r.NewNames)
+
+	var expiring []models.Client
+	db.Select("username", "expires_at").
+		Where("enabled = ? AND expires_at > ? AND expires_at <= ?", true, now, now.Add(expiringWithin)).
+		Order("expires_at").Limit(listLimit).Find(&expiring)
+	for _, c := range expiring {
+		r.Expiring = append(r.Expiring, Expiring{Username: c.Username, ExpiresAt: c.ExpiresAt})
+	}
+
+	first, last := r.Since.Format(models.TrafficDayFormat), r.Until.Format(models.TrafficDayFormat)
+	inPeriod := db.Model(&models.TrafficLog{}).Where("day >= ? AND day < ?", first, last)
+	if err := inPeriod.Select("COALESCE(SUM(bytes), 0)").Scan(&r.TotalTraffic).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum traffic: %w", err)
+	}
+	err := db.Model(&models.TrafficLog{}).
+		Select("clients.username AS username, SUM(traffic_logs.bytes) AS bytes").
+		Joins("JOIN clients ON clients.id = traffic_logs.client_id").
+		Where("traffic_logs.day >= ? AND traffic_logs.day < ?", first, last).
+		Group("clients.username").Order("bytes DESC").Limit(listLimit).
+		Scan(&r.TopConsumers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank consumers: %w", err)
+	}
+	return r, nil
+}
+
+// Subject is the email subject of the report
+func (r *Report) Subject() string {
+	if r.Period == Weekly {
+		return fmt.Sprintf("Panel weekly report %s to %s", r.Since.Format("2006-01-02"), r.Until.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	return fmt.Sprintf("Panel daily report %s", r.Since.Format("2006-01-02"))
+}
+
+// Text renders the report as plain text for email and Telegram
+func (r *Report) Text() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, r.Subject())
+
+	fmt.Fprintf(&b, "\nTotal traffic: %s\n", units.FormatBytes(r.TotalTraffic))
+
+	fmt.Fprintf(&b, "\nNew clients: %d\n", r.NewClients)
+	for _, name := range r.NewNames {
+		fmt.Fprintf(&b, "  %s\n", name)
+	}
+	if more := r.NewClients - int64(len(r.NewNames)); more > 0 {
+		fmt.Fprintf(&b, "  and %d more\n", more)
+	}
+
+	fmt.Fprintf(&b, "\nExpiring within 7 days: %d\n", len(r.Expiring))
+	for _, c := range r.Expiring {
+		fmt.Fprintf(&b, "  %s  %s\n", c.Username, c.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+
+	fmt.Fprintln(&b, "\nTop consumers:")
+	if len(r.TopConsumers) == 0 {
+		fmt.Fprintln(&b, "  none")
+	}
+	for i, c := range r.TopConsumers {
+		fmt.Fprintf(&b, "  %d. %s  %s\n", i+1, c.Username, units.FormatBytes(c.Bytes))
+	}
+
+	var total int64
+	for _, n := range r.AuthFailures {
+		total += n
+	}
+	fmt.Fprintf(&b, "\nFailed logins since %s: %d\n", r.FailuresSince.Format("2006-01-02 15:04"), total)
+	for _, service := range slices.Sorted(maps.Keys(r.AuthFailures)) {
+		fmt.Fprintf(&b, "  %s: %d\n", service, r.AuthFailures[service])
+	}
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/clock"
+	"github.com/libersuite-org/panel/mailer"
+	"github.com/libersuite-org/panel/notifier"
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	DB       *gorm.DB
+	Schedule string        // Daily or Weekly (sent on Mondays), empty to only build reports on request
+	At       time.Duration // time of day reports are sent, in server time
+	Emails   []string
+	Chats    []string // Telegram chats, sent to with the notifier's bot
+	Mailer   *mailer.Mailer
+	Notifier *notifier.Notifier
+}
+
+// Reporter sends periodic summaries of clients and traffic to operators. It
+// also counts failed logins between reports. A nil Reporter counts nothing.
+type Reporter struct {
+	cfg      *Config
+	mu       sync.Mutex
+	since    time.Time
+	failures map[string]int64
+}
+
+func New(cfg *Config) (*Reporter, error) {
+	switch cfg.Schedule {
+	case "", Daily, Weekly:
+	default:
+		return nil, fmt.Errorf("unknown report schedule '%s' (want daily or weekly)", cfg.Schedule)
+	}
+	if cfg.At < 0 || cfg.At >= 24*time.Hour {
+		return nil, fmt.Errorf("report time %s is not a time of day", cfg.At)
+	}
+	if len(cfg.Emails) > 0 && !cfg.Mailer.Enabled() {
+		return nil, errors.New("emailing reports needs an SMTP server")
+	}
+	return &Reporter{cfg: cfg, since: time.Now(), failures: make(map[string]int64)}, nil
+}
+
+// AuthFailed counts a failed login to service, e.g. "ssh"
+func (r *Reporter) AuthFailed(service string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.failures[service]++
+	r.mu.Unlock()
+}
+
+// Build returns the report for period ending today, with the failed logins
+// counted since the last report was sent
+func (r *Reporter) Build(period string) (*Report, error) {
+	report, err := build(r.cfg.DB, period, clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	report.FailuresSince = r.since
+	report.AuthFailures = maps.Clone(r.failures)
+	r.mu.Unlock()
+	return report, nil
+}
+
+// Send delivers report to every configured recipient and starts counting
+// failed logins anew
+func (r *Reporter) Send(ctx context.Context, report *Report) error {
+	if len(r.cfg.Emails) == 0 && len(r.cfg.Chats) == 0 {
+		return errors.New("no report recipients configured")
+	}
+	text := report.Text()
+	var errs []string
+	if len(r.cfg.Emails) > 0 {
+		if err := r.cfg.Mailer.Send(r.cfg.Emails, report.Subject(), text); err != nil {
+			errs = append(errs, fmt.Sprintf("email: %v", err))
+		}
+	}
+	for _, chat := range r.cfg.Chats {
+		if err := r.cfg.Notifier.SendTelegramTo(ctx, chat, text); err != nil {
+			errs = append(errs, fmt.Sprintf("telegram %s: %v", chat, err))
+		}
+	}
+
+	r.mu.Lock()
+	r.since = time.Now()
+	clear(r.failures)
+	r.mu.Unlock()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("report delivery failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Start sends a report on the configured schedule until ctx is done
+func (r *Reporter) Start(ctx context.Context) error {
+	for {
+		now := clock.Now()
+		timer := time.NewTimer(r.next(now).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		report, err := r.Build(r.cfg.Schedule)
+		if err == nil {
+			err = r.Send(ctx, report)
+		}
+		if err != nil {
+			log.Printf("Reports: %v", err)
+			continue
+		}
+		log.Printf("Reports: sent the %s report", r.cfg.Schedule)
+	}
+}
+
+// next returns when the report after now is due
+func (r *Reporter) next(now time.Time) time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for {
+		at := day.Add(r.cfg.At)
+		if at.After(now) && (r.cfg.Schedule != Weekly || at.Weekday() == time.Monday) {
+			return at
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
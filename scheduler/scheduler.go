@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/clock"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/mailer"
+	"github.com/libersuite-org/panel/notifier"
+	"github.com/libersuite-org/panel/units"
+	"gorm.io/gorm"
+)
+
+// trafficLogRetention is how long daily traffic history is kept
+const trafficLogRetention = 90 * 24 * time.Hour
+
+type Config struct {
+	DB            *gorm.DB
+	Auth          *authcache.Cache // told about clients the scheduler changes, nil when not caching
+	Interval      time.Duration
+	ExpiryWarning time.Duration  // warn when a client expires within this window, 0 disables
+	QuotaWarning  int            // warn at this percentage of the traffic limit, 0 disables
+	AutoDisable   bool           // disable clients once they expire
+	PurgeAfter    time.Duration  // delete clients this long after expiry, 0 disables
+	Mailer        *mailer.Mailer // emails expiry reminders to clients with an address, nil disables
+}
+
+// Scheduler periodically checks client accounts for expiry and quota events
+// and resets the traffic of monthly quotas
+type Scheduler struct {
+	cfg      *Config
+	notifier *notifier.Notifier
+}
+
+func New(cfg *Config, n *notifier.Notifier) *Scheduler {
+	return &Scheduler{cfg: cfg, notifier: n}
+}
+
+func (s *Scheduler) Start(ctx context.Context) error {
+	interval := s.cfg.Interval
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.run(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			s.run(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	var clients []models.Client
+	if err := s.cfg.DB.Find(&clients).Error; err != nil {
+		log.Printf("Scheduler: failed to load clients: %v", err)
+		return
+	}
+
+	now := clock.Now()
+	for i := range clients {
+		s.check(ctx, &clients[i], now)
+	}
+	s.pruneTrafficLog(now)
+}
+
+// pruneTrafficLog drops history past the retention window and of removed clients
+func (s *Scheduler) pruneTrafficLog(now time.Time) {
+	cutoff := now.Add(-trafficLogRetention).Format(models.TrafficDayFormat)
+	err := s.cfg.DB.Where("day < ? OR client_id NOT IN (?)", cutoff, s.cfg.DB.Model(&models.Client{}).Select("id")).
+		Delete(&models.TrafficLog{}).Error
+	if err != nil {
+		log.Printf("Scheduler: failed to prune traffic log: %v", err)
+	}
+}
+
+func (s *Scheduler) check(ctx context.Context, c *models.Client, now time.Time) {
+	if s.cfg.PurgeAfter > 0 && !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt.Add(s.cfg.PurgeAfter)) {
+		if err := s.cfg.DB.Unscoped().Delete(c).Error; err != nil {
+			log.Printf("Scheduler: failed to purge '%s': %v", c.Username, err)
+			return
+		}
+		s.cfg.Auth.Invalidate(c.Username)
+		s.notify(ctx, c, "purged", fmt.Sprintf("Client '%s' was purged %s after expiring", c.Username, s.cfg.PurgeAfter))
+		return
+	}
+
+	updates := map[string]any{}
+
+	if s.cfg.AutoDisable && c.Enabled && c.IsExpired() {
+		updates["enabled"] = false
+		s.notify(ctx, c, "disabled", fmt.Sprintf("Client '%s' expired on %s and was disabled", c.Username, c.ExpiresAt.Format("2006-01-02")))
+	}
+
+	if s.cfg.ExpiryWarning > 0 {
+		expiring := c.Enabled && !c.ExpiresAt.IsZero() && !c.IsExpired() && c.ExpiresAt.Sub(now) <= s.cfg.ExpiryWarning
+		if expiring && !c.NotifiedExpiry {
+			updates["notified_expiry"] = true
+			s.notify(ctx, c, "expiring", fmt.Sprintf("Client '%s' expires on %s", c.Username, c.ExpiresAt.Format("2006-01-02 15:04")))
+			s.remind(c)
+		} else if !expiring && c.NotifiedExpiry && !c.IsExpired() {
+			// Renewed past the warning window, arm the warning again
+			updates["notified_expiry"] = false
+		}
+	}
+
+	if c.TrafficResetDue(now) {
+		updates["traffic_used"] = 0
+		updates["last_reset_at"] = now
+		updates["notified_quota"] = false
+		s.notify(ctx, c, "reset", fmt.Sprintf("Monthly traffic of client '%s' was reset after using %s", c.Username, units.FormatBytes(c.TrafficUsed)))
+		c.TrafficUsed = 0
+		c.NotifiedQuota = false
+	}
+
+	if s.cfg.QuotaWarning > 0 && c.TrafficLimit > 0 {
+		nearQuota := c.Enabled && c.TrafficUsed*100 >= c.TrafficLimit*int64(s.cfg.QuotaWarning)
+		if nearQuota && !c.NotifiedQuota {
+			updates["notified_quota"] = true
+			s.notify(ctx, c, "quota", fmt.Sprintf("Client '%s' has used %d%% of their traffic limit", c.Username, c.TrafficUsed*100/c.TrafficLimit))
+		} else if !nearQuota && c.NotifiedQuota {
+			updates["notified_quota"] = false
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := s.cfg.DB.Model(c).Updates(updates).Error; err != nil {
+			log.Printf("Scheduler: failed to update '%s': %v", c.Username, err)
+		}
+		s.cfg.Auth.Invalidate(c.Username)
+	}
+}
+
+// remind emails c that it expires soon
+func (s *Scheduler) remind(c *models.Client) {
+	if c.Email == "" || !s.cfg.Mailer.Enabled() {
+		return
+	}
+	if err := s.cfg.Mailer.SendTemplate([]string{c.Email}, mailer.Expiry, s.cfg.Mailer.ClientData(c)); err != nil {
+		log.Printf("Scheduler: failed to email expiry reminder to '%s': %v", c.Username, err)
+	}
+}
+
+func (s *Scheduler) notify(ctx context.Context, c *models.Client, event, message string) {
+	log.Printf("Scheduler: %s", message)
+	if s.notifier == nil || !s.notifier.Enabled() {
+		return
+	}
+
+	err := s.notifier.Send(ctx, notifier.Event{
+		Type:     event,
+		Username: c.Username,
+		Message:  message,
+		Details: map[string]any{
+			"expires_at":    c.ExpiresAt,
+			"traffic_used":  c.TrafficUsed,
+			"traffic_limit": c.TrafficLimit,
+		},
+	})
+	if err != nil {
+		log.Printf("Scheduler: %v", err)
+	}
+}
@@ -8,86 +8,159 @@ import (
 	"io"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/accesslog"
+	"github.com/libersuite-org/panel/accounting"
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/bans"
+	"github.com/libersuite-org/panel/clock"
 	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/geoip"
+	"github.com/libersuite-org/panel/inproc"
+	"github.com/libersuite-org/panel/landing"
+	"github.com/libersuite-org/panel/locations"
+	"github.com/libersuite-org/panel/maintenance"
+	"github.com/libersuite-org/panel/reports"
+	"github.com/libersuite-org/panel/tunnel"
 	"gorm.io/gorm"
 )
 
 const (
-	socksVersion5       = 0x05
-	authMethodUserPass  = 0x02
-	authMethodNoAccept  = 0xFF
-	userPassVersion     = 0x01
-	socksCmdConnect     = 0x01
-	addrTypeIPv4        = 0x01
-	addrTypeDomain      = 0x03
-	addrTypeIPv6        = 0x04
-	replySucceeded      = 0x00
-	replyGeneralFailure = 0x01
-	replyCmdNotSupport  = 0x07
-	replyAddrNotSupport = 0x08
+	socksVersion5        = 0x05
+	authMethodUserPass   = 0x02
+	authMethodNoAccept   = 0xFF
+	userPassVersion      = 0x01
+	socksCmdConnect      = 0x01
+	addrTypeIPv4         = 0x01
+	addrTypeDomain       = 0x03
+	addrTypeIPv6         = 0x04
+	replySucceeded       = 0x00
+	replyGeneralFailure  = 0x01
+	replyNotAllowed      = 0x02
+	replyHostUnreachable = 0x04
+	replyCmdNotSupport   = 0x07
+	replyAddrNotSupport  = 0x08
 )
 
 type Config struct {
-	Host string
-	Port int
+	Hosts        []string          // bind addresses, every interface when empty
+	Port         int               // 0 serves only InProcess connections
+	InProcess    *inproc.Listener  // connections handed over by the mixed entrypoint, nil disables
+	DB           *gorm.DB          // clients and their allowed IPs
+	Auth         *authcache.Cache  // looks clients up at login
+	TokenAuth    bool              // also accept a client's AuthToken as the username with an empty password
+	StaleTimeout time.Duration     // close connections with no traffic for this long, 0 disables
+	IdleTimeout  time.Duration     // same as StaleTimeout; the shorter of the two applies
+	AccessLog    *accesslog.Logger // records connected destinations, nil disables
+	Destinations *accesslog.Stats  // counts connected destinations, nil disables
+	Landing      *landing.Landing  // renewal page for expired and out-of-traffic clients, nil turns them away
+	ACL          *acl.Engine       // destination rules, nil allows everything
+	GeoIP        *geoip.Policy     // source country restrictions, nil allows everything
+	Bans         *bans.Guard       // bans IPs with repeated failed logins, nil disables
+	Reports      *reports.Reporter // counts failed logins for operator reports, nil disables
+	Accounting   *accounting.Accountant
+	Timeouts     *tunnel.Timeouts    // keepalive and deadlines of client and target connections
+	Limits       *tunnel.Limits      // server-wide tunnel cap, nil allows everything
+	Dials        *tunnel.DialLimiter // server-wide cap on dials in progress, nil allows everything
+	Maintenance  *maintenance.Mode   // turns new logins away while on, nil disables
+	Locations    *locations.Watcher  // flags logins from new countries and networks, nil disables
+	OutboundIP   net.IP              // source address of target connections unless the client has its own, nil lets the system pick
+	Upstreams    *tunnel.Upstreams   // proxies target connections go through, nil dials directly
+	Resolver     *tunnel.Resolver    // resolves target addresses, nil uses the system resolver
 }
 
 type Server struct {
-	cfg      *Config
-	listener net.Listener
-	ctx      context.Context
-	wg       sync.WaitGroup
+	cfg       *Config
+	listeners []net.Listener
+	sessions  *tunnel.Sessions
+	wg        sync.WaitGroup
+	listening atomic.Bool
+	active    atomic.Int64 // open client connections
 }
 
 type quotaWriter struct {
-	writer   io.Writer
-	used     *int64
-	baseUsed int64
-	limit    int64
+	writer       io.Writer
+	budget       *accounting.Budget
+	lastActivity *int64
 }
 
+// Write passes p on in pieces small enough to throttle without long pauses
 func (q *quotaWriter) Write(p []byte) (n int, err error) {
-	n, err = q.writer.Write(p)
-	if n > 0 {
-		total := atomic.AddInt64(q.used, int64(n)) + q.baseUsed
-		if q.limit > 0 && total >= q.limit {
-			return n, io.ErrShortWrite
+	for len(p) > 0 {
+		w, err := q.writer.Write(p[:q.budget.Limit(len(p))])
+		n += w
+		p = p[w:]
+		if w > 0 {
+			atomic.StoreInt64(q.lastActivity, time.Now().UnixNano())
+			if !q.budget.Use(w) {
+				return n, io.ErrShortWrite
+			}
+		}
+		if err != nil {
+			return n, err
 		}
 	}
-	return n, err
+	return n, nil
 }
 
 func New(cfg *Config) *Server {
-	return &Server{cfg: cfg}
+	return &Server{cfg: cfg, sessions: tunnel.NewSessions()}
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	s.ctx = ctx
-	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
-
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to start SOCKS listener on %s: %w", addr, err)
+	var listeners []net.Listener
+	if s.cfg.Port != 0 {
+		for _, addr := range tunnel.ListenAddrs(s.cfg.Hosts, s.cfg.Port) {
+			listener, err := s.cfg.Timeouts.Listen(addr)
+			if err != nil {
+				for _, l := range listeners {
+					_ = l.Close()
+				}
+				return fmt.Errorf("failed to start SOCKS listener on %s: %w", addr, err)
+			}
+			log.Printf("Starting SOCKS5 server on %s", addr)
+			listeners = append(listeners, listener)
+		}
+	}
+	if s.cfg.InProcess != nil {
+		log.Println("SOCKS5 server accepting in-process connections from the mixed entrypoint")
+		listeners = append(listeners, s.cfg.InProcess.Attach())
 	}
+	s.listeners = listeners
 
-	s.listener = listener
-	log.Printf("Starting SOCKS5 server on %s", addr)
+	s.listening.Store(true)
+	defer s.listening.Store(false)
 
 	go func() {
 		<-ctx.Done()
-		_ = listener.Close()
+		for _, listener := range s.listeners {
+			_ = listener.Close()
+		}
 	}()
 
+	var serving sync.WaitGroup
+	for _, listener := range s.listeners {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			s.serve(ctx, listener)
+		}()
+	}
+	serving.Wait()
+	return nil
+}
+
+func (s *Server) serve(ctx context.Context, listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
-				return nil
+				return
 			}
 			log.Printf("SOCKS accept error: %v", err)
 			continue
@@ -98,9 +171,35 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// Listening reports whether the server is accepting connections
+func (s *Server) Listening() bool {
+	return s != nil && s.listening.Load()
+}
+
+// Connections returns the number of open client connections
+func (s *Server) Connections() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.active.Load()
+}
+
+// Kick closes the connections of username and returns how many there were
+func (s *Server) Kick(username string) int {
+	if s == nil {
+		return 0
+	}
+	return s.sessions.Kick(username)
+}
+
+// Shutdown stops accepting connections and waits for the open ones to end
+// until ctx is done, then closes the ones left and waits for them to go
 func (s *Server) Shutdown(ctx context.Context) error {
-	if s.listener != nil {
-		_ = s.listener.Close()
+	for _, listener := range s.listeners {
+		_ = listener.Close()
+	}
+	if s.cfg.InProcess != nil {
+		_ = s.cfg.InProcess.Close()
 	}
 
 	done := make(chan struct{})
@@ -113,27 +212,57 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	case <-done:
 		return nil
 	case <-ctx.Done():
+		s.sessions.CloseAll()
+		<-done
 		return ctx.Err()
 	}
 }
 
+// dial connects to a client's target. Through an upstream the requested
+// address is dialed, so hostnames resolve at the exit; directly, the
+// dialAddrs the ACL approved.
+func (s *Server) dial(ctx context.Context, client *models.Client, address string, dialAddrs []string) (net.Conn, error) {
+	up, err := s.cfg.Upstreams.For(client.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if up != nil {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return up.DialContext(ctx, address)
+	}
+	return s.cfg.Dials.Dial(ctx, s.cfg.Timeouts.Dialer(10*time.Second), tunnel.SourceIP(client.OutboundIP, s.cfg.OutboundIP), s.cfg.Resolver, dialAddrs...)
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
 	defer s.wg.Done()
+	s.active.Add(1)
+	defer s.active.Add(-1)
 	defer conn.Close()
 
+	if s.cfg.Bans.Banned(conn.RemoteAddr()) {
+		return
+	}
+
+	// Ending the session closes the connection, whatever stage it is in
+	sess := s.sessions.Open()
+	defer sess.End()
+	context.AfterFunc(sess.Context(), func() { _ = conn.Close() })
+
 	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
-	client, err := authenticate(conn)
+	client, err := s.authenticate(conn)
 	if err != nil {
 		return
 	}
 	_ = conn.SetDeadline(time.Time{})
+	sess.SetUser(client.Username)
 
-	if err := s.handleConnectRequest(conn, client); err != nil {
+	if err := s.handleConnectRequest(sess.Context(), conn, client); err != nil {
 		log.Printf("SOCKS request failed for user '%s': %v", client.Username, err)
 	}
 }
 
-func authenticate(conn net.Conn) (*models.Client, error) {
+func (s *Server) authenticate(conn net.Conn) (*models.Client, error) {
 	header := make([]byte, 2)
 	if _, err := io.ReadFull(conn, header); err != nil {
 		return nil, err
@@ -189,19 +318,60 @@ func authenticate(conn net.Conn) (*models.Client, error) {
 		return nil, err
 	}
 
-	var client models.Client
-	if err := database.DB.Where("username = ?", string(username)).First(&client).Error; err != nil {
+	if _, on := s.cfg.Maintenance.Active(); on {
+		_, _ = conn.Write([]byte{userPassVersion, 0x01})
+		return nil, errors.New("server is in maintenance mode")
+	}
+
+	client, err := s.lookup(string(username), string(password))
+	if err != nil {
 		_, _ = conn.Write([]byte{userPassVersion, 0x01})
+		s.cfg.Bans.Fail(conn.RemoteAddr(), "socks")
+		s.cfg.Reports.AuthFailed("socks")
 		return nil, errors.New("invalid username or password")
 	}
+	s.cfg.Bans.Succeed(conn.RemoteAddr())
 
-	if client.Password != string(password) || !client.IsActive() {
+	if !client.CanLogin() && !s.cfg.Landing.Admits(&client) {
 		_, _ = conn.Write([]byte{userPassVersion, 0x01})
 		return nil, errors.New("invalid username or password")
 	}
 
-	client.LastConnection = time.Now()
-	_ = database.DB.Save(&client).Error
+	if protocol := models.EntryProtocol(conn.RemoteAddr(), models.ProtocolSOCKS); !client.AllowsProtocol(protocol) {
+		_, _ = conn.Write([]byte{userPassVersion, 0x01})
+		log.Printf("SOCKS user '%s' rejected: %s logins are not allowed", client.Username, protocol)
+		return nil, errors.New("protocol not allowed")
+	}
+
+	countries, _ := geoip.ParseCountries(client.Countries)
+	if country, ok := s.cfg.GeoIP.Check(conn.RemoteAddr(), countries); !ok {
+		_, _ = conn.Write([]byte{userPassVersion, 0x01})
+		log.Printf("SOCKS user '%s' rejected: connections from country '%s' are not allowed", client.Username, country)
+		return nil, errors.New("source country not allowed")
+	}
+
+	boundIP := client.BoundIP
+	if ok, err := client.CheckIP(s.cfg.DB, models.SourceIP(conn.RemoteAddr())); err != nil || !ok {
+		_, _ = conn.Write([]byte{userPassVersion, 0x01})
+		log.Printf("SOCKS user '%s' rejected: account is locked to %s", client.Username, client.BoundIP)
+		return nil, errors.New("account locked to another IP")
+	}
+
+	if !s.cfg.Locations.Check(&client, conn.RemoteAddr()) {
+		_, _ = conn.Write([]byte{userPassVersion, 0x01})
+		log.Printf("SOCKS user '%s' rejected: disabled after a login from a new location", client.Username)
+		return nil, errors.New("login from a new location")
+	}
+
+	activated := client.Activate(clock.Now())
+	if activated {
+		log.Printf("SOCKS user '%s' activated, expires at %s", client.Username, client.ExpiresAt.Format("2006-01-02"))
+		_ = s.cfg.DB.Model(&client).Select("expires_at", "activate_days").Updates(&client).Error
+	}
+	s.cfg.Accounting.Seen(&client, time.Now())
+	if activated || client.BoundIP != boundIP {
+		s.cfg.Auth.Invalidate(client.Username)
+	}
 
 	if _, err := conn.Write([]byte{userPassVersion, 0x00}); err != nil {
 		return nil, err
@@ -211,6 +381,23 @@ func authenticate(conn net.Conn) (*models.Client, error) {
 	return &client, nil
 }
 
+// lookup returns the client logging in with username and password, or with
+// its auth token in place of the username and no password under TokenAuth
+func (s *Server) lookup(username, password string) (models.Client, error) {
+	if s.cfg.TokenAuth && password == "" {
+		client, err := s.cfg.Auth.LookupToken(username)
+		if err == nil && !client.TokenValid(username) {
+			err = errors.New("token expired")
+		}
+		return client, err
+	}
+	client, err := s.cfg.Auth.Lookup(username)
+	if err == nil && client.Password != password {
+		err = errors.New("wrong password")
+	}
+	return client, err
+}
+
 func hasMethod(methods []byte, method byte) bool {
 	for _, m := range methods {
 		if m == method {
@@ -220,7 +407,7 @@ func hasMethod(methods []byte, method byte) bool {
 	return false
 }
 
-func (s *Server) handleConnectRequest(conn net.Conn, client *models.Client) error {
+func (s *Server) handleConnectRequest(ctx context.Context, conn net.Conn, client *models.Client) error {
 	requestHeader := make([]byte, 4)
 	if _, err := io.ReadFull(conn, requestHeader); err != nil {
 		return err
@@ -241,70 +428,111 @@ func (s *Server) handleConnectRequest(conn net.Conn, client *models.Client) erro
 		return err
 	}
 
-	dialer := &net.Dialer{Timeout: 10 * time.Second}
-	targetConn, err := dialer.DialContext(s.ctx, "tcp", address)
+	// Connections the quota action keeps are never cut. Lapsed clients get
+	// the landing page for the rest, but the renewal site, which they may
+	// reach whatever their quota.
+	limit := client.TrafficLimit
+	kept := client.QuotaKeeps(address)
+	if kept {
+		limit = 0
+	}
+	if !client.CanLogin() || (!kept && s.cfg.Accounting.OutOfTraffic(client)) {
+		if !s.cfg.Landing.Exempt(address) {
+			if s.cfg.Landing == nil {
+				_ = writeReply(conn, replyNotAllowed)
+				return fmt.Errorf("out of traffic, refusing %s", address)
+			}
+			if err := writeReply(conn, replySucceeded); err != nil {
+				return err
+			}
+			log.Printf("Serving the landing page to lapsed SOCKS user '%s' for %s", client.Username, address)
+			s.cfg.Landing.Serve(conn, client)
+			return nil
+		}
+		limit = 0
+	}
+
+	dialAddrs := []string{address}
+	_, port, _ := net.SplitHostPort(address)
+	portNum, _ := strconv.Atoi(port)
+	err = acl.CheckForward(client, portNum)
+	if err == nil {
+		dialAddrs, err = s.cfg.ACL.Check(ctx, client.ID, address)
+	}
+	if err != nil {
+		s.cfg.AccessLog.Log("socks", client.Username, conn.RemoteAddr().String(), address, err)
+		s.cfg.Destinations.Record(client.Username, address, err)
+		if errors.Is(err, acl.ErrDenied) {
+			_ = writeReply(conn, replyNotAllowed)
+		} else {
+			_ = writeReply(conn, replyHostUnreachable)
+		}
+		return err
+	}
+
+	if !s.cfg.Limits.Acquire() {
+		_ = writeReply(conn, replyGeneralFailure)
+		return fmt.Errorf("server connection limit reached, refusing %s", address)
+	}
+	defer s.cfg.Limits.Release()
+
+	targetConn, err := s.dial(ctx, client, address, dialAddrs)
+	s.cfg.AccessLog.Log("socks", client.Username, conn.RemoteAddr().String(), address, err)
+	s.cfg.Destinations.Record(client.Username, address, err)
 	if err != nil {
 		_ = writeReply(conn, replyGeneralFailure)
 		return fmt.Errorf("failed to connect to %s: %w", address, err)
 	}
+	targetConn = s.cfg.Timeouts.Wrap(targetConn)
 	defer targetConn.Close()
 
 	if err := writeReply(conn, replySucceeded); err != nil {
 		return err
 	}
 
-	var sessionUsed int64
-	var closeOnce sync.Once
-	closeBoth := func() {
-		closeOnce.Do(func() {
-			_ = conn.Close()
-			_ = targetConn.Close()
-		})
-	}
+	meter := s.cfg.Accounting.Acquire(client)
+	defer s.cfg.Accounting.Release(meter)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	lastActivity := time.Now().UnixNano()
 	upstream := &quotaWriter{
-		writer:   targetConn,
-		used:     &sessionUsed,
-		baseUsed: client.TrafficUsed,
-		limit:    client.TrafficLimit,
+		writer:       targetConn,
+		budget:       meter.Budget(ctx, accounting.Upload, limit, true),
+		lastActivity: &lastActivity,
 	}
+	defer upstream.budget.Close()
 
 	downstream := &quotaWriter{
-		writer:   conn,
-		used:     &sessionUsed,
-		baseUsed: client.TrafficUsed,
-		limit:    client.TrafficLimit,
+		writer:       conn,
+		budget:       meter.Budget(ctx, accounting.Download, limit, true),
+		lastActivity: &lastActivity,
 	}
+	defer downstream.budget.Close()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		_, _ = io.Copy(upstream, conn)
-		closeBoth()
-	}()
-
-	go func() {
-		defer wg.Done()
-		_, _ = io.Copy(downstream, targetConn)
-		closeBoth()
-	}()
-
-	wg.Wait()
-
-	used := atomic.LoadInt64(&sessionUsed)
-	if used > 0 {
-		if err := database.DB.Model(&models.Client{}).
-			Where("id = ?", client.ID).
-			UpdateColumn("traffic_used", gorm.Expr("traffic_used + ?", used)).Error; err != nil {
-			log.Printf("Failed to update traffic usage for SOCKS user '%s': %v", client.Username, err)
-		}
+	if timeout := idleTimeout(s.cfg.StaleTimeout, s.cfg.IdleTimeout); timeout > 0 {
+		go tunnel.WatchIdle(ctx, &lastActivity, timeout, func() {
+			log.Printf("Closing idle SOCKS connection for user '%s' to %s", client.Username, address)
+			cancel()
+		})
 	}
 
+	tunnel.Relay(ctx,
+		func() { _, _ = tunnel.Copy(upstream, conn) },
+		func() { _, _ = tunnel.Copy(downstream, targetConn) },
+		conn, targetConn)
 	return nil
 }
 
+// idleTimeout returns the shorter of two optional timeouts
+func idleTimeout(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
 func readTargetAddress(conn net.Conn, atyp byte) (string, error) {
 	var host string
 
@@ -347,7 +575,7 @@ func readTargetAddress(conn net.Conn, atyp byte) (string, error) {
 	}
 
 	port := binary.BigEndian.Uint16(portBuf)
-	return fmt.Sprintf("%s:%d", host, port), nil
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
 }
 
 func writeReply(conn net.Conn, rep byte) error {
@@ -0,0 +1,101 @@
+package sshserver
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// SessionStats describes the channels of one SSH session. Apps that
+// multiplex everything over one login can open thousands of direct-tcpip
+// channels; these counts show which sessions do.
+type SessionStats struct {
+	SessionID        string         `json:"session_id"`
+	Username         string         `json:"username"`
+	RemoteAddr       string         `json:"remote_addr"`
+	StartedAt        time.Time      `json:"started_at"`
+	OpenChannels     int64          `json:"open_channels"`
+	ChannelsOpened   int64          `json:"channels_opened"`   // since the session started
+	ChannelsRejected int64          `json:"channels_rejected"` // over the channel limit
+	Channels         []ChannelStats `json:"channels,omitempty"`
+}
+
+// ChannelStats describes one open direct-tcpip channel
+type ChannelStats struct {
+	Destination string    `json:"destination"`
+	OpenedAt    time.Time `json:"opened_at"`
+	Upload      int64     `json:"upload"`   // bytes from the client
+	Download    int64     `json:"download"` // bytes to the client
+}
+
+// channelStat counts the data of an open channel
+type channelStat struct {
+	dest     string
+	openedAt time.Time
+	upload   atomic.Int64
+	download atomic.Int64
+}
+
+// reserveChannel counts a channel the session opens, failing when it
+// already has max open; 0 allows any number
+func (t *sessionTracker) reserveChannel(max int) bool {
+	if open := t.openChannels.Add(1); max > 0 && open > int64(max) {
+		t.openChannels.Add(-1)
+		t.channelsRejected.Add(1)
+		return false
+	}
+	t.channelsOpened.Add(1)
+	return true
+}
+
+func (t *sessionTracker) releaseChannel() {
+	t.openChannels.Add(-1)
+}
+
+func (t *sessionTracker) stats(id string, channels bool) SessionStats {
+	st := SessionStats{
+		SessionID:        id,
+		Username:         t.client.Username,
+		RemoteAddr:       t.remoteAddr,
+		StartedAt:        t.startTime,
+		OpenChannels:     t.openChannels.Load(),
+		ChannelsOpened:   t.channelsOpened.Load(),
+		ChannelsRejected: t.channelsRejected.Load(),
+	}
+	if channels {
+		t.channels.Range(func(key, _ any) bool {
+			ch := key.(*channelStat)
+			st.Channels = append(st.Channels, ChannelStats{
+				Destination: ch.dest,
+				OpenedAt:    ch.openedAt,
+				Upload:      ch.upload.Load(),
+				Download:    ch.download.Load(),
+			})
+			return true
+		})
+		sort.Slice(st.Channels, func(i, j int) bool { return st.Channels[i].OpenedAt.Before(st.Channels[j].OpenedAt) })
+	}
+	return st
+}
+
+// SessionStats lists the open sessions, those of username only when it is
+// set, with the most open channels first. channels adds each session's
+// open channels.
+func (s *Server) SessionStats(username string, channels bool) []SessionStats {
+	out := []SessionStats{}
+	if s == nil {
+		return out
+	}
+	s.sessions.forEach(func(id string, e *sessionEntry) {
+		if username == "" || e.tracker.client.Username == username {
+			out = append(out, e.tracker.stats(id, channels))
+		}
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].OpenChannels != out[j].OpenChannels {
+			return out[i].OpenChannels > out[j].OpenChannels
+		}
+		return out[i].StartedAt.Before(out[j].StartedAt)
+	})
+	return out
+}
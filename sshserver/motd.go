@@ -0,0 +1,105 @@
+package sshserver
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/libersuite-org/panel/clock"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/units"
+)
+
+// DefaultMOTD is the account summary shown when no template is configured
+const DefaultMOTD = `Account:  {{.Username}}
+Status:   {{.Status}}
+Traffic:  {{if .Unlimited}}{{.TrafficUsed}} used (unlimited){{else}}{{.TrafficUsed}} used of {{.TrafficLimit}}, {{.TrafficRemaining}} remaining{{end}}
+Expires:  {{if .ExpiresAt}}{{.ExpiresAt}} ({{.DaysLeft}} days left){{else}}never{{end}}
+{{- if .Support}}
+Support:  {{.Support}}{{end}}`
+
+// MOTDData is the value MOTD templates are executed against
+type MOTDData struct {
+	Username         string
+	Status           string // active, disabled, expired, or out of traffic
+	TrafficUsed      string // human readable, e.g. "1.5 GB"
+	TrafficLimit     string
+	TrafficRemaining string
+	Unlimited        bool
+	ExpiresAt        string // YYYY-MM-DD, empty when the account never expires
+	DaysLeft         int
+	Support          string
+}
+
+// ParseMOTD validates a MOTD template; an empty body selects DefaultMOTD
+func ParseMOTD(body string) (*template.Template, error) {
+	if strings.TrimSpace(body) == "" {
+		body = DefaultMOTD
+	}
+	tmpl, err := template.New("motd").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MOTD template: %w", err)
+	}
+	return tmpl, nil
+}
+
+var defaultMOTD = template.Must(ParseMOTD(""))
+
+// motd renders the account summary for client; used is the live traffic
+// total, which may be ahead of client.TrafficUsed
+func (s *Server) motd(client *models.Client, used int64) string {
+	data := MOTDData{
+		Username:    client.Username,
+		Status:      "active",
+		TrafficUsed: units.FormatBytes(used),
+		Unlimited:   client.TrafficLimit == 0,
+		Support:     s.cfg.SupportContact,
+	}
+	switch {
+	case !client.Enabled:
+		data.Status = "disabled"
+	case client.IsExpired():
+		data.Status = "expired"
+	case client.TrafficLimit > 0 && used >= client.TrafficLimit:
+		data.Status = "out of traffic"
+	}
+	if client.TrafficLimit > 0 {
+		data.TrafficLimit = units.FormatBytes(client.TrafficLimit)
+		data.TrafficRemaining = units.FormatBytes(max(client.TrafficLimit-used, 0))
+	}
+	if !client.ExpiresAt.IsZero() {
+		data.ExpiresAt = client.ExpiresAt.Format("2006-01-02")
+		data.DaysLeft = max(int(client.ExpiresAt.Sub(clock.Now()).Hours()/24), 0)
+	}
+
+	tmpl := s.cfg.MOTD
+	if tmpl == nil {
+		tmpl = defaultMOTD
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render MOTD for '%s': %v", client.Username, err)
+		return ""
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// bannerHandler sends the maintenance message, or with MOTDInBanner the
+// MOTD, as the pre-authentication banner, which is what most mobile tunnel
+// apps display
+func (s *Server) bannerHandler(ctx ssh.Context) string {
+	if message, on := s.cfg.Maintenance.Active(); on {
+		return message + "\n"
+	}
+	if !s.cfg.MOTDInBanner {
+		return ""
+	}
+	var client models.Client
+	if err := s.cfg.DB.Where("username = ?", ctx.User()).First(&client).Error; err != nil {
+		return ""
+	}
+	return s.motd(&client, client.TrafficUsed) + "\n"
+}
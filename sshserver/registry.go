@@ -0,0 +1,127 @@
+package sshserver
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const registryShards = 64
+
+type sessionEntry struct {
+	tracker *sessionTracker
+	conn    *gossh.ServerConn
+}
+
+type registryShard struct {
+	mu       sync.RWMutex
+	sessions map[string]*sessionEntry
+}
+
+// sessionRegistry spreads sessions over independently locked shards so that
+// channel setup and teardown on different sessions don't contend on one lock.
+// The session counts are kept in atomics beside the shards, so reading them
+// on every login takes no lock at all.
+type sessionRegistry struct {
+	shards  [registryShards]registryShard
+	total   atomic.Int64
+	clients sync.Map // client ID -> *atomic.Int64; kept at zero once a client has no sessions
+}
+
+func newSessionRegistry() *sessionRegistry {
+	r := &sessionRegistry{}
+	for i := range r.shards {
+		r.shards[i].sessions = make(map[string]*sessionEntry)
+	}
+	return r
+}
+
+func (r *sessionRegistry) shard(id string) *registryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &r.shards[h.Sum32()%registryShards]
+}
+
+// clientCount returns the session counter of the client with id
+func (r *sessionRegistry) clientCount(id uint) *atomic.Int64 {
+	if c, ok := r.clients.Load(id); ok {
+		return c.(*atomic.Int64)
+	}
+	c, _ := r.clients.LoadOrStore(id, new(atomic.Int64))
+	return c.(*atomic.Int64)
+}
+
+// len returns the number of sessions
+func (r *sessionRegistry) len() int {
+	return int(r.total.Load())
+}
+
+// countClient returns the number of sessions of the client with id
+func (r *sessionRegistry) countClient(id uint) int {
+	if c, ok := r.clients.Load(id); ok {
+		return int(c.(*atomic.Int64).Load())
+	}
+	return 0
+}
+
+// getOrCreate returns the entry for id, calling create under the shard lock
+// if it doesn't exist yet. The boolean reports whether the entry was created.
+func (r *sessionRegistry) getOrCreate(id string, create func() *sessionEntry) (*sessionEntry, bool) {
+	sh := r.shard(id)
+
+	sh.mu.RLock()
+	e, ok := sh.sessions[id]
+	sh.mu.RUnlock()
+	if ok {
+		return e, false
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if e, ok := sh.sessions[id]; ok {
+		return e, false
+	}
+	e = create()
+	sh.sessions[id] = e
+	r.total.Add(1)
+	r.clientCount(e.tracker.client.ID).Add(1)
+	return e, true
+}
+
+func (r *sessionRegistry) remove(id string) *sessionEntry {
+	sh := r.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	e, ok := sh.sessions[id]
+	if !ok {
+		return nil
+	}
+	delete(sh.sessions, id)
+	r.total.Add(-1)
+	r.clientCount(e.tracker.client.ID).Add(-1)
+	return e
+}
+
+// forEach calls fn for every session. fn runs outside the shard locks, so it
+// may block (e.g. on the database) without stalling new sessions.
+func (r *sessionRegistry) forEach(fn func(id string, e *sessionEntry)) {
+	for i := range r.shards {
+		sh := &r.shards[i]
+
+		sh.mu.RLock()
+		ids := make([]string, 0, len(sh.sessions))
+		entries := make([]*sessionEntry, 0, len(sh.sessions))
+		for id, e := range sh.sessions {
+			ids = append(ids, id)
+			entries = append(entries, e)
+		}
+		sh.mu.RUnlock()
+
+		for j, e := range entries {
+			fn(ids[j], e)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sshserver
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+// BenchmarkRegistryContention opens and closes sessions from every goroutine
+// at once while checking the per-client limit, as logins do
+func BenchmarkRegistryContention(b *testing.B) {
+	r := newSessionRegistry()
+	clients := make([]*models.Client, 16)
+	for i := range clients {
+		clients[i] = &models.Client{}
+		clients[i].ID = uint(i + 1)
+	}
+
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := next.Add(1)
+			client := clients[n%int64(len(clients))]
+			id := strconv.FormatInt(n, 16)
+
+			_ = r.countClient(client.ID)
+			r.getOrCreate(id, func() *sessionEntry {
+				return &sessionEntry{tracker: &sessionTracker{client: client}}
+			})
+			_ = r.len()
+			r.remove(id)
+		}
+	})
+
+	if n := r.len(); n != 0 {
+		b.Fatalf("%d sessions left", n)
+	}
+}
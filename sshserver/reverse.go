@@ -0,0 +1,280 @@
+package sshserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/libersuite-org/panel/accounting"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/tunnel"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ReverseForward describes one port a client has bound with ssh -R
+type ReverseForward struct {
+	Port        int       `json:"port"`
+	Username    string    `json:"username"`
+	SessionID   string    `json:"session_id"`
+	OpenedAt    time.Time `json:"opened_at"`
+	Connections int64     `json:"connections"` // accepted so far
+}
+
+type reverseForward struct {
+	ReverseForward
+	bindAddr string // as requested, echoed back in forwarded-tcpip channels
+	listener net.Listener
+}
+
+// reverseTable hands out ports from the configured range and remembers
+// which session owns each one
+type reverseTable struct {
+	mu        sync.Mutex
+	host      string
+	lo, hi    int
+	perClient int // ports one client may hold at once, 0 for unlimited
+	timeouts  *tunnel.Timeouts
+	ports     map[int]*reverseForward
+}
+
+func newReverseTable(host string, lo, hi, perClient int, timeouts *tunnel.Timeouts) *reverseTable {
+	return &reverseTable{host: host, lo: lo, hi: hi, perClient: perClient, timeouts: timeouts, ports: make(map[int]*reverseForward)}
+}
+
+// allocate binds port, or the first free port of the range when port is 0
+func (t *reverseTable) allocate(port int, fwd *reverseForward) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.perClient > 0 && t.held(fwd.Username) >= t.perClient {
+		return fmt.Errorf("'%s' already forwards %d ports, the most allowed", fwd.Username, t.perClient)
+	}
+
+	if port != 0 {
+		if port < t.lo || port > t.hi {
+			return fmt.Errorf("port %d is outside the reverse forwarding range %d-%d", port, t.lo, t.hi)
+		}
+		if owner, ok := t.ports[port]; ok {
+			return fmt.Errorf("port %d is already forwarded by '%s'", port, owner.Username)
+		}
+		return t.listen(port, fwd)
+	}
+
+	for p := t.lo; p <= t.hi; p++ {
+		if _, ok := t.ports[p]; ok {
+			continue
+		}
+		if err := t.listen(p, fwd); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no free port in the reverse forwarding range %d-%d", t.lo, t.hi)
+}
+
+// held counts the ports username has bound across its sessions
+func (t *reverseTable) held(username string) int {
+	n := 0
+	for _, fwd := range t.ports {
+		if fwd.Username == username {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *reverseTable) listen(port int, fwd *reverseForward) error {
+	l, err := t.timeouts.Listen(net.JoinHostPort(t.host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	fwd.Port = port
+	fwd.listener = l
+	t.ports[port] = fwd
+	return nil
+}
+
+// lookup returns the forward on port if sessionID owns it
+func (t *reverseTable) lookup(port int, sessionID string) (*reverseForward, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fwd, ok := t.ports[port]
+	if !ok || fwd.SessionID != sessionID {
+		return nil, false
+	}
+	return fwd, true
+}
+
+// release frees fwd's port and closes its listener
+func (t *reverseTable) release(fwd *reverseForward) {
+	t.mu.Lock()
+	if t.ports[fwd.Port] == fwd {
+		delete(t.ports, fwd.Port)
+	}
+	t.mu.Unlock()
+	_ = fwd.listener.Close()
+}
+
+func (t *reverseTable) list() []ReverseForward {
+	t.mu.Lock()
+	out := make([]ReverseForward, 0, len(t.ports))
+	for _, fwd := range t.ports {
+		snapshot := fwd.ReverseForward
+		snapshot.Connections = atomic.LoadInt64(&fwd.Connections)
+		out = append(out, snapshot)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out
+}
+
+// ReverseForwards lists the ports currently bound by clients
+func (s *Server) ReverseForwards() []ReverseForward {
+	if s == nil || s.reverse == nil {
+		return nil
+	}
+	return s.reverse.list()
+}
+
+type remoteForwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+// handleTCPIPForward serves "tcpip-forward" global requests (ssh -R)
+func (s *Server) handleTCPIPForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	client, ok := ctx.Value("client").(*models.Client)
+	if !ok || s.reverse == nil || !client.AllowReverse || !client.CanLogin() {
+		return false, nil
+	}
+
+	var msg remoteForwardRequest
+	if err := gossh.Unmarshal(req.Payload, &msg); err != nil {
+		return false, nil
+	}
+
+	conn := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+	tracker := s.getOrCreateSession(ctx, client)
+
+	fwd := &reverseForward{
+		ReverseForward: ReverseForward{
+			Username:  client.Username,
+			SessionID: ctx.SessionID(),
+			OpenedAt:  time.Now(),
+		},
+		bindAddr: msg.BindAddr,
+	}
+	if err := s.reverse.allocate(int(msg.BindPort), fwd); err != nil {
+		log.Printf("Rejected reverse forwarding for '%s': %v", client.Username, err)
+		return false, nil
+	}
+	log.Printf("User '%s' reverse forwarding port %d", client.Username, fwd.Port)
+
+	// The port is freed once the session ends
+	context.AfterFunc(tracker.session.Context(), func() { s.reverse.release(fwd) })
+
+	s.wg.Add(1)
+	go s.serveReverse(conn, tracker, fwd)
+
+	if msg.BindPort == 0 {
+		return true, gossh.Marshal(struct{ Port uint32 }{uint32(fwd.Port)})
+	}
+	return true, nil
+}
+
+// handleCancelTCPIPForward serves "cancel-tcpip-forward" global requests
+func (s *Server) handleCancelTCPIPForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	var msg remoteForwardRequest
+	if s.reverse == nil || gossh.Unmarshal(req.Payload, &msg) != nil {
+		return false, nil
+	}
+	fwd, ok := s.reverse.lookup(int(msg.BindPort), ctx.SessionID())
+	if ok {
+		s.reverse.release(fwd)
+	}
+	return ok, nil
+}
+
+func (s *Server) serveReverse(conn *gossh.ServerConn, tracker *sessionTracker, fwd *reverseForward) {
+	defer s.wg.Done()
+	defer s.reverse.release(fwd)
+
+	for {
+		c, err := fwd.listener.Accept()
+		if err != nil {
+			log.Printf("Reverse forwarding port %d closed (%s)", fwd.Port, fwd.Username)
+			return
+		}
+		if !s.cfg.Limits.Acquire() {
+			log.Printf("Refusing reverse connection to port %d (%s): server connection limit reached", fwd.Port, fwd.Username)
+			_ = c.Close()
+			continue
+		}
+		atomic.AddInt64(&fwd.Connections, 1)
+
+		s.wg.Add(1)
+		go s.forwardReverse(conn, tracker, fwd, s.cfg.Timeouts.Wrap(c))
+	}
+}
+
+func (s *Server) forwardReverse(conn *gossh.ServerConn, tracker *sessionTracker, fwd *reverseForward, c net.Conn) {
+	defer s.wg.Done()
+	defer s.cfg.Limits.Release()
+	defer c.Close()
+
+	origHost, origPortStr, _ := net.SplitHostPort(c.RemoteAddr().String())
+	origPort, _ := strconv.Atoi(origPortStr)
+	payload := gossh.Marshal(struct {
+		DestAddr string
+		DestPort uint32
+		OrigAddr string
+		OrigPort uint32
+	}{fwd.bindAddr, uint32(fwd.Port), origHost, uint32(origPort)})
+
+	ch, reqs, err := conn.OpenChannel("forwarded-tcpip", payload)
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go gossh.DiscardRequests(reqs)
+
+	// Forwarded connections half-close, so they don't go through Relay
+	stop := context.AfterFunc(tracker.session.Context(), func() {
+		_ = c.Close()
+		_ = ch.Close()
+	})
+	defer stop()
+
+	limit := tracker.client.TrafficLimit
+	if tracker.client.QuotaKeeps("") {
+		limit = 0
+	}
+	lastActivity := time.Now().UnixNano()
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		tr := &trafficReader{reader: ch, tracker: tracker, budget: tracker.budget(tracker.session.Context(), accounting.Upload, limit), lastActivity: &lastActivity}
+		defer tr.budget.Close()
+		_, _ = tunnel.Copy(c, tr)
+		_ = c.Close()
+	}()
+
+	go func() {
+		defer wg.Done()
+		tw := &trafficWriter{writer: ch, tracker: tracker, budget: tracker.budget(tracker.session.Context(), accounting.Download, limit), lastActivity: &lastActivity}
+		defer tw.budget.Close()
+		_, _ = tunnel.Copy(tw, c)
+		_ = ch.CloseWrite()
+	}()
+
+	wg.Wait()
+}
@@ -2,68 +2,163 @@ package sshserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/gliderlabs/ssh"
-	"github.com/libersuite-org/panel/database"
+	"github.com/libersuite-org/panel/accesslog"
+	"github.com/libersuite-org/panel/accounting"
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/bans"
+	"github.com/libersuite-org/panel/clock"
 	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/geoip"
+	"github.com/libersuite-org/panel/inproc"
+	"github.com/libersuite-org/panel/landing"
+	"github.com/libersuite-org/panel/locations"
+	"github.com/libersuite-org/panel/maintenance"
+	"github.com/libersuite-org/panel/reports"
+	"github.com/libersuite-org/panel/tunnel"
 	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
 )
 
 type Config struct {
-	Host    string
-	Port    int
-	HostKey string
+	Hosts          []string         // bind addresses, every interface when empty
+	Port           int              // 0 serves only InProcess connections
+	InProcess      *inproc.Listener // connections handed over by the mixed entrypoint, nil disables
+	HostKey        string
+	DB             *gorm.DB          // clients and their allowed IPs
+	Auth           *authcache.Cache  // looks clients up at login
+	TokenAuth      bool              // also accept the client's auth token as its password
+	StaleTimeout   time.Duration     // reap sessions with no traffic for this long, 0 disables
+	IdleTimeout    time.Duration     // close channels with no traffic for this long, 0 disables
+	AccessLog      *accesslog.Logger // records forwarded destinations, nil disables
+	Destinations   *accesslog.Stats  // counts forwarded destinations, nil disables
+	Landing        *landing.Landing  // renewal page for expired and out-of-traffic clients, nil turns them away
+	ACL            *acl.Engine       // destination rules, nil allows everything
+	GeoIP          *geoip.Policy     // source country restrictions, nil allows everything
+	Bans           *bans.Guard       // bans IPs with repeated failed logins, nil disables
+	Reports        *reports.Reporter // counts failed logins for operator reports, nil disables
+	Accounting     *accounting.Accountant
+	ReverseHost    string // address reverse forwards listen on
+	ReverseMin     int    // port range handed out for ssh -R, 0 disables reverse forwarding
+	ReverseMax     int
+	ReversePorts   int                 // ports a client may bind with ssh -R at once, 0 for unlimited
+	SessionPolicy  string              // one of the Session* policies for shell and exec requests
+	MOTD           *template.Template  // account summary template, nil uses DefaultMOTD
+	SupportContact string              // shown in the account summary
+	MOTDInBanner   bool                // also send the summary as the pre-auth banner
+	Timeouts       *tunnel.Timeouts    // keepalive and deadlines of client and forwarded connections
+	Limits         *tunnel.Limits      // server-wide tunnel cap, nil allows everything
+	Dials          *tunnel.DialLimiter // server-wide cap on dials in progress, nil allows everything
+	Maintenance    *maintenance.Mode   // turns new logins away while on, nil disables
+	Locations      *locations.Watcher  // flags logins from new countries and networks, nil disables
+	OutboundIP     net.IP              // source address of forwarded connections unless the client has its own, nil lets the system pick
+	Upstreams      *tunnel.Upstreams   // proxies forwarded connections go through, nil dials directly
+	Resolver       *tunnel.Resolver    // resolves forwarded destinations, nil uses the system resolver
+	CountPayload   bool                // count only forwarded channel data instead of the whole connection
+	MaxChannels    int                 // direct-tcpip channels a session may have open at once unless the client sets its own, 0 for unlimited
 }
 
 type Server struct {
-	cfg         *Config
-	server      *ssh.Server
-	sessions    map[string]*sessionTracker
-	connections map[string]*gossh.ServerConn
-	mu          sync.RWMutex
-	wg          sync.WaitGroup
-	ctx         context.Context
+	cfg       *Config
+	server    *ssh.Server
+	sessions  *sessionRegistry
+	conns     *tunnel.Sessions // every connection, logged in or not, for kicks and forced shutdown
+	reverse   *reverseTable    // nil when reverse forwarding is disabled
+	wg        sync.WaitGroup
+	ctx       context.Context
+	stopped   chan struct{} // closed once Shutdown has drained the sessions
+	reaper    sync.Once     // starts staleReaper on the first Start
+	listening atomic.Bool
 }
 
 type sessionTracker struct {
+	session      *tunnel.Session // ends when the connection closes; its channels stop with it
 	client       *models.Client
-	bytesRead    int64
-	bytesWritten int64
+	meter        *accounting.Meter
+	lastActivity int64 // unix nanoseconds of the last transferred byte
 	startTime    time.Time
-	conns        sync.Map
+	remoteAddr   string
+	wire         bool // the connection is counted, so channels don't count their data again
+
+	channels         sync.Map // *channelStat of each open direct-tcpip channel
+	openChannels     atomic.Int64
+	channelsOpened   atomic.Int64
+	channelsRejected atomic.Int64
 }
 
 func New(cfg *Config) *Server {
-	return &Server{
-		cfg:         cfg,
-		sessions:    make(map[string]*sessionTracker),
-		connections: make(map[string]*gossh.ServerConn),
+	s := &Server{
+		cfg:      cfg,
+		sessions: newSessionRegistry(),
+		conns:    tunnel.NewSessions(),
+		stopped:  make(chan struct{}),
+	}
+	if cfg.ReverseMin > 0 {
+		s.reverse = newReverseTable(cfg.ReverseHost, cfg.ReverseMin, cfg.ReverseMax, cfg.ReversePorts, cfg.Timeouts)
 	}
+	return s
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	s.ctx = ctx
 
 	server := &ssh.Server{
-		Addr:            fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port),
 		PasswordHandler: s.passwordHandler,
+		ConnCallback: func(ctx ssh.Context, conn net.Conn) net.Conn {
+			if s.cfg.Bans.Banned(conn.RemoteAddr()) {
+				return nil
+			}
+			if s.cfg.Limits.Full() {
+				log.Printf("Refusing SSH connection from %s: server connection limit reached", conn.RemoteAddr())
+				return nil
+			}
+			// Ending the session closes the connection, which cancels ctx
+			// in turn when it closes on its own
+			sess := s.conns.Open()
+			context.AfterFunc(sess.Context(), func() { _ = conn.Close() })
+			context.AfterFunc(ctx, sess.End)
+			ctx.SetValue(contextKeySession, sess)
+			conn = s.cfg.Timeouts.Wrap(conn)
+			if s.cfg.CountPayload {
+				return conn
+			}
+			wire := &wireConn{Conn: conn}
+			ctx.SetValue(contextKeyWire, wire)
+			return wire
+		},
 		LocalPortForwardingCallback: func(ctx ssh.Context, dhost string, dport uint32) bool {
 			log.Printf("Local port forwarding request from %s to %s:%d", ctx.User(), dhost, dport)
-			return true
+			client, ok := ctx.Value("client").(*models.Client)
+			return ok && acl.CheckForward(client, int(dport)) == nil
 		},
 		ReversePortForwardingCallback: func(ctx ssh.Context, bindHost string, bindPort uint32) bool {
-			return false
+			client, ok := ctx.Value("client").(*models.Client)
+			return ok && s.reverse != nil && client.AllowReverse
 		},
 		ChannelHandlers: map[string]ssh.ChannelHandler{
 			"direct-tcpip": s.directTCPIPHandler,
 		},
+		RequestHandlers: map[string]ssh.RequestHandler{
+			"tcpip-forward":        s.handleTCPIPForward,
+			"cancel-tcpip-forward": s.handleCancelTCPIPForward,
+		},
+	}
+	server.BannerHandler = s.bannerHandler
+	if s.cfg.SessionPolicy != SessionReject {
+		server.ChannelHandlers["session"] = ssh.DefaultSessionHandler
+		server.Handler = s.sessionHandler
 	}
 
 	if s.cfg.HostKey != "" {
@@ -73,48 +168,129 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	s.server = server
-	log.Printf("Starting SSH server on %s:%d", s.cfg.Host, s.cfg.Port)
 
-	s.wg.Add(1)
-	go s.usageFlusher()
+	var listeners []net.Listener
+	if s.cfg.Port != 0 {
+		for _, addr := range tunnel.ListenAddrs(s.cfg.Hosts, s.cfg.Port) {
+			listener, err := s.cfg.Timeouts.Listen(addr)
+			if err != nil {
+				for _, l := range listeners {
+					_ = l.Close()
+				}
+				return fmt.Errorf("failed to start SSH listener on %s: %w", addr, err)
+			}
+			log.Printf("Starting SSH server on %s", addr)
+			listeners = append(listeners, listener)
+		}
+	}
+	if s.cfg.InProcess != nil {
+		log.Println("SSH server accepting in-process connections from the mixed entrypoint")
+		listeners = append(listeners, s.cfg.InProcess.Attach())
+	}
 
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- server.ListenAndServe()
-	}()
+	if s.cfg.StaleTimeout > 0 {
+		s.reaper.Do(func() {
+			s.wg.Add(1)
+			go s.staleReaper()
+		})
+	}
+
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	errChan := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			errChan <- server.Serve(listener)
+		}()
+	}
 
 	select {
 	case <-ctx.Done():
 		log.Println("Context cancelled, initiating shutdown...")
 		return nil
 	case err := <-errChan:
+		// The open sessions carry on; only accepting stops until a restart
+		for _, l := range listeners {
+			_ = l.Close()
+		}
 		return err
 	}
 }
 
-func (s *Server) usageFlusher() {
+// Listening reports whether the server is accepting connections
+func (s *Server) Listening() bool {
+	return s != nil && s.listening.Load()
+}
+
+// Sessions returns the number of SSH connections that have opened a tunnel
+func (s *Server) Sessions() int {
+	if s == nil {
+		return 0
+	}
+	return s.sessions.len()
+}
+
+// staleReaper closes sessions that have not transferred a byte within
+// StaleTimeout, independently of any per-channel idle handling
+func (s *Server) staleReaper() {
 	defer s.wg.Done()
-	ticker := time.NewTicker(time.Minute)
+	interval := s.cfg.StaleTimeout / 4
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			s.flushAll()
+			s.reapStale()
 		case <-s.ctx.Done():
-			s.flushAll()
 			return
+		case <-s.stopped:
+			return
+		}
+	}
+}
+
+func (s *Server) reapStale() {
+	cutoff := time.Now().Add(-s.cfg.StaleTimeout).UnixNano()
+
+	// watchSession cleans up the registry once the connection is gone
+	s.sessions.forEach(func(id string, e *sessionEntry) {
+		if atomic.LoadInt64(&e.tracker.lastActivity) < cutoff {
+			log.Printf("Reaping stale session %s (%s)", id, e.tracker.client.Username)
+			e.tracker.session.End()
 		}
+	})
+}
+
+// Kick closes the connections of username and returns how many there were
+func (s *Server) Kick(username string) int {
+	if s == nil {
+		return 0
 	}
+	return s.conns.Kick(username)
 }
 
+// Shutdown stops accepting connections and waits for open sessions to end
+// until ctx is done, then closes the ones left
 func (s *Server) Shutdown(ctx context.Context) error {
 	log.Println("Starting graceful shutdown...")
 
 	if s.server != nil {
-		if err := s.server.Close(); err != nil {
-			log.Printf("Error closing SSH server: %v", err)
+		if err := s.server.Shutdown(ctx); err != nil && ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error closing SSH listeners: %v", err)
 		}
+		if ctx.Err() != nil {
+			log.Println("Shutdown timeout reached, closing remaining SSH connections")
+			s.conns.CloseAll()
+		}
+	}
+	close(s.stopped)
+	if s.cfg.InProcess != nil {
+		_ = s.cfg.InProcess.Close()
 	}
 
 	done := make(chan struct{})
@@ -126,36 +302,79 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	select {
 	case <-done:
 	case <-ctx.Done():
-		log.Println("Shutdown timeout reached, forcing exit")
 	}
 
-	s.flushAll()
 	return nil
 }
 
 func (s *Server) passwordHandler(ctx ssh.Context, password string) bool {
 	username := ctx.User()
 
-	var client models.Client
-	if err := database.DB.Where("username = ?", username).First(&client).Error; err != nil {
+	if _, on := s.cfg.Maintenance.Active(); on {
+		log.Printf("Authentication refused for user '%s': server is in maintenance mode", username)
+		return false
+	}
+
+	client, err := s.cfg.Auth.Lookup(username)
+	if err != nil {
 		log.Printf("Authentication failed for user '%s': user not found", username)
+		s.cfg.Bans.Fail(ctx.RemoteAddr(), "ssh")
+		s.cfg.Reports.AuthFailed("ssh")
 		return false
 	}
 
-	if client.Password != password {
+	if client.Password != password && !(s.cfg.TokenAuth && client.TokenValid(password)) {
 		log.Printf("Authentication failed for user '%s': invalid password", username)
+		s.cfg.Bans.Fail(ctx.RemoteAddr(), "ssh")
+		s.cfg.Reports.AuthFailed("ssh")
 		return false
 	}
+	s.cfg.Bans.Succeed(ctx.RemoteAddr())
 
-	if !client.IsActive() {
+	if !client.CanLogin() && !s.cfg.Landing.Admits(&client) {
 		log.Printf("Authentication failed for user '%s': account inactive", username)
 		return false
 	}
 
-	client.LastConnection = time.Now()
-	database.DB.Save(&client)
+	if protocol := models.EntryProtocol(ctx.RemoteAddr(), models.ProtocolSSH); !client.AllowsProtocol(protocol) {
+		log.Printf("Authentication failed for user '%s': %s logins are not allowed", username, protocol)
+		return false
+	}
+
+	countries, _ := geoip.ParseCountries(client.Countries)
+	if country, ok := s.cfg.GeoIP.Check(ctx.RemoteAddr(), countries); !ok {
+		log.Printf("Authentication failed for user '%s': connections from country '%s' are not allowed", username, country)
+		return false
+	}
+
+	boundIP := client.BoundIP
+	if ok, err := client.CheckIP(s.cfg.DB, models.SourceIP(ctx.RemoteAddr())); err != nil || !ok {
+		log.Printf("Authentication failed for user '%s': account is locked to %s", username, client.BoundIP)
+		return false
+	}
+
+	if client.MaxConnections > 0 && s.sessions.countClient(client.ID) >= client.MaxConnections {
+		log.Printf("Authentication failed for user '%s': already has %d sessions", username, client.MaxConnections)
+		return false
+	}
+
+	if !s.cfg.Locations.Check(&client, ctx.RemoteAddr()) {
+		log.Printf("Authentication failed for user '%s': disabled after a login from a new location", username)
+		return false
+	}
+
+	activated := client.Activate(clock.Now())
+	if activated {
+		log.Printf("User '%s' activated, expires at %s", username, client.ExpiresAt.Format("2006-01-02"))
+		s.cfg.DB.Model(&client).Select("expires_at", "activate_days").Updates(&client)
+	}
+	s.cfg.Accounting.Seen(&client, time.Now())
+	if activated || client.BoundIP != boundIP {
+		s.cfg.Auth.Invalidate(username)
+	}
 
 	ctx.SetValue("client", &client)
+	sessionOf(ctx).SetUser(username)
 
 	log.Printf("User '%s' authenticated successfully", username)
 	return true
@@ -169,9 +388,7 @@ func (s *Server) directTCPIPHandler(srv *ssh.Server, conn *gossh.ServerConn, new
 	}
 
 	client := clientInterface.(*models.Client)
-	sessionID := ctx.SessionID()
-
-	tracker := s.getOrCreateSession(sessionID, client, conn)
+	tracker := s.getOrCreateSession(ctx, client)
 
 	var drtMsg struct {
 		DestAddr string
@@ -185,6 +402,71 @@ func (s *Server) directTCPIPHandler(srv *ssh.Server, conn *gossh.ServerConn, new
 		return
 	}
 
+	dest := net.JoinHostPort(drtMsg.DestAddr, strconv.FormatUint(uint64(drtMsg.DestPort), 10))
+
+	maxChannels := s.cfg.MaxChannels
+	if client.MaxChannels > 0 {
+		maxChannels = client.MaxChannels
+	}
+	if !tracker.reserveChannel(maxChannels) {
+		if tracker.channelsRejected.Load() == 1 {
+			log.Printf("Rejecting channels of user '%s' past the limit of %d open per session", client.Username, maxChannels)
+		}
+		newChan.Reject(gossh.ResourceShortage, "too many open channels")
+		return
+	}
+	defer tracker.releaseChannel()
+
+	// Connections the quota action keeps are never cut. Lapsed clients get
+	// the landing page for the rest, but the renewal site, which they may
+	// reach whatever their quota.
+	limit := client.TrafficLimit
+	kept := client.QuotaKeeps(dest)
+	if kept {
+		limit = 0
+	}
+	if !client.CanLogin() || (!kept && s.cfg.Accounting.OutOfTraffic(client)) {
+		if !s.cfg.Landing.Exempt(dest) {
+			if s.cfg.Landing == nil {
+				newChan.Reject(gossh.Prohibited, "out of traffic")
+				return
+			}
+			ch, reqs, err := newChan.Accept()
+			if err != nil {
+				return
+			}
+			go gossh.DiscardRequests(reqs)
+			log.Printf("Serving the landing page to lapsed user '%s' for %s", client.Username, dest)
+			s.cfg.Landing.Serve(ch, client)
+			return
+		}
+		limit = 0
+	}
+
+	dialAddrs := []string{dest}
+	err := acl.CheckForward(client, int(drtMsg.DestPort))
+	if err == nil {
+		dialAddrs, err = s.cfg.ACL.Check(tracker.session.Context(), client.ID, dest)
+	}
+	if err != nil {
+		s.cfg.AccessLog.Log("ssh", client.Username, ctx.RemoteAddr().String(), dest, err)
+		s.cfg.Destinations.Record(client.Username, dest, err)
+		log.Printf("Rejected forwarding from %s to %s: %v", client.Username, dest, err)
+		if errors.Is(err, acl.ErrDenied) {
+			newChan.Reject(gossh.Prohibited, "destination not allowed")
+		} else {
+			newChan.Reject(gossh.ConnectionFailed, "invalid destination")
+		}
+		return
+	}
+
+	if !s.cfg.Limits.Acquire() {
+		log.Printf("Rejected forwarding from %s to %s: server connection limit reached", client.Username, dest)
+		newChan.Reject(gossh.ResourceShortage, "server connection limit reached")
+		return
+	}
+	defer s.cfg.Limits.Release()
+
 	ch, reqs, err := newChan.Accept()
 	if err != nil {
 		return
@@ -193,150 +475,160 @@ func (s *Server) directTCPIPHandler(srv *ssh.Server, conn *gossh.ServerConn, new
 
 	go gossh.DiscardRequests(reqs)
 
-	dest := fmt.Sprintf("%s:%d", drtMsg.DestAddr, drtMsg.DestPort)
+	chCtx, cancel := context.WithCancel(tracker.session.Context())
+	defer cancel()
 
-	dialer := &net.Dialer{
-		Timeout: 10 * time.Second,
-	}
-
-	dconn, err := dialer.DialContext(s.ctx, "tcp", dest)
+	dconn, err := s.dial(chCtx, client, dest, dialAddrs)
+	s.cfg.AccessLog.Log("ssh", client.Username, ctx.RemoteAddr().String(), dest, err)
+	s.cfg.Destinations.Record(client.Username, dest, err)
 	if err != nil {
 		log.Printf("Failed to connect to %s: %v", dest, err)
 		return
 	}
+	dconn = s.cfg.Timeouts.Wrap(dconn)
 	defer dconn.Close()
 
-	tracker.conns.Store(dconn, struct{}{})
-	defer tracker.conns.Delete(dconn)
-
-	tracker.conns.Store(ch, struct{}{})
-	defer tracker.conns.Delete(ch)
+	channel := &channelStat{dest: dest, openedAt: time.Now()}
+	tracker.channels.Store(channel, struct{}{})
+	defer tracker.channels.Delete(channel)
 
 	s.wg.Add(1)
 	defer s.wg.Done()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		tr := &trafficReader{reader: ch, tracker: tracker, client: client}
-		_, _ = io.Copy(dconn, tr)
-	}()
-
-	go func() {
-		defer wg.Done()
-		tw := &trafficWriter{writer: ch, tracker: tracker, client: client}
-		_, _ = io.Copy(tw, dconn)
-	}()
+	lastActivity := time.Now().UnixNano()
+	if s.cfg.IdleTimeout > 0 {
+		go tunnel.WatchIdle(chCtx, &lastActivity, s.cfg.IdleTimeout, func() {
+			log.Printf("Closing idle channel for user '%s' to %s", client.Username, dest)
+			cancel()
+		})
+	}
 
-	wg.Wait()
+	tr := &trafficReader{reader: ch, tracker: tracker, channel: channel, budget: tracker.budget(chCtx, accounting.Upload, limit), lastActivity: &lastActivity}
+	defer tr.budget.Close()
+	tw := &trafficWriter{writer: ch, tracker: tracker, channel: channel, budget: tracker.budget(chCtx, accounting.Download, limit), lastActivity: &lastActivity}
+	defer tw.budget.Close()
+	tunnel.Relay(chCtx,
+		func() { _, _ = tunnel.Copy(dconn, tr) },
+		func() { _, _ = tunnel.Copy(tw, dconn) },
+		ch, dconn)
 }
 
-func (s *Server) getOrCreateSession(id string, client *models.Client, conn *gossh.ServerConn) *sessionTracker {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if t, ok := s.sessions[id]; ok {
-		return t
+// dial connects to a client's forward target. Through an upstream the
+// requested dest is dialed, so hostnames resolve at the exit; directly, the
+// dialAddrs the ACL approved.
+func (s *Server) dial(ctx context.Context, client *models.Client, dest string, dialAddrs []string) (net.Conn, error) {
+	up, err := s.cfg.Upstreams.For(client.Upstream)
+	if err != nil {
+		return nil, err
 	}
-
-	t := &sessionTracker{
-		client:    client,
-		startTime: time.Now(),
+	if up != nil {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return up.DialContext(ctx, dest)
 	}
-	s.sessions[id] = t
-	s.connections[id] = conn
+	return s.cfg.Dials.Dial(ctx, s.cfg.Timeouts.Dialer(10*time.Second), tunnel.SourceIP(client.OutboundIP, s.cfg.OutboundIP), s.cfg.Resolver, dialAddrs...)
+}
 
-	s.wg.Add(1)
-	go s.watchSession(id, conn)
+func (s *Server) getOrCreateSession(ctx ssh.Context, client *models.Client) *sessionTracker {
+	id := ctx.SessionID()
+	conn := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+	e, created := s.sessions.getOrCreate(id, func() *sessionEntry {
+		tracker := &sessionTracker{
+			session:      sessionOf(ctx),
+			client:       client,
+			meter:        s.cfg.Accounting.Acquire(client),
+			lastActivity: time.Now().UnixNano(),
+			startTime:    time.Now(),
+			remoteAddr:   ctx.RemoteAddr().String(),
+		}
+		if wire := wireOf(ctx); wire != nil {
+			wire.attach(tracker.meter)
+			tracker.wire = true
+		}
+		return &sessionEntry{tracker: tracker, conn: conn}
+	})
 
-	return t
+	if created {
+		s.wg.Add(1)
+		go s.watchSession(id, conn)
+	}
+
+	return e.tracker
 }
 
 func (s *Server) watchSession(id string, conn *gossh.ServerConn) {
 	defer s.wg.Done()
 	conn.Wait()
 
-	s.mu.Lock()
-	tracker := s.sessions[id]
-	delete(s.sessions, id)
-	delete(s.connections, id)
-	s.mu.Unlock()
-
-	if tracker != nil {
-		tracker.conns.Range(func(key, _ any) bool {
-			switch c := key.(type) {
-			case net.Conn:
-				_ = c.Close()
-			case io.Closer:
-				_ = c.Close()
-			}
-			return true
-		})
-
-		s.flushOne(tracker)
+	// The session has ended by now, so its channels and reverse forwards
+	// are closing
+	if e := s.sessions.remove(id); e != nil {
+		tracker := e.tracker
+		s.cfg.Accounting.Release(tracker.meter)
 		log.Printf("Session %s closed (%s)", id, tracker.client.Username)
 	}
 }
 
-func (s *Server) flushAll() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for _, t := range s.sessions {
-		s.flushOne(t)
-	}
-}
-
-func (s *Server) flushOne(t *sessionTracker) {
-	used := atomic.SwapInt64(&t.bytesRead, 0) + atomic.SwapInt64(&t.bytesWritten, 0)
-	if used == 0 {
-		return
-	}
-
-	t.client.TrafficUsed += used
-	database.DB.Save(t.client)
+// budget returns a budget for one direction of a channel, which adds its
+// bytes to the meter unless the wire already counts them
+func (t *sessionTracker) budget(ctx context.Context, dir accounting.Direction, limit int64) *accounting.Budget {
+	return t.meter.Budget(ctx, dir, limit, !t.wire)
 }
 
 type trafficReader struct {
-	reader  io.Reader
-	tracker *sessionTracker
-	client  *models.Client
+	reader       io.Reader
+	tracker      *sessionTracker
+	channel      *channelStat       // nil for reverse forwards
+	budget       *accounting.Budget // runs out at the traffic limit past which the channel is closed
+	lastActivity *int64             // per-channel, for the idle timeout
 }
 
 func (tr *trafficReader) Read(p []byte) (n int, err error) {
-	n, err = tr.reader.Read(p)
+	n, err = tr.reader.Read(p[:tr.budget.Limit(len(p))])
 	if n > 0 {
-		atomic.AddInt64(&tr.tracker.bytesRead, int64(n))
+		now := time.Now().UnixNano()
+		if tr.channel != nil {
+			tr.channel.upload.Add(int64(n))
+		}
+		atomic.StoreInt64(&tr.tracker.lastActivity, now)
+		atomic.StoreInt64(tr.lastActivity, now)
 
-		if tr.client.TrafficLimit > 0 {
-			totalUsed := tr.client.TrafficUsed + atomic.LoadInt64(&tr.tracker.bytesRead) + atomic.LoadInt64(&tr.tracker.bytesWritten)
-			if totalUsed >= tr.client.TrafficLimit {
-				return n, io.EOF
-			}
+		if !tr.budget.Use(n) {
+			return n, io.EOF
 		}
 	}
 	return n, err
 }
 
 type trafficWriter struct {
-	writer  io.Writer
-	tracker *sessionTracker
-	client  *models.Client
+	writer       io.Writer
+	tracker      *sessionTracker
+	channel      *channelStat       // nil for reverse forwards
+	budget       *accounting.Budget // runs out at the traffic limit past which the channel is closed
+	lastActivity *int64             // per-channel, for the idle timeout
 }
 
+// Write passes p on in pieces small enough to throttle without long pauses
 func (tw *trafficWriter) Write(p []byte) (n int, err error) {
-	n, err = tw.writer.Write(p)
-	if n > 0 {
-		atomic.AddInt64(&tw.tracker.bytesWritten, int64(n))
+	for len(p) > 0 {
+		w, err := tw.writer.Write(p[:tw.budget.Limit(len(p))])
+		n += w
+		p = p[w:]
+		if w > 0 {
+			now := time.Now().UnixNano()
+			if tw.channel != nil {
+				tw.channel.download.Add(int64(w))
+			}
+			atomic.StoreInt64(&tw.tracker.lastActivity, now)
+			atomic.StoreInt64(tw.lastActivity, now)
 
-		if tw.client.TrafficLimit > 0 {
-			totalUsed := tw.client.TrafficUsed + atomic.LoadInt64(&tw.tracker.bytesRead) + atomic.LoadInt64(&tw.tracker.bytesWritten)
-			if totalUsed >= tw.client.TrafficLimit {
+			if !tw.budget.Use(w) {
 				return n, io.ErrShortWrite
 			}
 		}
+		if err != nil {
+			return n, err
+		}
 	}
-	return n, err
+	return n, nil
 }
@@ -0,0 +1,139 @@
+package sshserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/libersuite-org/panel/database/models"
+	"golang.org/x/term"
+)
+
+// What the server does when a client opens a shell or runs a command
+const (
+	SessionReject = "reject" // refuse session channels
+	SessionDeny   = "deny"   // print a notice and exit
+	SessionStatus = "status" // print the account status and exit
+	SessionShell  = "shell"  // restricted shell with account commands only
+)
+
+const denyNotice = "This server only provides port forwarding; shell access is not available."
+
+const shellHelp = `Commands:
+  status   show traffic and expiry of this account
+  help     show this help
+  exit     close the session`
+
+// ValidSessionPolicy reports whether policy is one of the Session* values
+func ValidSessionPolicy(policy string) bool {
+	switch policy {
+	case SessionReject, SessionDeny, SessionStatus, SessionShell:
+		return true
+	}
+	return false
+}
+
+func (s *Server) sessionHandler(sess ssh.Session) {
+	client, ok := sess.Context().Value("client").(*models.Client)
+	if !ok {
+		_ = sess.Exit(1)
+		return
+	}
+	tracker := s.getOrCreateSession(sess.Context(), client)
+
+	_, _, isPty := sess.Pty()
+	out := io.Writer(sess)
+	if isPty {
+		out = crlfWriter{sess}
+	}
+
+	switch s.cfg.SessionPolicy {
+	case SessionStatus:
+		fmt.Fprintln(out, s.motd(client, tracker.meter.Used()))
+		_ = sess.Exit(0)
+	case SessionShell:
+		if cmd := sess.RawCommand(); cmd != "" {
+			code := s.runShellCommand(out, cmd, client, tracker)
+			_ = sess.Exit(code)
+			return
+		}
+		s.restrictedShell(sess, isPty, client, tracker)
+	default:
+		fmt.Fprintf(out, "%s\n\n%s\n", s.motd(client, tracker.meter.Used()), denyNotice)
+		_ = sess.Exit(1)
+	}
+}
+
+// restrictedShell reads commands until exit or EOF
+func (s *Server) restrictedShell(sess ssh.Session, isPty bool, client *models.Client, tracker *sessionTracker) {
+	log.Printf("User '%s' opened the restricted shell", client.Username)
+	prompt := client.Username + "> "
+
+	if isPty {
+		// Terminal translates \n to \r\n itself
+		t := term.NewTerminal(sess, prompt)
+		fmt.Fprintf(t, "%s\nType 'help' for commands.\n", s.motd(client, tracker.meter.Used()))
+		for {
+			line, err := t.ReadLine()
+			if err != nil {
+				_ = sess.Exit(0)
+				return
+			}
+			if isExit(line) {
+				_ = sess.Exit(0)
+				return
+			}
+			s.runShellCommand(t, line, client, tracker)
+		}
+	}
+
+	scanner := bufio.NewScanner(sess)
+	for scanner.Scan() {
+		if isExit(scanner.Text()) {
+			break
+		}
+		s.runShellCommand(sess, scanner.Text(), client, tracker)
+	}
+	_ = sess.Exit(0)
+}
+
+func isExit(line string) bool {
+	switch strings.TrimSpace(line) {
+	case "exit", "quit", "logout":
+		return true
+	}
+	return false
+}
+
+// runShellCommand executes one restricted shell command and returns its
+// exit code
+func (s *Server) runShellCommand(out io.Writer, line string, client *models.Client, tracker *sessionTracker) int {
+	switch strings.TrimSpace(line) {
+	case "":
+		return 0
+	case "status":
+		fmt.Fprintln(out, s.motd(client, tracker.meter.Used()))
+		return 0
+	case "help":
+		fmt.Fprintln(out, shellHelp)
+		return 0
+	default:
+		fmt.Fprintf(out, "unknown command '%s', type 'help' for commands\n", strings.TrimSpace(line))
+		return 127
+	}
+}
+
+// crlfWriter translates line endings for clients with a pty
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write([]byte(strings.ReplaceAll(string(p), "\n", "\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,83 @@
+package sshserver
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/libersuite-org/panel/accounting"
+	"github.com/libersuite-org/panel/tunnel"
+)
+
+// contextKeyWire holds the connection's *wireConn in its ssh.Context
+var contextKeyWire = &struct{ name string }{"wire"}
+
+// contextKeySession holds the connection's *tunnel.Session in its
+// ssh.Context
+var contextKeySession = &struct{ name string }{"session"}
+
+// sessionOf returns the session ConnCallback opened for the connection of
+// ctx
+func sessionOf(ctx ssh.Context) *tunnel.Session {
+	return ctx.Value(contextKeySession).(*tunnel.Session)
+}
+
+// wireConn counts the bytes of an SSH connection as they cross the socket.
+// Bytes before the first channel, such as the handshake, are held until
+// attach gives them a meter to go to.
+type wireConn struct {
+	net.Conn
+	meter   atomic.Pointer[accounting.Meter]
+	mu      sync.Mutex // guards pending, and meter while it is being set
+	pending [2]int     // indexed by accounting.Direction
+}
+
+func (c *wireConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.count(n, accounting.Upload)
+	return n, err
+}
+
+func (c *wireConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.count(n, accounting.Download)
+	return n, err
+}
+
+func (c *wireConn) count(n int, dir accounting.Direction) {
+	if n <= 0 {
+		return
+	}
+	// Once attached the meter never changes, so only the handshake locks
+	if m := c.meter.Load(); m != nil {
+		m.Add(n, dir)
+		return
+	}
+	c.mu.Lock()
+	m := c.meter.Load()
+	if m == nil {
+		c.pending[dir] += n
+	}
+	c.mu.Unlock()
+	if m != nil {
+		m.Add(n, dir)
+	}
+}
+
+// attach charges the held bytes and everything after them to m
+func (c *wireConn) attach(m *accounting.Meter) {
+	c.mu.Lock()
+	c.meter.Store(m)
+	pending := c.pending
+	c.pending = [2]int{}
+	c.mu.Unlock()
+	m.Add(pending[accounting.Upload], accounting.Upload)
+	m.Add(pending[accounting.Download], accounting.Download)
+}
+
+// wireOf returns the connection's wireConn, or nil when the wire is not counted
+func wireOf(ctx ssh.Context) *wireConn {
+	c, _ := ctx.Value(contextKeyWire).(*wireConn)
+	return c
+}
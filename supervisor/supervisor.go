@@ -0,0 +1,282 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Service is a part of the server that runs until its context is done, such
+// as a listener or a background job
+type Service interface {
+	// Start runs the service until ctx is done and then returns nil. An
+	// error means the service stopped on its own, having released what it
+	// acquired, so Start can be called again.
+	Start(ctx context.Context) error
+}
+
+// Shutdowner is a Service that stops gracefully, finishing its work in
+// progress until ctx is done
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Service states
+const (
+	StateStarting   = "starting"
+	StateRunning    = "running"
+	StateRestarting = "restarting" // failed and waiting to start again
+	StateStopped    = "stopped"
+)
+
+// Restart backoff: a failed service waits minBackoff before starting again,
+// twice as long after each failure in a row up to maxBackoff. Running for
+// stableAfter counts as recovered and resets the delay.
+const (
+	minBackoff  = time.Second
+	maxBackoff  = time.Minute
+	stableAfter = time.Minute
+)
+
+// Status describes a supervised service
+type Status struct {
+	Name        string    `json:"name"`
+	State       string    `json:"state"`
+	Since       time.Time `json:"since"` // when the service entered State
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+type entry struct {
+	name     string
+	svc      Service
+	critical bool
+
+	mu       sync.Mutex
+	status   Status
+	stopping bool
+	stop     chan struct{} // closed by Shutdown to end a backoff early
+}
+
+func (e *entry) set(state string) {
+	e.mu.Lock()
+	e.status.State = state
+	e.status.Since = time.Now()
+	e.mu.Unlock()
+}
+
+// Supervisor runs services, restarting those that fail with a backoff so a
+// failing subsystem, such as a DNS listener whose port is taken, doesn't take
+// the rest of the server down with it
+type Supervisor struct {
+	mu       sync.Mutex
+	entries  []*entry
+	byName   map[string]*entry
+	wg       sync.WaitGroup
+	critical chan error
+}
+
+func New() *Supervisor {
+	return &Supervisor{byName: make(map[string]*entry), critical: make(chan error, 1)}
+}
+
+// Add supervises svc under name. Services are added before Run.
+func (s *Supervisor) Add(name string, svc Service) {
+	s.add(name, svc, false)
+}
+
+// AddCritical supervises svc like Add, except that its failure stops Run
+// with the error instead of restarting it
+func (s *Supervisor) AddCritical(name string, svc Service) {
+	s.add(name, svc, true)
+}
+
+func (s *Supervisor) add(name string, svc Service, critical bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byName[name]; ok {
+		panic(fmt.Sprintf("supervisor: service %s added twice", name))
+	}
+	e := &entry{name: name, svc: svc, critical: critical, stop: make(chan struct{})}
+	e.status = Status{Name: name, State: StateStarting, Since: time.Now()}
+	s.entries = append(s.entries, e)
+	s.byName[name] = e
+}
+
+// Run starts every service and keeps them running until ctx is done, then
+// waits for them to return. It returns early with the error of a critical
+// service that failed.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.supervise(ctx, e)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case err := <-s.critical:
+		return err
+	}
+}
+
+func (s *Supervisor) supervise(ctx context.Context, e *entry) {
+	backoff := minBackoff
+	for restart := false; ; restart = true {
+		e.mu.Lock()
+		if e.stopping || ctx.Err() != nil {
+			e.mu.Unlock()
+			e.set(StateStopped)
+			return
+		}
+		if restart {
+			e.status.Restarts++
+		}
+		e.mu.Unlock()
+
+		e.set(StateRunning)
+		started := time.Now()
+		err := start(ctx, e.svc)
+
+		e.mu.Lock()
+		stopping := e.stopping
+		e.mu.Unlock()
+		if stopping || ctx.Err() != nil {
+			e.set(StateStopped)
+			return
+		}
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+
+		if e.critical {
+			e.fail(err)
+			e.set(StateStopped)
+			select {
+			case s.critical <- fmt.Errorf("%s: %w", e.name, err):
+			default:
+			}
+			return
+		}
+
+		if time.Since(started) >= stableAfter {
+			backoff = minBackoff
+		}
+		e.fail(err)
+		e.set(StateRestarting)
+		log.Printf("Service %s failed: %v (restarting in %s)", e.name, err, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		case <-e.stop:
+			timer.Stop()
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (e *entry) fail(err error) {
+	e.mu.Lock()
+	e.status.LastError = err.Error()
+	e.status.LastErrorAt = time.Now()
+	e.mu.Unlock()
+}
+
+// start runs svc, turning a panic into an error
+func start(ctx context.Context, svc Service) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return svc.Start(ctx)
+}
+
+// Shutdown stops the named services for good, calling Shutdown on those
+// that have it concurrently and waiting for them until ctx is done. Unknown
+// names are ignored.
+func (s *Supervisor) Shutdown(ctx context.Context, names ...string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(names))
+	for i, name := range names {
+		s.mu.Lock()
+		e := s.byName[name]
+		s.mu.Unlock()
+		if e == nil {
+			continue
+		}
+
+		e.mu.Lock()
+		if !e.stopping {
+			e.stopping = true
+			close(e.stop)
+		}
+		e.mu.Unlock()
+
+		if sd, ok := e.svc.(Shutdowner); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := sd.Shutdown(ctx); err != nil {
+					errs[i] = fmt.Errorf("%s: %w", name, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Status returns the status of every service in the order they were added
+func (s *Supervisor) Status() []Status {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+
+	out := make([]Status, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		out = append(out, e.status)
+		e.mu.Unlock()
+	}
+	return out
+}
+
+// Lookup returns the status of the service called name
+func (s *Supervisor) Lookup(name string) (Status, bool) {
+	if s == nil {
+		return Status{}, false
+	}
+	s.mu.Lock()
+	e, ok := s.byName[name]
+	s.mu.Unlock()
+	if !ok {
+		return Status{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status, true
+}
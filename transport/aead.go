@@ -0,0 +1,254 @@
+package transport
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	saltSize     = 32
+	maxPayload   = 0x3FFF
+	saltHistory  = 1 << 15          // salts remembered to refuse replayed streams
+	drainTimeout = 30 * time.Second // how long rejected streams are read before closing
+)
+
+var errAuth = errors.New("aead transport: stream failed authentication")
+
+func init() {
+	Register("aead", NewAEAD)
+}
+
+// AEAD frames the stream like Shadowsocks AEAD ciphers: each direction
+// starts with a random salt, followed by ChaCha20-Poly1305 sealed chunks,
+// each a sealed 2-byte length and a sealed payload. The whole stream looks
+// random. Replayed streams and ones that fail authentication are read until
+// the client gives up, as a closed connection would give the server away.
+type AEAD struct {
+	key   []byte
+	salts *saltFilter
+}
+
+// NewAEAD creates the aead transport; key is a shared secret of at least
+// 16 characters
+func NewAEAD(key string) (Transport, error) {
+	if len(key) < 16 {
+		return nil, errors.New("the aead transport needs a key of at least 16 characters")
+	}
+	sum := sha256.Sum256([]byte(key))
+	return &AEAD{key: sum[:], salts: newSaltFilter(saltHistory)}, nil
+}
+
+func (t *AEAD) Name() string {
+	return "aead"
+}
+
+func (t *AEAD) Server(conn net.Conn) net.Conn {
+	return newAEADConn(conn, t, true)
+}
+
+func (t *AEAD) Client(conn net.Conn) net.Conn {
+	return newAEADConn(conn, t, false)
+}
+
+// cipher returns the cipher of a direction starting with salt
+func (t *AEAD) cipher(salt []byte) (cipher.AEAD, error) {
+	subkey, err := hkdf.Key(sha1.New, t.key, salt, "ss-subkey", chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(subkey)
+}
+
+type aeadConn struct {
+	net.Conn
+	t      *AEAD
+	server bool
+
+	rmu     sync.Mutex
+	reader  cipher.AEAD
+	rnonce  []byte
+	in      []byte // raw bytes of the part being read, kept across failed reads such as probe deadlines
+	size    int    // payload size of the chunk being read, -1 while reading its length
+	pending []byte // decrypted bytes not yet returned
+
+	wmu    sync.Mutex
+	writer cipher.AEAD
+	wnonce []byte
+}
+
+func newAEADConn(conn net.Conn, t *AEAD, server bool) *aeadConn {
+	return &aeadConn{
+		Conn:   conn,
+		t:      t,
+		server: server,
+		in:     make([]byte, 0, maxPayload+chacha20poly1305.Overhead),
+		size:   -1,
+	}
+}
+
+func (c *aeadConn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for len(c.pending) == 0 {
+		if err := c.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readChunk decrypts the next chunk into c.pending
+func (c *aeadConn) readChunk() error {
+	if c.reader == nil {
+		if err := c.fill(saltSize); err != nil {
+			return err
+		}
+		if c.server && !c.t.salts.add(c.in) {
+			return c.reject()
+		}
+		reader, err := c.t.cipher(c.in)
+		if err != nil {
+			return err
+		}
+		c.reader, c.rnonce, c.in = reader, make([]byte, reader.NonceSize()), c.in[:0]
+	}
+
+	overhead := c.reader.Overhead()
+	if c.size < 0 {
+		if err := c.fill(2 + overhead); err != nil {
+			return err
+		}
+		length, err := c.reader.Open(nil, c.rnonce, c.in, nil)
+		if err != nil {
+			return c.reject()
+		}
+		increment(c.rnonce)
+		c.size, c.in = int(binary.BigEndian.Uint16(length))&maxPayload, c.in[:0]
+	}
+
+	if err := c.fill(c.size + overhead); err != nil {
+		return err
+	}
+	payload, err := c.reader.Open(c.in[:0], c.rnonce, c.in, nil)
+	if err != nil {
+		return c.reject()
+	}
+	increment(c.rnonce)
+	c.pending, c.size, c.in = payload, -1, c.in[:0]
+	return nil
+}
+
+// fill reads until c.in holds n bytes. What was read stays in c.in when it
+// fails, so a later call resumes.
+func (c *aeadConn) fill(n int) error {
+	for len(c.in) < n {
+		m, err := c.Conn.Read(c.in[len(c.in):n])
+		c.in = c.in[:len(c.in)+m]
+		if err != nil {
+			if err == io.EOF && len(c.in) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// reject fails the stream; a server first reads it until the peer gives up
+func (c *aeadConn) reject() error {
+	if c.server {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(drainTimeout))
+		_, _ = io.Copy(io.Discard, c.Conn)
+	}
+	return errAuth
+}
+
+func (c *aeadConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var out []byte
+	if c.writer == nil {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return 0, err
+		}
+		writer, err := c.t.cipher(salt)
+		if err != nil {
+			return 0, err
+		}
+		c.writer, c.wnonce, out = writer, make([]byte, writer.NonceSize()), salt
+	}
+
+	for rest := p; len(rest) > 0; {
+		chunk := rest[:min(len(rest), maxPayload)]
+		rest = rest[len(chunk):]
+
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(chunk)))
+		out = c.writer.Seal(out, c.wnonce, length[:], nil)
+		increment(c.wnonce)
+		out = c.writer.Seal(out, c.wnonce, chunk, nil)
+		increment(c.wnonce)
+	}
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// increment adds one to a little-endian nonce
+func increment(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
+
+// saltFilter remembers the latest salts seen
+type saltFilter struct {
+	mu    sync.Mutex
+	seen  map[[saltSize]byte]struct{}
+	order [][saltSize]byte
+	next  int
+}
+
+func newSaltFilter(size int) *saltFilter {
+	return &saltFilter{seen: make(map[[saltSize]byte]struct{}, size), order: make([][saltSize]byte, 0, size)}
+}
+
+// add records salt and reports whether it is new
+func (f *saltFilter) add(salt []byte) bool {
+	key := [saltSize]byte(salt)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.seen[key]; ok {
+		return false
+	}
+	if len(f.order) < cap(f.order) {
+		f.order = append(f.order, key)
+	} else {
+		delete(f.seen, f.order[f.next])
+		f.order[f.next] = key
+		f.next = (f.next + 1) % len(f.order)
+	}
+	f.seen[key] = struct{}{}
+	return true
+}
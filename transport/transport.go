@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Transport is an obfuscation layer wrapped around connections before the
+// mixed entrypoint looks at them, so DPI sees its bytes instead of SSH
+// banners and SOCKS handshakes. Both ends must use the same transport and
+// key.
+type Transport interface {
+	Name() string
+	// Server wraps a connection accepted from a client
+	Server(conn net.Conn) net.Conn
+	// Client wraps a connection dialed to a server
+	Client(conn net.Conn) net.Conn
+}
+
+// Factory creates a transport from its key
+type Factory func(key string) (Transport, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a transport available to New under name. Built-in
+// transports register themselves; others can from their package's init.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// Names lists the registered transports
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return slices.Sorted(maps.Keys(factories))
+}
+
+// New creates the named transport; an empty name returns nil, which leaves
+// connections as they are
+func New(name, key string) (Transport, error) {
+	if name == "" {
+		return nil, nil
+	}
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transport '%s' (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(key)
+}
@@ -0,0 +1,65 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// DefaultBufferSize matches io.Copy's own buffer
+const DefaultBufferSize = 32 * 1024
+
+// bufferSize is the size of the buffers Copy borrows
+var bufferSize = DefaultBufferSize
+
+// SetBufferSize changes the relay buffer size. Smaller buffers cut the memory
+// each tunnel holds at some cost in throughput. It must be called before any
+// tunnel starts.
+func SetBufferSize(n int) {
+	bufferSize = n
+}
+
+var buffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, bufferSize)
+		return &buf
+	},
+}
+
+// Copy is io.Copy with a buffer borrowed from a shared pool, so thousands of
+// tunnels don't each hold two buffers of garbage. Like io.Copy it prefers
+// WriterTo and ReaderFrom, which for TCP to TCP copies splices in the kernel
+// and leaves the buffer unused.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := buffers.Get().(*[]byte)
+	defer buffers.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// Relay runs up and down, the two copy loops of a tunnel, until either
+// returns or ctx is done, closes conns so that the other returns too, and
+// waits for both. Cancelling ctx is how a tunnel is closed from outside,
+// such as when its client is kicked or an idle timeout fires.
+func Relay(ctx context.Context, up, down func(), conns ...io.Closer) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	context.AfterFunc(ctx, func() {
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		up()
+	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		down()
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+)
+
+// benchChunk is how much each benchmark iteration moves
+const benchChunk = 1 << 20
+
+// tcpPair returns the two ends of a loopback TCP connection
+func tcpPair(b *testing.B) (net.Conn, net.Conn) {
+	b.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	server := <-accepted
+	if server == nil {
+		b.Fatal("accept failed")
+	}
+	return client, server
+}
+
+// source writes benchChunk bytes per iteration to w and closes it
+func source(b *testing.B, w io.WriteCloser) {
+	buf := make([]byte, 32*1024)
+	go func() {
+		defer w.Close()
+		for range b.N {
+			for sent := 0; sent < benchChunk; sent += len(buf) {
+				if _, err := w.Write(buf); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// onlyWriter hides ReaderFrom, so Copy goes through the pooled buffer
+// rather than splicing
+type onlyWriter struct{ io.Writer }
+
+func BenchmarkCopy(b *testing.B) {
+	client, server := tcpPair(b)
+	defer server.Close()
+
+	b.SetBytes(benchChunk)
+	b.ReportAllocs()
+	source(b, client)
+	if _, err := Copy(onlyWriter{io.Discard}, server); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkRelay(b *testing.B) {
+	// client -> relayIn, relayed to relayOut -> target
+	client, relayIn := tcpPair(b)
+	relayOut, target := tcpPair(b)
+	defer target.Close()
+
+	b.SetBytes(benchChunk)
+	b.ReportAllocs()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Relay(context.Background(),
+			func() { _, _ = Copy(relayOut, relayIn) },
+			func() { _, _ = Copy(relayIn, relayOut) },
+			relayIn, relayOut)
+	}()
+
+	source(b, client)
+	if _, err := io.Copy(io.Discard, target); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+	<-done
+}
@@ -0,0 +1,96 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDialsBusy is returned for dials that waited out their timeout for a
+// slot
+var ErrDialsBusy = errors.New("too many outbound dials in progress")
+
+// DialLimiter caps the outbound dials in progress server-wide. Client apps
+// that retry in a tight loop, or a stalled destination, can otherwise pile
+// up half-open connections until the ephemeral ports run out; past the cap
+// dials queue for a slot instead. A nil *DialLimiter allows everything.
+type DialLimiter struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+	busy    atomic.Int64 // dials that gave up waiting
+}
+
+// NewDialLimiter returns a cap of max concurrent dials, or nil when max is 0
+func NewDialLimiter(max int) *DialLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &DialLimiter{slots: make(chan struct{}, max)}
+}
+
+// Dial is Dial once a slot is free. It waits for one until ctx is done or,
+// when d has a timeout, for at most that long.
+func (l *DialLimiter) Dial(ctx context.Context, d *net.Dialer, source net.IP, resolver *Resolver, addrs ...string) (net.Conn, error) {
+	if l == nil {
+		return Dial(ctx, d, source, resolver, addrs...)
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		l.waiting.Add(1)
+		var timeout <-chan time.Time
+		if d.Timeout > 0 {
+			timer := time.NewTimer(d.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case l.slots <- struct{}{}:
+			l.waiting.Add(-1)
+		case <-timeout:
+			l.waiting.Add(-1)
+			l.busy.Add(1)
+			return nil, ErrDialsBusy
+		case <-ctx.Done():
+			l.waiting.Add(-1)
+			return nil, ctx.Err()
+		}
+	}
+	defer func() { <-l.slots }()
+	return Dial(ctx, d, source, resolver, addrs...)
+}
+
+// Max returns the number of slots
+func (l *DialLimiter) Max() int {
+	if l == nil {
+		return 0
+	}
+	return cap(l.slots)
+}
+
+// Active returns the number of dials in progress
+func (l *DialLimiter) Active() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+// Waiting returns the number of dials queued for a slot
+func (l *DialLimiter) Waiting() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.waiting.Load()
+}
+
+// Busy returns how many dials gave up waiting for a slot
+func (l *DialLimiter) Busy() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.busy.Load()
+}
@@ -0,0 +1,277 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Bounds on how long lookups stay cached. Records are kept for their TTL
+// within these; names that don't exist for the SOA's negative TTL, and
+// failed lookups briefly so a retry storm doesn't become a query storm.
+const (
+	minCacheTTL      = 5 * time.Second
+	maxCacheTTL      = time.Hour
+	maxNegativeTTL   = 5 * time.Minute
+	defaultNegTTL    = 30 * time.Second
+	failureCacheTTL  = 5 * time.Second
+	dnsExchangeLimit = 5 * time.Second
+)
+
+// resolvConf is where the servers of the system resolver are read from
+// when no DNS servers are configured
+const resolvConf = "/etc/resolv.conf"
+
+// defaultServers are queried when resolvConf lists none, as the system
+// resolver does
+var defaultServers = []string{"127.0.0.1:53", "[::1]:53"}
+
+type cacheKey struct {
+	network string // "ip", "ip4", or "ip6"
+	host    string
+}
+
+// cacheEntry is a lookup, cached or in flight: ready is closed once addrs
+// and err are set
+type cacheEntry struct {
+	ready   chan struct{}
+	addrs   []netip.Addr
+	err     error
+	expires time.Time
+}
+
+// dnsCache answers lookups from memory for as long as the records' TTL
+// allows, and merges concurrent lookups of a name into one query
+type dnsCache struct {
+	servers []string
+	next    atomic.Uint32 // round-robin cursor over servers
+	max     int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+// newDNSCache returns a cache of up to max names querying servers, or the
+// system resolver's servers when there are none
+func newDNSCache(servers []string, max int) *dnsCache {
+	if len(servers) == 0 {
+		if conf, err := dns.ClientConfigFromFile(resolvConf); err == nil {
+			for _, server := range conf.Servers {
+				servers = append(servers, net.JoinHostPort(server, conf.Port))
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = defaultServers
+	}
+	return &dnsCache{servers: servers, max: max, entries: make(map[cacheKey]*cacheEntry)}
+}
+
+func (c *dnsCache) lookup(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	key := cacheKey{network: network, host: strings.ToLower(strings.TrimSuffix(host, "."))}
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Now().After(e.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		c.evict()
+		e = &cacheEntry{ready: make(chan struct{})}
+		c.entries[key] = e
+		c.mu.Unlock()
+
+		// The query outlives a caller that gives up, since others may wait
+		// on it
+		go c.resolve(key, e)
+	} else {
+		c.mu.Unlock()
+	}
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return append([]netip.Addr(nil), e.addrs...), nil
+}
+
+// evict makes room for an entry, dropping expired ones first; c.mu is held
+func (c *dnsCache) evict() {
+	if len(c.entries) < c.max {
+		return
+	}
+	now := time.Now()
+	for key, e := range c.entries {
+		select {
+		case <-e.ready:
+			if now.After(e.expires) {
+				delete(c.entries, key)
+			}
+		default:
+		}
+	}
+	for key, e := range c.entries {
+		if len(c.entries) < c.max {
+			return
+		}
+		select {
+		case <-e.ready:
+			delete(c.entries, key)
+		default:
+		}
+	}
+}
+
+func (c *dnsCache) resolve(key cacheKey, e *cacheEntry) {
+	defer close(e.ready)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*dnsExchangeLimit)
+	defer cancel()
+
+	var types []uint16
+	switch key.network {
+	case "ip4":
+		types = []uint16{dns.TypeA}
+	case "ip6":
+		types = []uint16{dns.TypeAAAA}
+	default:
+		types = []uint16{dns.TypeA, dns.TypeAAAA}
+	}
+
+	type answer struct {
+		addrs []netip.Addr
+		ttl   time.Duration
+		err   error
+	}
+	answers := make([]answer, len(types))
+	var wg sync.WaitGroup
+	for i, qtype := range types {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, ttl, err := c.query(ctx, key.host, qtype)
+			answers[i] = answer{addrs, ttl, err}
+		}()
+	}
+	wg.Wait()
+
+	ttl := maxCacheTTL
+	var firstErr error
+	for _, a := range answers {
+		if a.err != nil {
+			if firstErr == nil {
+				firstErr = a.err
+			}
+			continue
+		}
+		e.addrs = append(e.addrs, a.addrs...)
+		ttl = min(ttl, a.ttl)
+	}
+	switch {
+	case len(e.addrs) > 0:
+		e.expires = time.Now().Add(max(ttl, minCacheTTL))
+	case firstErr != nil:
+		e.err = firstErr
+		e.expires = time.Now().Add(failureCacheTTL)
+		var dnsErr *net.DNSError
+		if errors.As(firstErr, &dnsErr) && dnsErr.IsNotFound {
+			e.expires = time.Now().Add(max(ttl, minCacheTTL))
+		}
+	default:
+		e.err = &net.DNSError{Err: "no such host", Name: key.host, IsNotFound: true}
+		e.expires = time.Now().Add(max(ttl, minCacheTTL))
+	}
+}
+
+// query looks up one record type of host, returning its addresses and how
+// long they may be cached
+func (c *dnsCache) query(ctx context.Context, host string, qtype uint16) ([]netip.Addr, time.Duration, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(host), qtype)
+	msg.SetEdns0(1232, false)
+
+	var reply *dns.Msg
+	var err error
+	for range c.servers {
+		server := c.servers[int(c.next.Add(1)-1)%len(c.servers)]
+		reply, err = exchange(ctx, msg, server)
+		if err == nil && reply.Rcode != dns.RcodeServerFailure && reply.Rcode != dns.RcodeRefused {
+			break
+		}
+		if err == nil {
+			err = &net.DNSError{Err: "server misbehaving: " + dns.RcodeToString[reply.Rcode], Name: host, Server: server}
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if reply.Rcode == dns.RcodeNameError {
+		return nil, negativeTTL(reply), &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	if reply.Rcode != dns.RcodeSuccess {
+		return nil, 0, &net.DNSError{Err: "lookup failed: " + dns.RcodeToString[reply.Rcode], Name: host}
+	}
+
+	var addrs []netip.Addr
+	ttl := maxCacheTTL
+	for _, rr := range reply.Answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			addrs = append(addrs, addr.Unmap())
+			ttl = min(ttl, time.Duration(rr.Header().Ttl)*time.Second)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, negativeTTL(reply), nil
+	}
+	return addrs, ttl, nil
+}
+
+// exchange sends msg to server over UDP, retrying over TCP when the reply
+// is truncated
+func exchange(ctx context.Context, msg *dns.Msg, server string) (*dns.Msg, error) {
+	client := &dns.Client{Timeout: dnsExchangeLimit}
+	reply, _, err := client.ExchangeContext(ctx, msg, server)
+	if err == nil && reply.Truncated {
+		client.Net = "tcp"
+		reply, _, err = client.ExchangeContext(ctx, msg, server)
+	}
+	return reply, err
+}
+
+// negativeTTL is how long a reply without addresses may be cached, from the
+// SOA record in its authority section (RFC 2308)
+func negativeTTL(reply *dns.Msg) time.Duration {
+	for _, rr := range reply.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := min(soa.Hdr.Ttl, soa.Minttl)
+			return min(time.Duration(ttl)*time.Second, maxNegativeTTL)
+		}
+	}
+	return defaultNegTTL
+}
@@ -0,0 +1,28 @@
+package tunnel
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// WatchIdle calls onIdle once lastActivity (unix nanoseconds, updated
+// atomically by the copy loops) is older than timeout. It returns after
+// calling onIdle or when ctx is done.
+func WatchIdle(ctx context.Context, lastActivity *int64, timeout time.Duration, onIdle func()) {
+	interval := min(max(timeout/4, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(lastActivity))) > timeout {
+				onIdle()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tunnel
+
+import (
+	"sync/atomic"
+)
+
+// Limits caps the tunnels relayed server-wide. Each tunnel holds two relay
+// buffers and a pair of goroutines, so the cap bounds memory under a load
+// spike: past it new tunnels are turned away instead of pushing a small VPS
+// into the OOM killer. A nil *Limits allows everything.
+type Limits struct {
+	max      int64
+	active   atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewLimits returns a cap of max concurrent tunnels, or nil when max is 0
+func NewLimits(max int) *Limits {
+	if max <= 0 {
+		return nil
+	}
+	return &Limits{max: int64(max)}
+}
+
+// Acquire takes a tunnel slot, reporting false when all are in use. Every
+// successful Acquire must be paired with a Release.
+func (l *Limits) Acquire() bool {
+	if l == nil {
+		return true
+	}
+	if l.active.Add(1) > l.max {
+		l.active.Add(-1)
+		l.rejected.Add(1)
+		return false
+	}
+	return true
+}
+
+// Release returns a slot taken by Acquire
+func (l *Limits) Release() {
+	if l != nil {
+		l.active.Add(-1)
+	}
+}
+
+// Full reports whether every slot is in use, for refusing new sessions
+// before they open any tunnel
+func (l *Limits) Full() bool {
+	if l == nil {
+		return false
+	}
+	if l.active.Load() >= l.max {
+		l.rejected.Add(1)
+		return true
+	}
+	return false
+}
+
+// Max returns the number of slots
+func (l *Limits) Max() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.max
+}
+
+// Active returns the number of tunnels holding a slot
+func (l *Limits) Active() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.active.Load()
+}
+
+// Rejected returns how many tunnels and sessions were turned away
+func (l *Limits) Rejected() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.rejected.Load()
+}
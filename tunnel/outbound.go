@@ -0,0 +1,62 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// Dial connects d to the first of addrs to answer, from source, or from an
+// address the system picks when source is nil. The network follows the
+// family of source, since a socket bound to an IPv4 address can't reach IPv6
+// targets and vice versa. Hostnames are looked up with resolver, and several
+// addresses are raced Happy Eyeballs style; with a nil resolver a single
+// address is left to the system to resolve and race.
+func Dial(ctx context.Context, d *net.Dialer, source net.IP, resolver *Resolver, addrs ...string) (net.Conn, error) {
+	network := "tcp"
+	if source != nil {
+		d.LocalAddr = &net.TCPAddr{IP: source}
+		network = "tcp6"
+		if source.To4() != nil {
+			network = "tcp4"
+		}
+	} else if resolver != nil {
+		switch resolver.cfg.Prefer {
+		case PreferIPv4Only:
+			network = "tcp4"
+		case PreferIPv6Only:
+			network = "tcp6"
+		}
+	}
+
+	if resolver == nil && len(addrs) == 1 {
+		return d.DialContext(ctx, network, addrs[0])
+	}
+	if resolver != nil {
+		resolved, err := resolver.resolve(ctx, network, addrs)
+		if err != nil {
+			return nil, err
+		}
+		addrs = resolved
+	}
+	return dialRace(ctx, d, network, addrs, resolver.fallbackDelay())
+}
+
+// SourceIP returns the outbound address for a client: its own when set and
+// valid, otherwise fallback
+func SourceIP(client string, fallback net.IP) net.IP {
+	if ip := net.ParseIP(client); ip != nil {
+		return ip
+	}
+	return fallback
+}
+
+// CheckLocalIP fails unless ip is an address of this host that outbound
+// connections can be bound to
+func CheckLocalIP(ip net.IP) error {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip})
+	if err != nil {
+		return fmt.Errorf("%s is not an address of this host: %w", ip, err)
+	}
+	return l.Close()
+}
@@ -0,0 +1,272 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Address family preferences for outbound connections
+const (
+	PreferIPv4     = "ipv4"      // try IPv4 addresses first
+	PreferIPv6     = "ipv6"      // try IPv6 addresses first
+	PreferIPv4Only = "ipv4-only" // never use IPv6
+	PreferIPv6Only = "ipv6-only" // never use IPv4
+)
+
+// DefaultFallbackDelay is how long a connection attempt gets before the next
+// address is tried alongside it, per RFC 8305
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// ValidPrefer reports whether prefer is empty or one of the Prefer* values
+func ValidPrefer(prefer string) bool {
+	switch prefer {
+	case "", PreferIPv4, PreferIPv6, PreferIPv4Only, PreferIPv6Only:
+		return true
+	}
+	return false
+}
+
+type ResolverConfig struct {
+	Servers       []string      // DNS servers as host or host:port, empty uses the system resolver
+	Prefer        string        // one of the Prefer* values, empty keeps the resolver's order
+	FallbackDelay time.Duration // head start of each connection attempt, 0 uses DefaultFallbackDelay, negative tries addresses one at a time
+	CacheSize     int           // names whose addresses are cached for their TTL, 0 disables the cache
+}
+
+// Resolver looks up outbound destinations with its own DNS servers and
+// address family preference, for servers whose system resolver is poisoned
+// or whose IPv6 is broken. A nil *Resolver uses the system resolver.
+type Resolver struct {
+	cfg      ResolverConfig
+	resolver *net.Resolver
+	cache    *dnsCache     // nil when caching is disabled
+	next     atomic.Uint32 // round-robin cursor over cfg.Servers
+}
+
+func NewResolver(cfg *ResolverConfig) (*Resolver, error) {
+	if !ValidPrefer(cfg.Prefer) {
+		return nil, fmt.Errorf("unknown address preference '%s' (want %s, %s, %s, or %s)", cfg.Prefer, PreferIPv4, PreferIPv6, PreferIPv4Only, PreferIPv6Only)
+	}
+	r := &Resolver{cfg: *cfg, resolver: net.DefaultResolver}
+	r.cfg.Servers = nil
+	for _, server := range cfg.Servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		if _, err := netip.ParseAddrPort(server); err != nil {
+			return nil, fmt.Errorf("invalid DNS server '%s': expected an IP address", server)
+		}
+		r.cfg.Servers = append(r.cfg.Servers, server)
+	}
+	if len(r.cfg.Servers) > 0 {
+		r.resolver = &net.Resolver{PreferGo: true, Dial: r.dialServer}
+	}
+	if cfg.CacheSize > 0 {
+		r.cache = newDNSCache(r.cfg.Servers, cfg.CacheSize)
+	}
+	return r, nil
+}
+
+// dialServer sends the resolver's queries to the configured servers in turn
+func (r *Resolver) dialServer(ctx context.Context, network, _ string) (net.Conn, error) {
+	server := r.cfg.Servers[int(r.next.Add(1)-1)%len(r.cfg.Servers)]
+	var d net.Dialer
+	return d.DialContext(ctx, network, server)
+}
+
+// LookupNetIP resolves host to the addresses of network ("ip", "ip4", or
+// "ip6") that the preference allows, most preferred first
+func (r *Resolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if r == nil {
+		return net.DefaultResolver.LookupNetIP(ctx, network, host)
+	}
+
+	switch r.cfg.Prefer {
+	case PreferIPv4Only:
+		if network == "ip6" {
+			return nil, fmt.Errorf("%s: IPv6 is disabled for outbound connections", host)
+		}
+		network = "ip4"
+	case PreferIPv6Only:
+		if network == "ip4" {
+			return nil, fmt.Errorf("%s: IPv4 is disabled for outbound connections", host)
+		}
+		network = "ip6"
+	}
+
+	var addrs []netip.Addr
+	var err error
+	if r.cache != nil && cacheable(host) {
+		addrs, err = r.cache.lookup(ctx, network, host)
+	} else {
+		addrs, err = r.resolver.LookupNetIP(ctx, network, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	return r.order(addrs), nil
+}
+
+// cacheable reports whether host is looked up in DNS rather than answered
+// locally, as single-label names and localhost are by the system resolver
+func cacheable(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return strings.Contains(host, ".") && host != "localhost" && !strings.HasSuffix(host, ".localhost") && !strings.HasSuffix(host, ".local")
+}
+
+// order interleaves the address families, starting with the preferred one or
+// else the family of the first address, so a broken family costs only one
+// fallback delay (RFC 8305 section 4)
+func (r *Resolver) order(addrs []netip.Addr) []netip.Addr {
+	if len(addrs) < 2 {
+		return addrs
+	}
+	var v4, v6 []netip.Addr
+	for _, addr := range addrs {
+		if addr.Is4() {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	first, second := v4, v6
+	switch {
+	case r.cfg.Prefer == PreferIPv6, r.cfg.Prefer == "" && addrs[0].Is6():
+		first, second = v6, v4
+	}
+	out := make([]netip.Addr, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
+
+func (r *Resolver) fallbackDelay() time.Duration {
+	if r == nil || r.cfg.FallbackDelay == 0 {
+		return DefaultFallbackDelay
+	}
+	return r.cfg.FallbackDelay
+}
+
+// resolve expands the hostnames among addrs into addresses of network
+// ("tcp", "tcp4", or "tcp6"), keeping the order
+func (r *Resolver) resolve(ctx context.Context, network string, addrs []string) ([]string, error) {
+	ipNetwork := "ip" + strings.TrimPrefix(network, "tcp")
+	var out []string
+	var lastErr error
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := netip.ParseAddr(host); err == nil {
+			out = append(out, addr)
+			continue
+		}
+		ips, err := r.LookupNetIP(ctx, ipNetwork, host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, ip := range ips {
+			out = append(out, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	if len(out) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses for %s", strings.Join(addrs, ", "))
+		}
+		return nil, lastErr
+	}
+	return out, nil
+}
+
+// dialRace connects to the first of addrs to answer. Each attempt gets delay
+// before the next one starts alongside it, and a failed attempt starts the
+// next one at once (RFC 8305 section 5).
+func dialRace(ctx context.Context, d *net.Dialer, network string, addrs []string, delay time.Duration) (net.Conn, error) {
+	if len(addrs) == 1 {
+		return d.DialContext(ctx, network, addrs[0])
+	}
+	if delay < 0 {
+		var firstErr error
+		for _, addr := range addrs {
+			conn, err := d.DialContext(ctx, network, addr)
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, firstErr
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := d.DialContext(ctx, network, addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// The losers are canceled; close any that connected anyway
+				go func(n int) {
+					for range n {
+						if late := <-results; late.conn != nil {
+							_ = late.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if next < len(addrs) {
+				start()
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, firstErr
+}
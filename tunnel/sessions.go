@@ -0,0 +1,109 @@
+package tunnel
+
+import (
+	"context"
+	"sync"
+)
+
+// Sessions tracks the client sessions open on a server, each with a context
+// that is cancelled when the session is kicked or the server gives up
+// waiting for it to drain. Servers close a session's connections once its
+// context is done, so cancelling it is how a session is ended from outside.
+type Sessions struct {
+	base     context.Context
+	closeAll context.CancelFunc
+
+	mu     sync.Mutex
+	byUser map[string]map[*Session]struct{} // "" for sessions not logged in yet
+}
+
+// Session is a client session tracked by Sessions
+type Session struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	owner  *Sessions
+	user   string
+}
+
+func NewSessions() *Sessions {
+	base, cancel := context.WithCancel(context.Background())
+	return &Sessions{base: base, closeAll: cancel, byUser: make(map[string]map[*Session]struct{})}
+}
+
+// Open starts tracking a session whose client isn't known yet
+func (s *Sessions) Open() *Session {
+	ctx, cancel := context.WithCancel(s.base)
+	sess := &Session{ctx: ctx, cancel: cancel, owner: s}
+	s.mu.Lock()
+	s.add(sess)
+	s.mu.Unlock()
+	return sess
+}
+
+// add files sess under its user; s.mu is held
+func (s *Sessions) add(sess *Session) {
+	set := s.byUser[sess.user]
+	if set == nil {
+		set = make(map[*Session]struct{})
+		s.byUser[sess.user] = set
+	}
+	set[sess] = struct{}{}
+}
+
+// remove forgets sess; s.mu is held
+func (s *Sessions) remove(sess *Session) {
+	set := s.byUser[sess.user]
+	delete(set, sess)
+	if len(set) == 0 {
+		delete(s.byUser, sess.user)
+	}
+}
+
+// Kick ends the sessions of username and returns how many there were
+func (s *Sessions) Kick(username string) int {
+	if s == nil || username == "" {
+		return 0
+	}
+	s.mu.Lock()
+	var kicked []*Session
+	for sess := range s.byUser[username] {
+		kicked = append(kicked, sess)
+	}
+	s.mu.Unlock()
+
+	for _, sess := range kicked {
+		sess.End()
+	}
+	return len(kicked)
+}
+
+// CloseAll ends every session, and those opened from now on right away
+func (s *Sessions) CloseAll() {
+	s.closeAll()
+}
+
+// Context is done once the session has ended
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// SetUser files the session under the client that logged in with it
+func (s *Session) SetUser(username string) {
+	s.owner.mu.Lock()
+	defer s.owner.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.owner.remove(s)
+	s.user = username
+	s.owner.add(s)
+}
+
+// End cancels the session's context and stops tracking it. It may be called
+// more than once.
+func (s *Session) End() {
+	s.cancel()
+	s.owner.mu.Lock()
+	s.owner.remove(s)
+	s.owner.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Timeouts keep half-open connections from flaky networks from piling up.
+// A nil *Timeouts uses Go's defaults and sets no deadlines.
+type Timeouts struct {
+	KeepAlive    time.Duration // TCP keepalive probe interval, 0 uses Go's default of 15s, negative disables
+	WriteTimeout time.Duration // fail a write the peer hasn't accepted within this long, 0 disables
+	MaxLifetime  time.Duration // close connections this long after they were set up, 0 disables
+}
+
+func (t *Timeouts) keepAlive() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.KeepAlive
+}
+
+// Listen opens a TCP listener whose accepted connections use the keepalive
+// interval
+func (t *Timeouts) Listen(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: t.keepAlive()}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// Dialer returns a dialer with the keepalive interval and connect timeout
+func (t *Timeouts) Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: timeout, KeepAlive: t.keepAlive()}
+}
+
+// Wrap applies the write timeout and lifetime to conn. conn is returned as
+// is when neither is set, which keeps kernel splicing available.
+func (t *Timeouts) Wrap(conn net.Conn) net.Conn {
+	if t == nil || (t.WriteTimeout <= 0 && t.MaxLifetime <= 0) {
+		return conn
+	}
+	c := &deadlineConn{Conn: conn, writeTimeout: t.WriteTimeout}
+	if t.MaxLifetime > 0 {
+		// A timer rather than a deadline, which readers such as protocol
+		// probes would clear when they reset their own
+		c.lifetime = time.AfterFunc(t.MaxLifetime, func() { _ = conn.Close() })
+	}
+	return c
+}
+
+type deadlineConn struct {
+	net.Conn
+	writeTimeout time.Duration
+	lifetime     *time.Timer
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *deadlineConn) Close() error {
+	if c.lifetime != nil {
+		c.lifetime.Stop()
+	}
+	return c.Conn.Close()
+}
+
+// ListenAddrs returns host:port for each host, bracketing IPv6 literals. No
+// hosts, or an empty one, binds every interface; "::" is dual-stack where the
+// system allows it.
+func ListenAddrs(hosts []string, port int) []string {
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	addrs := make([]string, len(hosts))
+	for i, host := range hosts {
+		addrs[i] = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	return addrs
+}
@@ -0,0 +1,63 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Binary byte multiples, matching FormatBytes
+const (
+	KB int64 = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
+	PB
+)
+
+// byteSuffixes maps lowercase size suffixes to multiples. KB and KiB both
+// mean 1024 bytes, as FormatBytes prints them.
+var byteSuffixes = map[string]int64{
+	"b": 1,
+	"k": KB, "kb": KB, "kib": KB,
+	"m": MB, "mb": MB, "mib": MB,
+	"g": GB, "gb": GB, "gib": GB,
+	"t": TB, "tb": TB, "tib": TB,
+	"p": PB, "pb": PB, "pib": PB,
+}
+
+// ParseBytes parses a size such as "500MB", "1.5 TB", or "2g". Plain numbers
+// are multiples of unit, so callers that used to take whole GB keep
+// accepting them.
+func ParseBytes(s string, unit int64) (int64, error) {
+	text := strings.TrimSpace(s)
+	if strings.HasPrefix(text, "-") {
+		return 0, fmt.Errorf("invalid size '%s': cannot be negative", s)
+	}
+	i := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, suffix := text, ""
+	if i >= 0 {
+		number, suffix = text[:i], strings.ToLower(strings.TrimSpace(text[i:]))
+	}
+
+	multiple := unit
+	if suffix != "" {
+		var ok bool
+		if multiple, ok = byteSuffixes[suffix]; !ok {
+			return 0, fmt.Errorf("invalid size '%s': unknown unit '%s' (want B, KB, MB, GB, TB, or PB)", s, text[i:])
+		}
+	}
+
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	bytes := math.Round(v * float64(multiple))
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size '%s': too large", s)
+	}
+	return int64(bytes), nil
+}
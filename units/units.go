@@ -0,0 +1,25 @@
+package units
+
+import "fmt"
+
+// BytesPerMbit converts a rate in Mbit/s to bytes per second
+const BytesPerMbit = 1000 * 1000 / 8
+
+// FormatBytes renders n in binary units, e.g. 1536 as "1.5 KB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatRate renders a rate in bytes per second as Mbit/s, e.g. "12.5 Mbit/s"
+func FormatRate(bytesPerSecond int64) string {
+	return fmt.Sprintf("%.1f Mbit/s", float64(bytesPerSecond)/BytesPerMbit)
+}
@@ -0,0 +1,103 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/database/models"
+)
+
+type aclRule struct {
+	ID     uint   `json:"id"`
+	Client string `json:"client,omitempty"` // empty for global rules
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Ports  string `json:"ports,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+func (s *Server) handleACLList(w http.ResponseWriter, r *http.Request) {
+	var rules []models.ACLRule
+	if err := s.cfg.DB.Order("id").Find(&rules).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load rules"})
+		return
+	}
+
+	usernames := make(map[uint]string)
+	var clients []models.Client
+	s.cfg.DB.Select("id", "username").Find(&clients)
+	for _, c := range clients {
+		usernames[c.ID] = c.Username
+	}
+
+	out := make([]aclRule, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, aclRule{
+			ID:     rule.ID,
+			Client: usernames[rule.ClientID],
+			Action: rule.Action,
+			Target: rule.Target,
+			Ports:  rule.Ports,
+			Note:   rule.Note,
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleACLCreate(w http.ResponseWriter, r *http.Request) {
+	var req aclRule
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return
+	}
+
+	rule := models.ACLRule{Action: req.Action, Target: req.Target, Ports: req.Ports, Note: req.Note}
+	if req.Client != "" {
+		var client models.Client
+		if err := s.cfg.DB.Where("username = ?", req.Client).First(&client).Error; err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "client not found"})
+			return
+		}
+		rule.ClientID = client.ID
+	}
+
+	if err := acl.Validate(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.cfg.DB.Create(&rule).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save rule"})
+		return
+	}
+	s.cfg.ACL.Invalidate()
+	s.audit(r, "acl add", strconv.FormatUint(uint64(rule.ID), 10), nil, &rule)
+
+	req.ID = rule.ID
+	writeJSON(w, http.StatusCreated, req)
+}
+
+func (s *Server) handleACLDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid rule id"})
+		return
+	}
+
+	var rule models.ACLRule
+	s.cfg.DB.First(&rule, id)
+	result := s.cfg.DB.Unscoped().Delete(&models.ACLRule{}, id)
+	if result.Error != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to remove rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "rule not found"})
+		return
+	}
+	s.cfg.ACL.Invalidate()
+	s.audit(r, "acl remove", r.PathValue("id"), &rule, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
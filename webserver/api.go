@@ -0,0 +1,188 @@
+package webserver
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/geoip"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var instructions = map[string]map[string]string{
+	"en": {
+		"ssh":        "Import the SSH link into NetMod (or any SSH tunnel app) by scanning the QR code or copying the link, then connect.",
+		"dnstt":      "If SSH is blocked, import the DNS link instead. It is slower but works on networks that only allow DNS.",
+		"slipstream": "Use the Slipstream domain with your username and password in a Slipstream-capable client.",
+		"quic":       "On slow or lossy connections, import the QUIC link into a QUIC-capable client instead of the SSH link.",
+	},
+	"fa": {
+		"ssh":        "لینک SSH را با اسکن کد QR یا کپی لینک در NetMod (یا هر برنامه تونل SSH) وارد کرده و متصل شوید.",
+		"dnstt":      "اگر SSH مسدود است، لینک DNS را وارد کنید. سرعت کمتری دارد اما در شبکه‌هایی که فقط DNS باز است کار می‌کند.",
+		"slipstream": "دامنه Slipstream را همراه با نام کاربری و رمز عبور در یک کلاینت سازگار با Slipstream استفاده کنید.",
+		"quic":       "در اتصال‌های کند یا پرافت، به جای لینک SSH، لینک QUIC را در یک کلاینت سازگار با QUIC وارد کنید.",
+	},
+}
+
+type exportBundle struct {
+	Username     string     `json:"username"`
+	Password     string     `json:"password"`
+	Enabled      bool       `json:"enabled"`
+	TrafficLimit int64      `json:"traffic_limit"`
+	TrafficUsed  int64      `json:"traffic_used"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Links        []link     `json:"links"`
+	Instructions []string   `json:"instructions"`
+}
+
+// requireAPIToken rejects requests without the configured bearer token or
+// an API key granting scope. The API routes do not exist while no token is
+// set, unless the request carries a bearer token to try as a key.
+func (s *Server) requireAPIToken(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiToken := *s.apiToken.Load()
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if apiToken == "" && !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		addr := remoteAddr(r)
+		if s.cfg.Bans.Banned(addr) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "banned"})
+			return
+		}
+
+		if ok && apiToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1 {
+			s.cfg.Bans.Succeed(addr)
+			next.ServeHTTP(w, withActor(r, "api-token"))
+			return
+		}
+
+		key := s.lookupAPIKey(token)
+		if !ok || key == nil {
+			log.Printf("Rejected API request from %s to %s: invalid token", addr.(*net.TCPAddr).IP, r.URL.Path)
+			s.cfg.Bans.Fail(addr, "api")
+			s.cfg.Reports.AuthFailed("api")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		s.cfg.Bans.Succeed(addr)
+
+		if !key.Allows(scope) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "API key lacks the " + scope + " scope"})
+			return
+		}
+		if !s.keyUsage.allow(s.cfg.DB, key) {
+			w.Header().Set("Retry-After", "60")
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+			return
+		}
+		next.ServeHTTP(w, withActor(r, key.Name))
+	})
+}
+
+func (s *Server) handleClientExport(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	var client models.Client
+	if err := s.cfg.DB.Where("username = ?", username).First(&client).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "client not found"})
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	texts, ok := instructions[lang]
+	if !ok {
+		texts = instructions["en"]
+	}
+
+	bundle := exportBundle{
+		Username:     client.Username,
+		Password:     client.Password,
+		Enabled:      client.Enabled,
+		TrafficLimit: client.TrafficLimit,
+		TrafficUsed:  client.TrafficUsed,
+		Links:        s.clientLinks(&client, s.publicHost(r)),
+	}
+	if !client.ExpiresAt.IsZero() {
+		bundle.ExpiresAt = &client.ExpiresAt
+	}
+
+	seen := make(map[string]bool)
+	for i := range bundle.Links {
+		l := &bundle.Links[i]
+		if l.URI != "" {
+			png, err := qrcode.Encode(l.URI, qrcode.Medium, 256)
+			if err != nil {
+				log.Printf("Failed to render QR code for '%s': %v", client.Username, err)
+			} else {
+				l.QRCode = base64.StdEncoding.EncodeToString(png)
+			}
+		}
+		if !seen[l.Type] {
+			seen[l.Type] = true
+			bundle.Instructions = append(bundle.Instructions, texts[l.Type])
+		}
+	}
+
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+type verifyResult struct {
+	Match                     bool   `json:"match"`
+	Transport                 string `json:"transport"` // "ssh", "slipstream", or "quic" on a match
+	HostKeyFingerprint        string `json:"host_key_fingerprint"`
+	SlipstreamCertFingerprint string `json:"slipstream_cert_fingerprint"`
+	QUICCertFingerprint       string `json:"quic_cert_fingerprint,omitempty"`
+}
+
+// handleVerify lets clients check a pinned fingerprint against the server's
+// current SSH host key and Slipstream and QUIC certificates
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	// Base64 fingerprints often arrive with an unencoded '+' decoded as a space
+	fingerprint := strings.ReplaceAll(strings.TrimSpace(r.URL.Query().Get("fingerprint")), " ", "+")
+	if fingerprint == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "fingerprint is required"})
+		return
+	}
+
+	match := ""
+	switch {
+	case s.cfg.HostKeyFingerprint != "" && fingerprint == s.cfg.HostKeyFingerprint:
+		match = "ssh"
+	case s.cfg.SlipstreamCertFingerprint != "" && strings.EqualFold(fingerprint, s.cfg.SlipstreamCertFingerprint):
+		match = "slipstream"
+	case s.cfg.QUICCertFingerprint != "" && strings.EqualFold(fingerprint, s.cfg.QUICCertFingerprint):
+		match = "quic"
+	}
+
+	writeJSON(w, http.StatusOK, verifyResult{
+		Match:                     match != "",
+		Transport:                 match,
+		HostKeyFingerprint:        s.cfg.HostKeyFingerprint,
+		SlipstreamCertFingerprint: s.cfg.SlipstreamCertFingerprint,
+		QUICCertFingerprint:       s.cfg.QUICCertFingerprint,
+	})
+}
+
+// handleCountryStats reports logins by source country since startup
+func (s *Server) handleCountryStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.cfg.GeoIP.Stats()
+	if stats == nil {
+		stats = []geoip.CountryStats{}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
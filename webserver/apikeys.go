@@ -0,0 +1,64 @@
+package webserver
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+	"gorm.io/gorm"
+)
+
+// lookupAPIKey returns the unrevoked API key token belongs to, or nil
+func (s *Server) lookupAPIKey(token string) *models.APIKey {
+	if !strings.HasPrefix(token, models.APIKeyPrefix) {
+		return nil
+	}
+	var key models.APIKey
+	if err := s.cfg.DB.Where("hash = ?", models.HashAPIKey(token)).First(&key).Error; err != nil {
+		return nil
+	}
+	if key.Revoked() {
+		return nil
+	}
+	return &key
+}
+
+// keyUsage counts requests per API key in one-minute windows
+type keyUsage struct {
+	mu      sync.Mutex
+	windows map[uint]*keyWindow
+}
+
+type keyWindow struct {
+	start time.Time
+	count int
+}
+
+// allow counts a request by key and reports whether it is within the key's
+// rate limit. The key's last use is recorded in db once per window.
+func (u *keyUsage) allow(db *gorm.DB, key *models.APIKey) bool {
+	now := time.Now()
+
+	u.mu.Lock()
+	if u.windows == nil {
+		u.windows = make(map[uint]*keyWindow)
+	}
+	w, ok := u.windows[key.ID]
+	fresh := !ok || now.Sub(w.start) >= time.Minute
+	if fresh {
+		w = &keyWindow{start: now}
+		u.windows[key.ID] = w
+	}
+	w.count++
+	count := w.count
+	u.mu.Unlock()
+
+	if fresh {
+		if err := db.Model(key).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Printf("Failed to record use of API key '%s': %v", key.Name, err)
+		}
+	}
+	return key.RateLimit <= 0 || count <= key.RateLimit
+}
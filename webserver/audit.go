@@ -0,0 +1,98 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/libersuite-org/panel/audit"
+	"github.com/libersuite-org/panel/database/models"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type actorKey struct{}
+
+// withActor tags r with the name of the API credential that made it
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorKey{}, actor))
+}
+
+// audit records a change made through the API; before and after are as for
+// audit.Record
+func (s *Server) audit(r *http.Request, action, target string, before, after any) {
+	actor, _ := r.Context().Value(actorKey{}).(string)
+	entry := &models.AdminAudit{Actor: actor, Source: models.AuditAPI, Action: action, Target: target}
+	if addr, ok := remoteAddr(r).(*net.TCPAddr); ok {
+		entry.IP = addr.IP.String()
+	}
+	audit.Record(s.cfg.DB, entry, before, after)
+}
+
+type auditEntry struct {
+	ID     uint            `json:"id"`
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor"`
+	Source string          `json:"source"` // cli or api
+	IP     string          `json:"ip,omitempty"`
+	Action string          `json:"action"`
+	Target string          `json:"target,omitempty"`
+	Before json.RawMessage `json:"before,omitempty"` // changed fields before the action
+	After  json.RawMessage `json:"after,omitempty"`  // the same fields afterwards
+}
+
+// handleAuditList serves the newest admin audit entries. Query parameters
+// match 'panel audit': actor, action (a prefix such as "client"), since
+// (RFC 3339), and limit.
+func (s *Server) handleAuditList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := &audit.Filter{Actor: q.Get("actor"), Action: q.Get("action"), Limit: defaultAuditLimit}
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be an RFC 3339 time"})
+			return
+		}
+		filter.Since = since
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := audit.Query(s.cfg.DB, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read audit log"})
+		return
+	}
+	out := make([]auditEntry, 0, len(entries))
+	for _, e := range entries {
+		entry := auditEntry{
+			ID:     e.ID,
+			Time:   e.CreatedAt,
+			Actor:  e.Actor,
+			Source: e.Source,
+			IP:     e.IP,
+			Action: e.Action,
+			Target: e.Target,
+		}
+		if e.Before != "" {
+			entry.Before = json.RawMessage(e.Before)
+		}
+		if e.After != "" {
+			entry.After = json.RawMessage(e.After)
+		}
+		out = append(out, entry)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
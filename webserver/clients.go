@@ -0,0 +1,172 @@
+package webserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/clients"
+	"github.com/libersuite-org/panel/database/models"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+type clientSummary struct {
+	ID             uint       `json:"id"`
+	Username       string     `json:"username"`
+	Status         string     `json:"status"`
+	TrafficUsed    int64      `json:"traffic_used"`
+	TrafficLimit   int64      `json:"traffic_limit"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	LastConnection *time.Time `json:"last_connection,omitempty"`
+	OnlineSeconds  int64      `json:"online_seconds"` // total time with at least one open connection
+	Tags           []string   `json:"tags"`
+	Notes          string     `json:"notes,omitempty"`
+}
+
+type clientPage struct {
+	Clients []clientSummary `json:"clients"`
+	Total   int64           `json:"total"`
+	Page    int             `json:"page"`
+	PerPage int             `json:"per_page"`
+}
+
+// handleClientList serves one page of clients. Query parameters match
+// 'client list': status, tag, search, sort, and order (asc or desc), plus
+// page and per_page.
+func (s *Server) handleClientList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, perPage := 1, defaultPerPage
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "page must be a positive number"})
+			return
+		}
+		page = n
+	}
+	if v := q.Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPerPage {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "per_page must be between 1 and " + strconv.Itoa(maxPerPage)})
+			return
+		}
+		perPage = n
+	}
+
+	filter := &models.ClientFilter{
+		Status: q.Get("status"),
+		Tag:    q.Get("tag"),
+		Search: q.Get("search"),
+		Sort:   q.Get("sort"),
+		Desc:   q.Get("order") == "desc",
+		Limit:  perPage,
+		Offset: (page - 1) * perPage,
+	}
+
+	list, total, err := s.clients.List(filter)
+	if errors.Is(err, clients.ErrInvalidFilter) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load clients"})
+		return
+	}
+
+	out := clientPage{Clients: make([]clientSummary, 0, len(list)), Total: total, Page: page, PerPage: perPage}
+	for i := range list {
+		out.Clients = append(out.Clients, summarize(&list[i]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func summarize(c *models.Client) clientSummary {
+	summary := clientSummary{
+		ID:            c.ID,
+		Username:      c.Username,
+		Status:        c.Status(),
+		TrafficUsed:   c.TrafficUsed,
+		TrafficLimit:  c.TrafficLimit,
+		OnlineSeconds: c.OnlineSeconds,
+		Tags:          []string{},
+		Notes:         c.Notes,
+	}
+	if !c.ExpiresAt.IsZero() {
+		summary.ExpiresAt = &c.ExpiresAt
+	}
+	if !c.LastConnection.IsZero() {
+		summary.LastConnection = &c.LastConnection
+	}
+	if c.Tags != "" {
+		summary.Tags = strings.Split(c.Tags, ",")
+	}
+	return summary
+}
+
+// handleClientResetTraffic zeroes a client's traffic used, e.g. to make up
+// for an outage, without renewing it. Usage not yet flushed still counts.
+func (s *Server) handleClientResetTraffic(w http.ResponseWriter, r *http.Request) {
+	client, err := s.clients.Get(r.PathValue("username"))
+	if errors.Is(err, clients.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "client not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load client"})
+		return
+	}
+
+	before := *client
+	if err := s.clients.ResetTraffic(client.Username); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to reset traffic"})
+		return
+	}
+	client.TrafficUsed = 0
+	client.NotifiedQuota = false
+	s.audit(r, "client reset-traffic", client.Username, &before, client)
+
+	writeJSON(w, http.StatusOK, summarize(client))
+}
+
+type usageDay struct {
+	Day   string `json:"day"`
+	Bytes int64  `json:"bytes"`
+}
+
+// handleClientUsage serves a client's daily traffic for the last ?days=
+// days (default 30, up to 90), oldest first, for charting
+func (s *Server) handleClientUsage(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 90 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be between 1 and 90"})
+			return
+		}
+		days = n
+	}
+
+	var client models.Client
+	if err := s.cfg.DB.Where("username = ?", r.PathValue("username")).First(&client).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "client not found"})
+		return
+	}
+
+	history, err := models.TrafficHistory(s.cfg.DB, client.ID, days, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load traffic history"})
+		return
+	}
+	out := make([]usageDay, len(history))
+	for i, day := range history {
+		out[i] = usageDay{Day: day.Day, Bytes: day.Bytes}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
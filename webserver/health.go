@@ -0,0 +1,21 @@
+package webserver
+
+import (
+	"net/http"
+)
+
+// handleHealth answers load balancer and monitoring probes without auth:
+// 200 when the server is fit to take traffic, 503 otherwise
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	check := s.cfg.Health
+	if check == nil {
+		check = func() error { return s.cfg.DB.Exec("SELECT 1").Error }
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := check(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unhealthy", "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
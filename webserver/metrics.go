@@ -0,0 +1,55 @@
+package webserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// handleMetrics serves counters in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	stats := s.cfg.DNS.Stats()
+	metric(w, "libersuite_dns_queries_total", "counter", "DNS queries received per tunnel domain")
+	for _, st := range stats {
+		fmt.Fprintf(w, "libersuite_dns_queries_total{domain=%q} %d\n", st.Domain, st.Queries)
+	}
+	metric(w, "libersuite_dns_errors_total", "counter", "DNS queries the backend failed to answer per tunnel domain")
+	for _, st := range stats {
+		fmt.Fprintf(w, "libersuite_dns_errors_total{domain=%q} %d\n", st.Domain, st.Errors)
+	}
+	metric(w, "libersuite_dns_bytes_total", "counter", "DNS payload bytes forwarded per tunnel domain and direction")
+	for _, st := range stats {
+		fmt.Fprintf(w, "libersuite_dns_bytes_total{domain=%q,direction=\"in\"} %d\n", st.Domain, st.BytesIn)
+		fmt.Fprintf(w, "libersuite_dns_bytes_total{domain=%q,direction=\"out\"} %d\n", st.Domain, st.BytesOut)
+	}
+	metric(w, "libersuite_dns_truncated_total", "counter", "UDP replies truncated for resolvers to retry over TCP per tunnel domain")
+	for _, st := range stats {
+		fmt.Fprintf(w, "libersuite_dns_truncated_total{domain=%q} %d\n", st.Domain, st.Truncated)
+	}
+	metric(w, "libersuite_dns_latency_avg_seconds", "gauge", "Average backend response time per tunnel domain")
+	for _, st := range stats {
+		fmt.Fprintf(w, "libersuite_dns_latency_avg_seconds{domain=%q} %g\n", st.Domain, st.AvgLatency.Seconds())
+	}
+	metric(w, "libersuite_dns_backend_up", "gauge", "Whether a DNS backend is in rotation (1) or failed its health checks (0)")
+	for _, st := range stats {
+		for _, b := range st.Backends {
+			up := 0
+			if b.Healthy {
+				up = 1
+			}
+			fmt.Fprintf(w, "libersuite_dns_backend_up{domain=%q,backend=%q} %d\n", st.Domain, b.Addr, up)
+		}
+	}
+	metric(w, "libersuite_dns_unmatched_total", "counter", "DNS queries that matched no tunnel domain")
+	fmt.Fprintf(w, "libersuite_dns_unmatched_total %d\n", s.cfg.DNS.Unmatched())
+	metric(w, "libersuite_dns_rate_limited_total", "counter", "UDP DNS queries dropped over the per-source rate limit")
+	fmt.Fprintf(w, "libersuite_dns_rate_limited_total %d\n", s.cfg.DNS.RateLimited())
+	metric(w, "libersuite_dns_amplification_total", "counter", "UDP DNS replies withheld for exceeding the amplification ratio")
+	fmt.Fprintf(w, "libersuite_dns_amplification_total %d\n", s.cfg.DNS.Amplified())
+}
+
+func metric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
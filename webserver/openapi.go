@@ -0,0 +1,171 @@
+package webserver
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libersuite-org/panel/database/models"
+)
+
+// handleOpenAPI serves an OpenAPI 3 document generated from apiRoutes
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
+
+// handleAPIDocs serves Swagger UI for the OpenAPI document. The UI assets
+// come from a CDN so the binary does not carry them.
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(apiDocsPage))
+}
+
+const apiDocsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LiberSuite Panel API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func openAPIDocument() map[string]any {
+	paths := make(map[string]map[string]any)
+	for _, route := range apiRoutes {
+		if paths[route.path] == nil {
+			paths[route.path] = make(map[string]any)
+		}
+		paths[route.path][strings.ToLower(route.method)] = openAPIOperation(&route)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "LiberSuite Panel API",
+			"version": "1",
+			"description": "Authenticate with the server's API token or a key from 'panel apikey create' " +
+				"as a Bearer token. Each operation lists the key scope it needs. Scopes: " +
+				strings.Join(models.APIScopes, ", ") + "; admin grants all.",
+		},
+		"servers": []map[string]string{{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearer": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func openAPIOperation(route *apiRoute) map[string]any {
+	op := map[string]any{"summary": route.summary}
+
+	if route.scope != "" {
+		op["security"] = []map[string][]string{{"bearer": {}}}
+		op["description"] = "Requires the " + route.scope + " scope."
+	}
+
+	var params []map[string]any
+	for _, p := range route.params {
+		schema := map[string]any{"type": p.kind}
+		if len(p.enum) > 0 {
+			schema["enum"] = p.enum
+		}
+		params = append(params, map[string]any{
+			"name":        p.name,
+			"in":          p.in,
+			"required":    p.in == "path",
+			"description": p.description,
+			"schema":      schema,
+		})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	if route.body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(route.body))}},
+		}
+	}
+
+	status := route.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case route.content != "":
+		response["content"] = map[string]any{route.content: map[string]any{"schema": map[string]string{"type": "string"}}}
+	case route.response != nil:
+		response["content"] = map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(route.response))}}
+	}
+	responses := map[string]any{strconv.Itoa(status): response}
+	if route.scope != "" {
+		responses["401"] = map[string]string{"description": "Missing or invalid token"}
+		responses["403"] = map[string]string{"description": "Key lacks the scope, or the address is banned"}
+		responses["429"] = map[string]string{"description": "Key rate limit exceeded"}
+	}
+	op["responses"] = responses
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes t as an OpenAPI schema, following its JSON encoding
+func schemaOf(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]any)
+		var required []string
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = schemaOf(f.Type)
+			if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": props}
+		if required != nil {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
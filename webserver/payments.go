@@ -0,0 +1,41 @@
+package webserver
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/libersuite-org/panel/payments"
+)
+
+// maxWebhookBody bounds the payment callbacks read into memory
+const maxWebhookBody = 64 << 10
+
+// handlePaymentWebhook takes the signed callbacks payment gateways send when
+// an invoice is paid or fails. It answers 2xx only once the update is
+// applied, so gateways retry callbacks that hit a transient error.
+func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
+		return
+	}
+
+	provider := r.PathValue("provider")
+	err = s.cfg.Payments.HandleWebhook(r.Context(), provider, r, body)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case errors.Is(err, payments.ErrUnknownProvider):
+		http.NotFound(w, r)
+	case errors.Is(err, payments.ErrSignature):
+		log.Printf("Rejected %s payment callback from %s: invalid signature", provider, remoteAddr(r))
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid signature"})
+	case errors.Is(err, payments.ErrUnknownOrder):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Failed to apply %s payment callback: %v", provider, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to apply payment"})
+	}
+}
@@ -0,0 +1,89 @@
+package webserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma-separated list of IPs and CIDRs
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.Contains(part, "/") {
+			prefix, err := netip.ParsePrefix(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy '%s': %w", part, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %w", part, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (s *Server) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP replaces r.RemoteAddr with the client address reported by a
+// trusted proxy, so everything downstream sees the real client. The
+// X-Forwarded-For chain is walked from the right and the first hop that
+// isn't a trusted proxy wins; headers from other peers are ignored.
+func (s *Server) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !s.trusted(peer.Addr()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var client netip.Addr
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			client = addr
+			if !s.trusted(addr) {
+				break
+			}
+		}
+		if !client.IsValid() {
+			client, _ = netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		}
+
+		if client.IsValid() {
+			r.RemoteAddr = netip.AddrPortFrom(client.Unmap(), 0).String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteAddr returns the (proxy-resolved) client address of r
+func remoteAddr(r *http.Request) net.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return net.TCPAddrFromAddrPort(addrPort)
+}
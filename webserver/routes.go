@@ -0,0 +1,140 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/libersuite-org/panel/geoip"
+)
+
+// apiRoute describes one API endpoint. The table below both registers the
+// handlers and generates the OpenAPI document, so the two cannot drift.
+type apiRoute struct {
+	method   string
+	path     string
+	scope    string // API key scope required, empty for a public route
+	summary  string
+	params   []apiParam
+	body     any    // example of the JSON request body, nil for none
+	response any    // example of the JSON response, nil for none
+	status   int    // success status, 200 when zero
+	content  string // response media type, JSON when empty
+	handler  func(*Server, http.ResponseWriter, *http.Request)
+}
+
+type apiParam struct {
+	name        string
+	in          string // "path" or "query"
+	kind        string // OpenAPI type: string, integer, number, or boolean
+	description string
+	enum        []string
+}
+
+var usernameParam = apiParam{name: "username", in: "path", kind: "string", description: "Client username"}
+
+var apiRoutes = []apiRoute{
+	{
+		method: "GET", path: "/api/v1/verify",
+		summary: "Check a pinned fingerprint against the server's current keys",
+		params: []apiParam{
+			{name: "fingerprint", in: "query", kind: "string", description: "SSH host key, Slipstream certificate, or QUIC certificate fingerprint"},
+		},
+		response: verifyResult{},
+		handler:  (*Server).handleVerify,
+	},
+	{
+		method: "GET", path: "/api/v1/clients", scope: "clients:read",
+		summary: "List clients, one page at a time",
+		params: []apiParam{
+			{name: "status", in: "query", kind: "string", description: "Only clients in this state", enum: []string{"active", "disabled", "expired", "no-traffic"}},
+			{name: "tag", in: "query", kind: "string", description: "Only clients with this tag"},
+			{name: "search", in: "query", kind: "string", description: "Substring of the username or notes"},
+			{name: "sort", in: "query", kind: "string", description: "Sort column", enum: []string{"id", "username", "traffic", "expires", "last-seen", "online"}},
+			{name: "order", in: "query", kind: "string", description: "Sort order", enum: []string{"asc", "desc"}},
+			{name: "page", in: "query", kind: "integer", description: "Page number, from 1"},
+			{name: "per_page", in: "query", kind: "integer", description: "Clients per page, up to 500 (default 50)"},
+		},
+		response: clientPage{},
+		handler:  (*Server).handleClientList,
+	},
+	{
+		method: "GET", path: "/api/v1/clients/{username}/usage", scope: "clients:read",
+		summary: "Daily traffic of a client, oldest first",
+		params: []apiParam{
+			usernameParam,
+			{name: "days", in: "query", kind: "integer", description: "Number of days, up to 90 (default 30)"},
+		},
+		response: []usageDay{},
+		handler:  (*Server).handleClientUsage,
+	},
+	{
+		method: "GET", path: "/api/v1/clients/{username}/export", scope: "clients:read",
+		summary: "Connection links, QR codes, and instructions for a client",
+		params: []apiParam{
+			usernameParam,
+			{name: "lang", in: "query", kind: "string", description: "Instruction language", enum: []string{"en", "fa"}},
+		},
+		response: exportBundle{},
+		handler:  (*Server).handleClientExport,
+	},
+	{
+		method: "POST", path: "/api/v1/clients/{username}/reset-traffic", scope: "clients:write",
+		summary:  "Zero a client's traffic used, leaving its expiry alone",
+		params:   []apiParam{usernameParam},
+		response: clientSummary{},
+		handler:  (*Server).handleClientResetTraffic,
+	},
+	{
+		method: "GET", path: "/api/v1/acl", scope: "acl:read",
+		summary:  "List ACL rules",
+		response: []aclRule{},
+		handler:  (*Server).handleACLList,
+	},
+	{
+		method: "POST", path: "/api/v1/acl", scope: "acl:write",
+		summary:  "Add an ACL rule",
+		body:     aclRule{},
+		response: aclRule{},
+		status:   http.StatusCreated,
+		handler:  (*Server).handleACLCreate,
+	},
+	{
+		method: "DELETE", path: "/api/v1/acl/{id}", scope: "acl:write",
+		summary: "Remove an ACL rule",
+		params:  []apiParam{{name: "id", in: "path", kind: "integer", description: "Rule ID"}},
+		status:  http.StatusNoContent,
+		handler: (*Server).handleACLDelete,
+	},
+	{
+		method: "GET", path: "/api/v1/audit", scope: "audit:read",
+		summary: "Admin actions taken through the CLI and the API, newest first",
+		params: []apiParam{
+			{name: "actor", in: "query", kind: "string", description: "Only actions by this OS user or API key"},
+			{name: "action", in: "query", kind: "string", description: "Only actions starting with this, e.g. client or acl add"},
+			{name: "since", in: "query", kind: "string", description: "Only actions at or after this RFC 3339 time"},
+			{name: "limit", in: "query", kind: "integer", description: "Entries to return, up to 1000 (default 100)"},
+		},
+		response: []auditEntry{},
+		handler:  (*Server).handleAuditList,
+	},
+	{
+		method: "GET", path: "/api/v1/stats/countries", scope: "stats:read",
+		summary:  "Logins by source country since startup",
+		response: []geoip.CountryStats{},
+		handler:  (*Server).handleCountryStats,
+	},
+	{
+		method: "GET", path: "/api/v1/stream/usage", scope: "stats:read",
+		summary: "Live per-client usage as server-sent events of usageSample",
+		params: []apiParam{
+			{name: "interval", in: "query", kind: "number", description: "Seconds between events, at least 1 (default 2)"},
+		},
+		content: "text/event-stream",
+		handler: (*Server).handleUsageStream,
+	},
+	{
+		method: "GET", path: "/metrics", scope: "stats:read",
+		summary: "Prometheus metrics",
+		content: "text/plain",
+		handler: (*Server).handleMetrics,
+	},
+}
@@ -0,0 +1,283 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/libersuite-org/panel/accounting"
+	"github.com/libersuite-org/panel/acl"
+	"github.com/libersuite-org/panel/authcache"
+	"github.com/libersuite-org/panel/bans"
+	"github.com/libersuite-org/panel/clients"
+	"github.com/libersuite-org/panel/database/models"
+	"github.com/libersuite-org/panel/decoy"
+	"github.com/libersuite-org/panel/dnsdispatcher"
+	"github.com/libersuite-org/panel/export"
+	"github.com/libersuite-org/panel/geoip"
+	"github.com/libersuite-org/panel/inproc"
+	"github.com/libersuite-org/panel/payments"
+	"github.com/libersuite-org/panel/quicserver"
+	"github.com/libersuite-org/panel/reports"
+	"github.com/libersuite-org/panel/tunnel"
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	Hosts                     []string // bind addresses, every interface when empty
+	Port                      int
+	PublicHost                string // host put in exported links, defaults to the request host
+	PublicPort                int    // mixed SSH/SOCKS entrypoint port
+	QUICPort                  int    // QUIC listener port, 0 when disabled
+	QUICCertFingerprint       string
+	Token                     string // connection token appended to SSH links
+	TokenLinks                bool   // links carry clients' auth tokens instead of their passwords, for servers taking tokens as SSH passwords
+	DNSTTDomains              []string
+	DNSTTPubkey               string
+	SlipstreamDomains         []string
+	SlipstreamCertFingerprint string
+	HostKeyFingerprint        string           // SSH host key fingerprint clients can pin
+	APIToken                  string           // bearer token with every API scope; see SetAPIToken
+	DB                        *gorm.DB         // clients, API keys, and ACL rules
+	Auth                      *authcache.Cache // told about clients the API changes, nil when not caching
+	ACL                       *acl.Engine
+	GeoIP                     *geoip.Policy
+	DNS                       *dnsdispatcher.DnsDispatcher // source of DNS metrics, nil when DNS is disabled
+	Accounting                *accounting.Accountant       // source of live usage streams
+	TrustedProxies            []netip.Prefix               // peers whose X-Forwarded-For is believed
+	InProcess                 *inproc.Listener             // connections handed over by the mixed entrypoint, nil disables
+	Bans                      *bans.Guard                  // bans IPs that repeatedly fail API auth, nil disables
+	Health                    func() error                 // backs /healthz, nil only checks DB
+	Payments                  *payments.Service            // applies payment gateway callbacks, nil disables
+	Reports                   *reports.Reporter            // counts failed API logins for operator reports, nil disables
+	Decoy                     *decoy.Decoy                 // serves paths the panel doesn't, nil answers 404
+}
+
+type Server struct {
+	cfg       *Config
+	server    *http.Server
+	closing   chan struct{} // closed on shutdown to end long-lived streams
+	apiToken  atomic.Pointer[string]
+	domains   atomic.Pointer[tunnelDomains]
+	listening atomic.Bool
+	keyUsage  keyUsage
+	clients   *clients.Manager
+}
+
+// tunnelDomains are the DNS tunnel domains put in exported links
+type tunnelDomains struct {
+	dnstt      []string
+	slipstream []string
+}
+
+func New(cfg *Config) *Server {
+	s := &Server{cfg: cfg, closing: make(chan struct{}), clients: clients.NewManager(cfg.DB, cfg.Auth)}
+	s.SetAPIToken(cfg.APIToken)
+	s.SetTunnelDomains(cfg.DNSTTDomains, cfg.SlipstreamDomains)
+	return s
+}
+
+// SetTunnelDomains replaces the dnstt and Slipstream domains links are
+// exported for on a running server
+func (s *Server) SetTunnelDomains(dnstt, slipstream []string) {
+	if s == nil {
+		return
+	}
+	s.domains.Store(&tunnelDomains{dnstt: dnstt, slipstream: slipstream})
+}
+
+// SetAPIToken replaces the API bearer token on a running server; an empty
+// token disables the API
+func (s *Server) SetAPIToken(token string) {
+	if s == nil {
+		return
+	}
+	s.apiToken.Store(&token)
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sub/{token}", s.handleSubscription)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("POST /payments/{provider}/webhook", s.handlePaymentWebhook)
+	mux.HandleFunc("GET /api/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc("GET /api/docs", s.handleAPIDocs)
+	for _, route := range apiRoutes {
+		var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route.handler(s, w, r)
+		})
+		if route.scope != "" {
+			handler = s.requireAPIToken(route.scope, handler)
+		}
+		mux.Handle(route.method+" "+route.path, handler)
+	}
+	if s.cfg.Decoy != nil {
+		mux.Handle("/", s.cfg.Decoy)
+	}
+
+	s.server = &http.Server{
+		Handler:           s.realIP(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.server.RegisterOnShutdown(func() { close(s.closing) })
+
+	var listeners []net.Listener
+	for _, addr := range tunnel.ListenAddrs(s.cfg.Hosts, s.cfg.Port) {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return fmt.Errorf("failed to start web listener on %s: %w", addr, err)
+		}
+		log.Printf("Starting web server on %s", addr)
+		listeners = append(listeners, listener)
+	}
+	if s.cfg.InProcess != nil {
+		listeners = append(listeners, s.cfg.InProcess.Attach())
+	}
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	errChan := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			errChan <- s.server.Serve(listener)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		_ = s.server.Close()
+		return err
+	}
+}
+
+// Listening reports whether the web server is accepting connections
+func (s *Server) Listening() bool {
+	return s != nil && s.listening.Load()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.cfg.InProcess != nil {
+		_ = s.cfg.InProcess.Close()
+	}
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var client models.Client
+	if err := s.cfg.DB.Where("sub_token = ?", token).First(&client).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var uris []string
+	for _, link := range s.clientLinks(&client, s.publicHost(r)) {
+		if link.URI != "" {
+			uris = append(uris, link.URI)
+		}
+	}
+
+	// Widely used by subscription-aware client apps to show quota and expiry
+	userInfo := fmt.Sprintf("upload=0; download=%d; total=%d", client.TrafficUsed, client.TrafficLimit)
+	if !client.ExpiresAt.IsZero() {
+		userInfo += fmt.Sprintf("; expire=%d", client.ExpiresAt.Unix())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Subscription-Userinfo", userInfo)
+	w.Header().Set("Profile-Update-Interval", "12")
+	if s.cfg.HostKeyFingerprint != "" {
+		w.Header().Set("Host-Key-Fingerprint", s.cfg.HostKeyFingerprint)
+	}
+	fmt.Fprintln(w, strings.Join(uris, "\n"))
+}
+
+type link struct {
+	Type        string `json:"type"`
+	URI         string `json:"uri,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // SSH host key or TLS cert pin
+	QRCode      string `json:"qr_png,omitempty"`      // base64 PNG
+}
+
+// clientLinks returns one entry per transport the server is configured with
+func (s *Server) clientLinks(client *models.Client, host string) []link {
+	password := client.Password
+	sshURI := export.SSHURL(client.Username, password, host, s.cfg.PublicPort, s.cfg.Token, client.Username)
+	if s.cfg.TokenLinks {
+		// Links with an expired token would only fail to log in
+		if client.AuthToken != "" && !client.TokenValid(client.AuthToken) {
+			log.Printf("Not serving links to client '%s': its auth token has expired", client.Username)
+			return nil
+		}
+		authToken, err := s.clients.AuthToken(client.Username)
+		if err != nil {
+			log.Printf("Failed to get the auth token of client '%s': %v", client.Username, err)
+			return nil
+		}
+		password = authToken
+		sshURI = export.SSHTokenURL(client.Username, authToken, host, s.cfg.PublicPort, s.cfg.Token, client.Username)
+	}
+
+	links := []link{{
+		Type:        "ssh",
+		URI:         sshURI,
+		Fingerprint: s.cfg.HostKeyFingerprint,
+	}}
+	domains := s.domains.Load()
+	if s.cfg.DNSTTPubkey != "" {
+		for _, domain := range domains.dnstt {
+			links = append(links, link{
+				Type:        "dnstt",
+				URI:         export.DNSTTURL(client.Username, export.DefaultResolver, domain, s.cfg.DNSTTPubkey, client.Username, password),
+				Domain:      domain,
+				Fingerprint: s.cfg.HostKeyFingerprint,
+			})
+		}
+	}
+	for _, domain := range domains.slipstream {
+		links = append(links, link{Type: "slipstream", Domain: domain, Fingerprint: s.cfg.SlipstreamCertFingerprint})
+	}
+	if s.cfg.QUICPort != 0 && client.AllowsProtocol(models.ProtocolQUIC) {
+		links = append(links, link{
+			Type:        "quic",
+			URI:         export.QUICURL(client.Username, password, host, s.cfg.QUICPort, quicserver.ALPN, s.cfg.QUICCertFingerprint, client.Username),
+			Fingerprint: s.cfg.QUICCertFingerprint,
+		})
+	}
+	return links
+}
+
+func (s *Server) publicHost(r *http.Request) string {
+	if s.cfg.PublicHost != "" {
+		return s.cfg.PublicHost
+	}
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		return h
+	}
+	// An IPv6 literal without a port keeps its brackets
+	return strings.Trim(r.Host, "[]")
+}
@@ -0,0 +1,99 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultStreamInterval = 2 * time.Second
+	minStreamInterval     = time.Second
+)
+
+type usageSample struct {
+	ClientID    uint    `json:"client_id"`
+	Username    string  `json:"username"`
+	TrafficUsed int64   `json:"traffic_used"`
+	Bytes       int64   `json:"bytes"` // transferred since the previous event
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	Connections int     `json:"connections"`
+}
+
+// handleUsageStream pushes live per-client counters as server-sent events
+// every ?interval= seconds
+func (s *Server) handleUsageStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming unsupported"})
+		return
+	}
+
+	interval := defaultStreamInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid interval"})
+			return
+		}
+		interval = max(time.Duration(secs*float64(time.Second)), minStreamInterval)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := make(map[uint]int64)
+	lastAt := time.Now()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(lastAt).Seconds()
+			lastAt = now
+
+			var samples []usageSample
+			if s.cfg.Accounting != nil {
+				usage := s.cfg.Accounting.Snapshot()
+				samples = make([]usageSample, 0, len(usage))
+				seen := make(map[uint]int64, len(usage))
+				for _, u := range usage {
+					sample := usageSample{
+						ClientID:    u.ClientID,
+						Username:    u.Username,
+						TrafficUsed: u.TrafficUsed,
+						Connections: u.Connections,
+					}
+					// A client seen for the first time, or reset from the
+					// CLI, has no meaningful delta yet
+					if prev, ok := last[u.ClientID]; ok && u.TrafficUsed >= prev {
+						sample.Bytes = u.TrafficUsed - prev
+						sample.BytesPerSec = float64(sample.Bytes) / elapsed
+					}
+					seen[u.ClientID] = u.TrafficUsed
+					samples = append(samples, sample)
+				}
+				last = seen
+			}
+
+			data, err := json.Marshal(samples)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: usage\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}